@@ -0,0 +1,73 @@
+package vegeta
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ApdexReporter prints the Apdex score of the responses against a target
+// latency T, which rates the user experience from 0 to 1. Responses within
+// T are satisfied, within 4T tolerating, and slower ones frustrated, along
+// with the ones with errors.
+type ApdexReporter struct {
+	target     time.Duration
+	satisfied  uint64
+	tolerating uint64
+	frustrated uint64
+	mu         sync.Mutex
+}
+
+// NewApdexReporter initializes an ApdexReporter with the target latency T
+func NewApdexReporter(target time.Duration) *ApdexReporter {
+	return &ApdexReporter{target: target}
+}
+
+// Report writes the Apdex score and the counts of each of its buckets to
+// out. It returns an error in case of failure.
+func (r *ApdexReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := r.satisfied + r.tolerating + r.frustrated
+	if total == 0 {
+		_, err := fmt.Fprintln(out, "No results recorded")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
+	fmt.Fprintf(w, "Apdex(T=%s)\t%.2f\n", r.target, r.score())
+	fmt.Fprintf(w, "Satisfied\t%d\n", r.satisfied)
+	fmt.Fprintf(w, "Tolerating\t%d\n", r.tolerating)
+	fmt.Fprintf(w, "Frustrated\t%d\n", r.frustrated)
+	return w.Flush()
+}
+
+// score returns the Apdex score of the counted responses, the ratio of the
+// satisfied ones plus half of the tolerating ones
+func (r *ApdexReporter) score() float64 {
+	total := r.satisfied + r.tolerating + r.frustrated
+	return (float64(r.satisfied) + float64(r.tolerating)/2) / float64(total)
+}
+
+// add counts a response in the bucket of its timing
+func (r *ApdexReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case res.err != nil, res.timing > 4*r.target:
+		r.frustrated++
+	case res.timing > r.target:
+		r.tolerating++
+	default:
+		r.satisfied++
+	}
+	return nil
+}
+
+// Reset clears the counts of the responses
+func (r *ApdexReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.satisfied, r.tolerating, r.frustrated = 0, 0, 0
+}
@@ -0,0 +1,49 @@
+package vegeta
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApdexReporter(t *testing.T) {
+	rep := NewApdexReporter(100 * time.Millisecond)
+	for _, res := range []*result{
+		{code: 200, timing: 10 * time.Millisecond},  // Satisfied
+		{code: 200, timing: 100 * time.Millisecond}, // Satisfied at T
+		{code: 200, timing: 90 * time.Millisecond},  // Satisfied
+		{code: 200, timing: 250 * time.Millisecond}, // Tolerating
+		{code: 200, timing: 400 * time.Millisecond}, // Tolerating at 4T
+		{code: 200, timing: 401 * time.Millisecond}, // Frustrated
+		{code: 200, timing: 50 * time.Millisecond},  // Satisfied
+		{code: 204, timing: 60 * time.Millisecond},  // Satisfied
+		// Frustrated by its error, however fast
+		{code: 500, timing: 5 * time.Millisecond, err: errors.New("Internal Server Error")},
+	} {
+		rep.add(res)
+	}
+
+	// (5 satisfied + 2 tolerating / 2) / 9 responses
+	if got, want := rep.score(), 6.0/9; got != want {
+		t.Fatalf("Wrong Apdex score: want %v, got %v", want, got)
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	want := []string{"Apdex(T=100ms) 0.67", "Satisfied 5", "Tolerating 2", "Frustrated 2"}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, line := range lines {
+		if i >= len(want) || strings.Join(strings.Fields(line), " ") != want[i] {
+			t.Fatalf("Wrong report:\nwant %q\ngot  %q", want, lines)
+		}
+	}
+
+	rep.Reset()
+	out.Reset()
+	if rep.Report(out); out.String() != "No results recorded\n" {
+		t.Errorf("Reset didn't clear the responses: %q", out.String())
+	}
+}
@@ -1,28 +1,802 @@
 package vegeta
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Attacker is an attack executor which wraps an http.Client
+type Attacker struct {
+	hits      uint64 // Atomically counted, first to be 64-bit aligned
+	dialer    *net.Dialer
+	pinned    *pinnedHosts // Set when the hosts are resolved only once
+	transport *http.Transport
+	client    http.Client
+	timeout   time.Duration
+	header    http.Header
+	host      string
+	auth      *url.Userinfo
+	redirects int
+	workers   uint64
+	requests  uint64
+	rampTo    uint64
+	bodyBytes int
+	errLen    int
+	maxBody   int64
+	decode    bool
+	modifiers []RequestModifier
+	proxyURL  *url.URL
+	retry     RetryPolicy
+	validator *Validator
+	okCodes   map[uint64]bool
+	rand      *rand.Rand
+	byteRate  uint64
+	poisson   bool
+	progress  io.Writer
+	interval  time.Duration
+	warmup    time.Duration
+	cooldown  time.Duration
+	abortAt   float64
+	abortOver time.Duration
+	limits    bool
+	websocket bool
+	sample    uint64
+	pctiles   PercentileMethod
+	digits    int
+	captures  []string // The names of the captured response headers
+	every     uint64   // The responses whose headers are captured
+	clock     Clock
+}
+
+const (
+	// DefaultConnections is the default maximum number of idle connections
+	// an Attacker keeps alive per host
+	DefaultConnections = 10000
+	// DefaultRedirects is the default number of redirects an Attacker follows
+	DefaultRedirects = 10
+	// NoFollow is the value of Redirects which makes an Attacker record
+	// redirect responses as they are instead of following them
+	NoFollow = -1
+)
+
+// redirectsKey is the context key of the redirects counter of a hit
+type redirectsKey struct{}
+
+// proxiedKey is the context key of the proxied flag of a hit
+type proxiedKey struct{}
+
+// timeoutKey is the context key of the timeout of a target
+type timeoutKey struct{}
+
+// DefaultAttacker is the Attacker used by Attack
+var DefaultAttacker = NewAttacker()
+
+// NewAttacker returns a new Attacker configured with the passed options
+func NewAttacker(opts ...func(*Attacker)) *Attacker {
+	a := &Attacker{
+		dialer:    &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		redirects: DefaultRedirects,
+		rand:      NewRand(0),
+		decode:    true,
+		clock:     SystemClock,
+	}
+	// Compressed bodies are decoded by hit, which counts their bytes on
+	// the wire as well
+	a.transport = &http.Transport{
+		Proxy:               a.proxy,
+		DialContext:         a.dial,
+		MaxIdleConnsPerHost: DefaultConnections,
+		DisableCompression:  true,
+	}
+	a.client = http.Client{
+		Transport:     a.transport,
+		CheckRedirect: a.checkRedirect,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Timeout returns an option which sets the maximum duration of each request,
+// including reading its response body. Requests exceeding it are cancelled
+// and recorded with a timeout error. Zero means no timeout.
+func Timeout(d time.Duration) func(*Attacker) {
+	return func(a *Attacker) { a.timeout = d }
+}
+
+// WithTimeout returns a shallow copy of the target req whose requests time
+// out after d, instead of after the Timeout of the Attacker, e.g. for slower
+// endpoints. Zero means no timeout.
+func WithTimeout(req *http.Request, d time.Duration) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), timeoutKey{}, d))
+}
+
+// Headers returns an option which adds the passed headers to every request,
+// in addition to the ones of its target.
+func Headers(h http.Header) func(*Attacker) {
+	return func(a *Attacker) { a.header = h }
+}
+
+// BasicAuth returns an option which sets the Authorization header of every
+// request to the HTTP basic authentication of username and password. An
+// empty username leaves the headers of the targets as they are, which is
+// the default.
+func BasicAuth(username, password string) func(*Attacker) {
+	return func(a *Attacker) {
+		a.auth = nil
+		if username != "" {
+			a.auth = url.UserPassword(username, password)
+		}
+	}
+}
+
+// Host returns an option which sets the Host header of every request to
+// host, independently of the hosts their URLs connect to, e.g. to attack a
+// virtual host of a server through its IP address. TLS connections still
+// verify the host of the URL unless TLSConfig sets their ServerName.
+// Empty keeps the hosts of the URLs, which is the default.
+func Host(host string) func(*Attacker) {
+	return func(a *Attacker) { a.host = host }
+}
+
+// KeepAlive returns an option which enables or disables the reuse of
+// connections between requests. It is enabled by default.
+// When disabled, each request uses a fresh connection.
+func KeepAlive(keepalive bool) func(*Attacker) {
+	return func(a *Attacker) {
+		a.transport.DisableKeepAlives = !keepalive
+		if !keepalive {
+			a.dialer.KeepAlive = -1
+		}
+	}
+}
+
+// Connections returns an option which sets the maximum number of idle
+// connections kept alive per host for reuse
+func Connections(n int) func(*Attacker) {
+	return func(a *Attacker) { a.transport.MaxIdleConnsPerHost = n }
+}
+
+// Ramp returns an option which linearly increases the rate of the attack
+// from its specified rate to the passed one over its duration.
+// Zero means a constant rate, which is the default.
+func Ramp(to uint64) func(*Attacker) {
+	return func(a *Attacker) { a.rampTo = to }
+}
+
+// Workers returns an option which bounds the number of concurrent requests
+// to n. When all workers are busy, hits wait for one to be available and
+// their results are recorded as delayed. Zero means unbounded, with every
+// hit executed in its own goroutine, which is the default.
+func Workers(n uint64) func(*Attacker) {
+	return func(a *Attacker) { a.workers = n }
+}
+
+// MaxRequests returns an option which stops attacks after n requests, or
+// at the end of their duration if sooner. Zero means no limit, which is the
+// default.
+func MaxRequests(n uint64) func(*Attacker) {
+	return func(a *Attacker) { a.requests = n }
+}
+
+// CaptureBodies returns an option which retains the first n bytes of each
+// response body in its result, e.g. to inspect the bodies of failures.
+// Bodies are always read fully so connections can be reused.
+// Zero retains nothing, which is the default.
+func CaptureBodies(n int) func(*Attacker) {
+	return func(a *Attacker) { a.bodyBytes = n }
+}
+
+// Modifiers returns an option which applies the passed RequestModifiers,
+// in order, to every request after its headers are set. Modifiers of
+// several options are applied in the order of the options.
+func Modifiers(ms ...RequestModifier) func(*Attacker) {
+	return func(a *Attacker) { a.modifiers = append(a.modifiers, ms...) }
+}
+
+// TruncateErrors returns an option which truncates the message of each
+// error to n characters, ending with an ellipsis, before it's recorded, so
+// that errors out of enormous response bodies keep the error set readable
+// and bounded. Zero keeps the messages whole, which is the default.
+func TruncateErrors(n int) func(*Attacker) {
+	return func(a *Attacker) { a.errLen = n }
+}
+
+// MaxBody returns an option which limits the bytes read of each response
+// body to n, which are the only ones counted as received. The rest of the
+// body is discarded so the connection can be reused, and the result is
+// recorded as truncated. Zero means unlimited, which is the default.
+func MaxBody(n int64) func(*Attacker) {
+	return func(a *Attacker) { a.maxBody = n }
+}
+
+// Decompress returns an option which enables or disables the decoding of
+// gzip and deflate compressed response bodies. It is enabled by default,
+// with the decoded bytes of compressed bodies counted as received and their
+// bytes on the wire recorded as well. When disabled, the bytes on the wire
+// are counted as received. Compression is requested either way, unless the
+// requests set their own Accept-Encoding header.
+func Decompress(enabled bool) func(*Attacker) {
+	return func(a *Attacker) { a.decode = enabled }
+}
+
+// WebSocket returns an option which turns every request into the handshake
+// of a WebSocket upgrade, e.g. to smoke test that an endpoint accepts them
+// under load, and closes the connection once upgraded. Upgrades which
+// switch protocols with the right Sec-WebSocket-Accept are successful, and
+// the others are recorded with an error of the handshake category. The ws
+// and wss schemes of the targets are sent as http and https. It is
+// disabled by default.
+func WebSocket(enabled bool) func(*Attacker) {
+	return func(a *Attacker) { a.websocket = enabled }
+}
+
+// Pipeline returns an option which pipelines the requests of idempotent
+// methods, e.g. GET, over HTTP/1.1 connections, writing up to depth of them
+// on each connection before their responses are read, in order, to test
+// the pipelining of servers. Their timings include waiting for the
+// responses ahead of theirs. Requests through a proxy or without
+// keep-alives aren't pipelined. Pipelined connections are closed once idle
+// for the IdleConnTimeout of the transport, if any, and once the attack
+// stops. Less than two disables pipelining, which is the default.
+func Pipeline(depth int) func(*Attacker) {
+	return func(a *Attacker) {
+		a.client.Transport = a.transport
+		if depth > 1 {
+			a.client.Transport = newPipeline(depth, a.transport)
+		}
+	}
+}
+
+// HTTP2 returns an option which enables HTTP/2 for TLS targets which
+// support it, multiplexing concurrent requests over fewer connections.
+// It is disabled by default, with every request using HTTP/1.1.
+// The protocol of each response is recorded in its result.
+func HTTP2(enabled bool) func(*Attacker) {
+	return func(a *Attacker) { a.transport.ForceAttemptHTTP2 = enabled }
+}
+
+// TLSConfig returns an option which sets the TLS configuration of the
+// requests, e.g. to skip certificate verification, trust a custom CA or
+// present a client certificate. Certificates are verified by default.
+func TLSConfig(c *tls.Config) func(*Attacker) {
+	return func(a *Attacker) { a.transport.TLSClientConfig = c }
+}
+
+// Redirects returns an option which sets the maximum number of redirects
+// followed by each request. Requests exceeding it are recorded with an error.
+// NoFollow records redirect responses without following them.
+func Redirects(n int) func(*Attacker) {
+	return func(a *Attacker) { a.redirects = n }
+}
+
+// Warmup returns an option which excludes the results of the requests sent
+// in the first lead and the last trail of an attack from its Metrics and
+// Reporter, e.g. to keep cold start latencies out of the percentiles. The
+// excluded results are only counted in Metrics.Warmup. Zero excludes
+// nothing, which is the default.
+func Warmup(lead, trail time.Duration) func(*Attacker) {
+	return func(a *Attacker) { a.warmup, a.cooldown = lead, trail }
+}
+
+// FollowRateLimits returns an option which holds back the hits of an
+// attack while its responses signal rate limiting, with a Retry-After header
+// or an X-RateLimit-Remaining of 0 until its X-RateLimit-Reset, postponing
+// the following hits by as long. The time they were held back for is
+// recorded in Metrics.BackedOff. It is disabled by default.
+func FollowRateLimits(enabled bool) func(*Attacker) {
+	return func(a *Attacker) { a.limits = enabled }
+}
+
+// CaptureHeaders returns an option which records the values of the named
+// response headers, e.g. Age, Cache-Control or X-Cache, of every nth
+// response in its result, which are tallied in the Metrics. Responses are
+// counted as they come back, independently of Sample. Less than two
+// captures them from every response. No names capture nothing, which is
+// the default, so results don't grow.
+func CaptureHeaders(n uint64, names ...string) func(*Attacker) {
+	return func(a *Attacker) {
+		a.captures = make([]string, 0, len(names))
+		for _, name := range names {
+			a.captures = append(a.captures, http.CanonicalHeaderKey(name))
+		}
+		a.every = n
+	}
+}
+
+// Sample returns an option which adds only every nth result of an attack
+// to its Reporter if it details every result, e.g. to bound the memory of
+// the csv or timings plot reporters at high rates. Reporters which
+// aggregate the results, e.g. text or json, and the Metrics of the attack
+// still get all of them. Less than two adds every result, which is the
+// default.
+func Sample(n uint64) func(*Attacker) {
+	return func(a *Attacker) { a.sample = n }
+}
+
+// Percentiles returns an option which sets the method of the latency
+// percentiles of the Metrics of attacks and of their progress lines.
+// It is NearestRank by default.
+func Percentiles(method PercentileMethod) func(*Attacker) {
+	return func(a *Attacker) { a.pctiles = method }
+}
+
+// HistogramDigits returns an option which sets the significant digits,
+// between 1 and 5, of the histograms the latencies of the Metrics of attacks
+// are recorded in. More digits are more accurate at the cost of memory.
+// It is 3 by default, which bounds the error of the percentiles to 1%.
+func HistogramDigits(digits int) func(*Attacker) {
+	return func(a *Attacker) { a.digits = digits }
+}
+
+// UnixSocket returns an option which connects every request to the Unix
+// domain socket at path instead of the host of its URL, which still sets
+// its Host header. Empty means connecting over TCP, which is the default.
+func UnixSocket(path string) func(*Attacker) {
+	return func(a *Attacker) {
+		a.transport.DialContext = a.dial
+		if path != "" {
+			a.transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				d := *a.dialer // Unix domain sockets are bound to no local IP address
+				d.LocalAddr = nil
+				return d.DialContext(ctx, "unix", path)
+			}
+		}
+	}
+}
+
+// LocalAddr returns an option which binds the connections of the requests
+// to the local IP address ip, e.g. to pin them to a network interface of a
+// multi-homed machine. It doesn't apply to Unix domain sockets. Nil means
+// any address, which is the default.
+func LocalAddr(ip net.IP) func(*Attacker) {
+	return func(a *Attacker) {
+		a.dialer.LocalAddr = nil
+		if ip != nil {
+			a.dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+	}
+}
+
+// Resolver returns an option which resolves the hosts of the targets with
+// the DNS server at addr, on port 53 unless it has one, e.g. to attack a
+// staging deployment by the names of production. Empty means the resolver
+// of the system, which is the default.
+func Resolver(addr string) func(*Attacker) {
+	return func(a *Attacker) {
+		a.dialer.Resolver = nil
+		if addr != "" {
+			a.dialer.Resolver = newResolver(addr)
+		}
+	}
+}
+
+// PinDNS returns an option which resolves the host of each target only
+// once, by the first connection to it, and connects to its first address
+// from then on, so lookups don't skew the latencies of long attacks. By
+// default, each new connection resolves its host, picking up DNS changes.
+// The resolution time of each request is recorded in its DNS phase.
+func PinDNS(enabled bool) func(*Attacker) {
+	return func(a *Attacker) {
+		a.pinned = nil
+		if enabled {
+			a.pinned = newPinnedHosts()
+		}
+	}
+}
+
+// dial connects to addr over network with the dialer, resolving its host
+// only once when the hosts are pinned
+func (a *Attacker) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if a.pinned != nil {
+		return a.pinned.dial(ctx, a.dialer, network, addr)
+	}
+	return a.dialer.DialContext(ctx, network, addr)
+}
+
+// Proxy returns an option which routes every request through the proxy at
+// u. By default, and when u is nil, requests are routed through the proxy
+// of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, if any.
+// Whether each request went through a proxy is recorded in its result.
+func Proxy(u *url.URL) func(*Attacker) {
+	return func(a *Attacker) { a.proxyURL = u }
+}
+
+// proxy returns the URL of the proxy of req and flags its hit as proxied
+func (a *Attacker) proxy(req *http.Request) (*url.URL, error) {
+	u, err := a.proxyURL, error(nil)
+	if u == nil {
+		u, err = http.ProxyFromEnvironment(req)
+	}
+	if proxied, ok := req.Context().Value(proxiedKey{}).(*bool); ok && u != nil {
+		*proxied = true
+	}
+	return u, err
+}
+
+// Cookies returns an option which enables or disables a cookie jar of the
+// Attacker, so the cookies set by the responses to its earlier requests are
+// sent with the later ones to the same host, e.g. to keep a login session.
+// Every option enabling it starts an empty jar, which isn't shared with
+// other Attackers. It is disabled by default.
+func Cookies(enabled bool) func(*Attacker) {
+	return func(a *Attacker) {
+		a.client.Jar = nil
+		if enabled {
+			a.client.Jar, _ = cookiejar.New(nil) // Never fails without options
+		}
+	}
+}
+
+// Validate returns an option which checks every response against v,
+// recording the responses failing it with a validation error. Nothing is
+// validated by default.
+func Validate(v Validator) func(*Attacker) {
+	return func(a *Attacker) { a.validator = &v }
+}
+
+// OKCodes returns an option which sets the status codes of the successful
+// responses, instead of the 2xx ones, e.g. when a 404 is the expected
+// outcome. Responses with any other status code aren't successful, and
+// those with one of them aren't errors. No codes restores the default.
+func OKCodes(codes ...uint64) func(*Attacker) {
+	return func(a *Attacker) {
+		a.okCodes = nil
+		if len(codes) > 0 {
+			a.okCodes = make(map[uint64]bool, len(codes))
+			for _, code := range codes {
+				a.okCodes[code] = true
+			}
+		}
+	}
+}
+
+// ByteRate returns an option which caps the outbound throughput of the
+// attack at n bytes per second, on top of its rate of requests, pacing each
+// hit by the bytes of the bodies of the targets sent before it. Bodies set
+// by RequestModifiers aren't accounted for. Zero means no cap, which is the
+// default.
+func ByteRate(n uint64) func(*Attacker) {
+	return func(a *Attacker) { a.byteRate = n }
+}
+
+// Poisson returns an option which paces the hits of an attack as a Poisson
+// process at its rate, i.e. with random intervals between them drawn from
+// an exponential distribution, instead of constant ones, to model traffic
+// of independent clients. The intervals are drawn from the randomness of
+// the Attacker, so they're reproducible with Rand. Ramps are unaffected.
+func Poisson(enabled bool) func(*Attacker) {
+	return func(a *Attacker) { a.poisson = enabled }
+}
+
+// Abort returns an option which aborts attacks once the ratio of the
+// requests with errors over a sliding window of time exceeds ratio, e.g. to
+// stop hammering a service which is clearly down. Only full windows are
+// judged. The reason of an abort is recorded in the Metrics of the attack.
+// Zero ratio never aborts, which is the default.
+func Abort(ratio float64, window time.Duration) func(*Attacker) {
+	return func(a *Attacker) { a.abortAt, a.abortOver = ratio, window }
+}
+
+// Progress returns an option which writes a line with the number of
+// requests, the success ratio and the 99th percentile of the latencies of
+// the most recent requests to w every interval while an attack runs.
+// Zero interval writes nothing, which is the default.
+func Progress(w io.Writer, interval time.Duration) func(*Attacker) {
+	return func(a *Attacker) { a.progress, a.interval = w, interval }
+}
+
+// WithClock returns an option which sets the Clock the Attacker paces and
+// times its hits by, e.g. a fake one in tests. It is SystemClock by default.
+func WithClock(c Clock) func(*Attacker) {
+	return func(a *Attacker) { a.clock = c }
+}
+
+// Rand returns an option which sets the source of the randomness of the
+// Attacker, e.g. of the jitter of retries, to r. See NewRand.
+func Rand(r *rand.Rand) func(*Attacker) {
+	return func(a *Attacker) { a.rand = r }
+}
+
+// Retry returns an option which retries the failed hits of idempotent
+// requests according to p. The attempts of each request are recorded in
+// its result, whose timing spans all of them. No hit is retried by default.
+func Retry(p RetryPolicy) func(*Attacker) {
+	return func(a *Attacker) { a.retry = p }
+}
+
+// do sends req, retrying it according to the RetryPolicy of the Attacker,
+// and counts its attempts in result
+func (a *Attacker) do(req *http.Request, result *result) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		result.attempts = uint64(attempt)
+		r, err := a.client.Do(req)
+		if !a.retry.retry(req, r, err, attempt) {
+			return r, err
+		}
+		if err == nil {
+			io.Copy(ioutil.Discard, r.Body)
+			r.Body.Close()
+		}
+		select {
+		case <-a.clock.After(a.retry.backoff(attempt, a.rand)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// checkRedirect enforces the redirects policy of the Attacker and counts
+// the redirects followed by each hit
+func (a *Attacker) checkRedirect(req *http.Request, via []*http.Request) error {
+	if a.redirects == NoFollow {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > a.redirects {
+		return fmt.Errorf("stopped after %d redirects", a.redirects)
+	}
+	if hops, ok := req.Context().Value(redirectsKey{}).(*uint64); ok {
+		*hops = uint64(len(via))
+	}
+	return nil
+}
+
+// Attack hits the passed Targets (http.Requests) with the DefaultAttacker.
+// See Attacker.Attack.
+func Attack(targets Targets, rate uint64, duration time.Duration, rep Reporter) (*Metrics, error) {
+	return DefaultAttacker.Attack(targets, rate, duration, rep)
+}
+
+// AttackContext hits the passed Targets (http.Requests) with the
+// DefaultAttacker until ctx is done. See Attacker.AttackContext.
+func AttackContext(ctx context.Context, targets Targets, rate uint64, duration time.Duration, rep Reporter) (*Metrics, error) {
+	return DefaultAttacker.AttackContext(ctx, targets, rate, duration, rep)
+}
+
 // Attack hits the passed Targets (http.Requests) at the rate specified for
 // duration time and then waits for all the requests to come back.
-// The results of the attack are put into the rep Reporter.
-func Attack(targets Targets, rate uint64, duration time.Duration, rep Reporter) {
-	hits := make(chan *http.Request, rate*uint64((duration).Seconds()))
-	defer close(hits)
-	responses := make(chan *result, cap(hits))
-	defer close(responses)
-	go drill(rate, hits, responses) // Attack!
-	for i := 0; i < cap(hits); i++ {
-		hits <- targets[i%len(targets)]
+// The results of the attack are put into the rep Reporter and their
+// aggregated Metrics are returned.
+// Results are streamed to rep as they arrive and aren't retained otherwise.
+// The first failure of rep to add a result is returned along with the
+// Metrics of the whole attack, and rep isn't added any more results.
+func (a *Attacker) Attack(targets Targets, rate uint64, duration time.Duration, rep Reporter) (*Metrics, error) {
+	return a.AttackContext(context.Background(), targets, rate, duration, rep)
+}
+
+// AttackContext is like Attack but stops hitting the Targets early once ctx
+// is done. Requests in flight are allowed to finish and the results
+// collected until then are returned, without an error.
+func (a *Attacker) AttackContext(ctx context.Context, targets Targets, rate uint64, duration time.Duration, rep Reporter) (*Metrics, error) {
+	return a.AttackTargeter(ctx, targets.Targeter(), rate, duration, rep)
+}
+
+// AttackTargeter is like AttackContext but hits the targets returned by tr,
+// in order, until it fails with io.EOF, e.g. to attack targets streamed by
+// NewLazyTargeter. Other failures of tr are recorded as the errors of
+// results.
+func (a *Attacker) AttackTargeter(ctx context.Context, tr Targeter, rate uint64, duration time.Duration, rep Reporter) (*Metrics, error) {
+	w, began := window{}, a.clock.Now()
+	if a.warmup > 0 {
+		w.from = began.Add(a.warmup)
+	}
+	if a.cooldown > 0 {
+		w.to = began.Add(duration - a.cooldown)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var t *throttle
+	if a.limits {
+		t = &throttle{}
+	}
+	results := a.attack(ctx, tr, rate, duration, t)
+	if t != nil {
+		results = t.watch(results)
 	}
-	// Wait for all requests to finish
-	for i := 0; i < cap(responses); i++ {
-		rep.add(<-responses)
+	var b *breaker
+	if a.abortAt > 0 {
+		b = newBreaker(a.abortAt, a.abortOver)
+		results = b.watch(results, cancel)
 	}
+	if a.interval > 0 {
+		results = newProgress(began, a.pctiles).watch(results, a.progress, a.interval, a.clock)
+	}
+	m, err := collect(results, rep, w, a.sample, a.pctiles, a.digits)
+	if p, ok := a.client.Transport.(*pipeline); ok {
+		p.CloseIdleConnections() // Which outlive the attack otherwise
+	}
+	if b != nil {
+		m.Aborted = b.reason
+	}
+	if t != nil {
+		m.BackedOff = t.backedOff()
+	}
+	return m, err
+}
+
+// window is the span of time from which results are collected.
+// A zero bound leaves its side open.
+type window struct{ from, to time.Time }
+
+// contains returns whether t falls within the window
+func (w window) contains(t time.Time) bool {
+	return (w.from.IsZero() || !t.Before(w.from)) && (w.to.IsZero() || t.Before(w.to))
+}
+
+// collect adds each result of the passed channel timestamped within w to
+// rep as it arrives, or every nth of them if n is at least two and rep
+// details every result, and returns
+// the aggregated Metrics of all of them once the channel is closed, with the
+// percentiles of method out of histograms of digits significant digits, see
+// newStreamingAggregator, and the first error of rep. Results outside w are
+// only counted as warmup. Reporters which are Flushers are flushed at the end.
+func collect(results <-chan *result, rep Reporter, w window, n uint64, method PercentileMethod, digits int) (*Metrics, error) {
+	agg := newStreamingAggregator(digits)
+	var err error
+	warmup, sampled := uint64(0), uint64(0)
+	if _, ok := rep.(detailedReporter); !ok {
+		n = 0
+	}
+	for res := range results {
+		if !w.contains(res.timestamp) {
+			warmup++
+			continue
+		}
+		if err == nil && (n < 2 || agg.m.Requests%n == 0) {
+			err = rep.add(res)
+			sampled++
+		}
+		agg.add(res)
+	}
+	if f, ok := rep.(Flusher); ok {
+		if ferr := f.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	m := agg.metrics(method)
+	m.Warmup = warmup
+	if n > 1 {
+		m.Sampled = sampled
+	}
+	return m, err
+}
+
+// pacer returns the pacer of an attack at rate for duration
+func (a *Attacker) pacer(rate uint64, duration time.Duration) pacer {
+	if a.rampTo > 0 {
+		return rampPacer{from: rate, to: a.rampTo, duration: duration}
+	}
+	if a.poisson {
+		return &poissonPacer{rate: rate, rnd: rand.New(rand.NewSource(a.rand.Int63()))}
+	}
+	return constantPacer{rate}
+}
+
+// attack hits the targets of tr at the rate specified for duration time,
+// or until ctx is done or tr is exhausted, each in its own goroutine, and
+// returns the channel of their results which is closed once all the
+// requests came back.
+// Hits are paced against the start of the attack rather than the previous
+// hit, so the actual rate doesn't drift from the specified one. Waits for tr
+// to return a target, or of t if not nil, postpone the following hits
+// instead, so they never exceed the rate.
+func (a *Attacker) attack(ctx context.Context, tr Targeter, rate uint64, duration time.Duration, t *throttle) <-chan *result {
+	results := make(chan *result)
+	go func() {
+		defer close(results)
+		var wg sync.WaitGroup
+		var jobs chan job
+		if a.workers > 0 {
+			jobs = make(chan job)
+			for i := uint64(0); i < a.workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := range jobs {
+						res := a.hit(j.req)
+						res.delayed = j.delayed
+						results <- res
+					}
+				}()
+			}
+		}
+
+		p, began := a.pacer(rate, duration), a.clock.Now()
+		sent := uint64(0) // Bytes of the bodies of the hits so far
+	loop:
+		for i := uint64(0); ctx.Err() == nil && (a.requests == 0 || i < a.requests); i++ {
+			offset := p.offset(i)
+			if a.byteRate > 0 {
+				if d := time.Duration(float64(sent) / float64(a.byteRate) * float64(time.Second)); d > offset {
+					offset = d
+				}
+			}
+			if offset >= duration {
+				break
+			}
+			fetched := a.clock.Now()
+			req, err := tr(ctx)
+			if err == io.EOF || ctx.Err() != nil {
+				break
+			} else if err != nil {
+				results <- &result{timestamp: a.clock.Now(), err: err}
+				continue
+			}
+			now := a.clock.Now()
+			if late := now.Sub(began.Add(offset)); late > 0 && now.Sub(fetched) >= late {
+				began = began.Add(late)
+			}
+			if wait := began.Add(offset).Sub(now); wait > 0 {
+				select {
+				case <-a.clock.After(wait):
+				case <-ctx.Done():
+					break loop
+				}
+			}
+			if t != nil {
+				if d := t.backoff(a.clock.Now()); d > 0 {
+					select {
+					case <-a.clock.After(d):
+					case <-ctx.Done():
+						break loop
+					}
+					began = began.Add(d) // Postpones the following hits as well
+				}
+			}
+			if req.ContentLength > 0 {
+				sent += uint64(req.ContentLength)
+			}
+			if jobs == nil {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results <- a.hit(req)
+				}()
+				continue
+			}
+			select {
+			case jobs <- job{req: req}:
+			default: // All workers are busy
+				select {
+				case jobs <- job{req: req, delayed: true}:
+				case <-ctx.Done():
+					break loop
+				}
+			}
+		}
+		if jobs != nil {
+			close(jobs)
+		}
+		wg.Wait()
+	}()
+	return results
+}
+
+// job is a hit to be executed by a worker
+type job struct {
+	req     *http.Request
+	delayed bool // Whether the hit waited for a worker to be available
 }
 
 // result represents the metrics we want out of an http.Response
@@ -30,39 +804,192 @@ type result struct {
 	code      uint64
 	timestamp time.Time
 	timing    time.Duration
+	ttfb      time.Duration // From the start of the request to its first response byte
 	bytesOut  uint64
 	bytesIn   uint64
+	bytesWire uint64 // The bytes of a compressed body on the wire, when decoded
+	redirects uint64
+	reused    bool   // Whether the connection was reused
+	delayed   bool   // Whether the request waited for a worker
+	proto     string // The protocol of the response, e.g. HTTP/2.0
+	truncated bool   // Whether the body exceeded the maximum read
+	proxied   bool   // Whether the request went through a proxy
+	attempts  uint64 // The number of attempts of the request
+	url       string // The URL of the request
+	host      string // The host of the URL of the request
+	outcome   outcome
+	phases    phases // The timings of the phases of the request
+	body      []byte // The captured start of the response body
+	headers   http.Header
 	err       error
+	limited   time.Time // Until when the response asked to be left alone
 }
 
-// drill loops over the passed reqs channel and executes each request.
-// It is throttled to the rate specified.
-func drill(rate uint64, reqs chan *http.Request, res chan *result) {
-	throttle := time.Tick(time.Duration(1e9 / rate))
-	for req := range reqs {
-		<-throttle
-		go hit(req, res)
+// captureHeaders returns the values of the named headers of h which it has
+func captureHeaders(h http.Header, names []string) http.Header {
+	captured := http.Header{}
+	for _, name := range names {
+		if values := h.Values(name); len(values) > 0 {
+			captured[name] = values
+		}
 	}
+	return captured
 }
 
-// hit executes the passed http.Request and puts a generated *result into res.
-// Both transport errors and unsucessfull requests (non {2xx,3xx}) are
-// considered errors which are set in the Response.
-func hit(req *http.Request, res chan *result) {
-	began := time.Now()
-	r, err := http.DefaultClient.Do(req)
-	result := &result{
-		timestamp: began,
-		timing:    time.Since(began),
-		bytesOut:  uint64(req.ContentLength),
-		err:       err,
+// hit executes the passed http.Request and returns its generated *result.
+// Both transport errors and failed requests (4xx and 5xx) are considered
+// errors which are set in the Response.
+// The timing of the result includes reading the response body, unlike its
+// time to first byte.
+func (a *Attacker) hit(req *http.Request) *result {
+	result := &result{}
+	if a.errLen > 0 {
+		defer func() { result.err = truncateError(result.err, a.errLen) }()
+	}
+	ctx := context.WithValue(req.Context(), redirectsKey{}, &result.redirects)
+	ctx = context.WithValue(ctx, proxiedKey{}, &result.proxied)
+	tr := newTracer(a.clock)
+	ctx = httptrace.WithClientTrace(ctx, tr.clientTrace())
+	timeout := a.timeout
+	if d, ok := req.Context().Value(timeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// Targets are shared between concurrent hits, so they're never modified
+	// and each hit reads a fresh copy of the body
+	req = req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			result.timestamp, result.err = a.clock.Now(), err
+			return result
+		}
+		req.Body = body
+	}
+	for key, values := range a.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	for _, m := range a.modifiers {
+		if err := m.Modify(req); err != nil {
+			result.timestamp, result.err = a.clock.Now(), err
+			return result
+		}
+	}
+
+	if a.host != "" {
+		req.Host = a.host
+	}
+	if a.auth != nil {
+		password, _ := a.auth.Password()
+		req.SetBasicAuth(a.auth.Username(), password)
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	if a.websocket {
+		upgradeRequest(req)
+	}
+
+	// Bodies of unknown length, e.g. streamed, are counted as they're sent
+	var sent *countingReader
+	if req.ContentLength <= 0 && req.Body != nil && req.Body != http.NoBody {
+		sent = &countingReader{r: req.Body}
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{sent, req.Body}
 	}
+
+	result.url, result.host = req.URL.String(), req.URL.Host
+	began := a.clock.Now()
+	r, err := a.do(req, result)
+	result.timestamp, result.bytesOut, result.err = began, uint64(req.ContentLength), err
 	if err == nil {
-		result.bytesIn, result.code = uint64(r.ContentLength), uint64(r.StatusCode)
-		if body, err := ioutil.ReadAll(r.Body); err != nil && (result.code < 200 || result.code >= 300) {
+		defer r.Body.Close()
+		result.bytesIn, result.code, result.proto = uint64(r.ContentLength), uint64(r.StatusCode), r.Proto
+		if req.Method == "HEAD" {
+			// The response has no body, only the Content-Length of a GET's
+			result.bytesIn = 0
+		}
+		if a.limits {
+			result.limited = rateLimited(r.Header, a.clock.Now())
+		}
+		if n := atomic.AddUint64(&a.hits, 1); len(a.captures) > 0 && (a.every < 2 || n%a.every == 1) {
+			result.headers = captureHeaders(r.Header, a.captures)
+		}
+		if a.okCodes != nil {
+			result.outcome = notOKCode
+			if a.okCodes[result.code] {
+				result.outcome = okCode
+			}
+		}
+		var upgrade error // The failure of a WebSocket handshake
+		if a.websocket {
+			r.Body.Close() // Only the handshake is timed, not the messages
+			r.Body, r.ContentLength, result.bytesIn = http.NoBody, 0, 0
+			if upgrade = checkUpgrade(req, r); upgrade == nil {
+				result.outcome = okCode
+			} else {
+				result.outcome = notOKCode
+			}
+		}
+		wire := &countingReader{r: r.Body}
+		var rd io.Reader = wire
+		encoding := r.Header.Get("Content-Encoding")
+		decoded := a.decode && decodes(encoding) && r.ContentLength != 0 && req.Method != "HEAD"
+		if decoded {
+			rd = &decodingReader{r: wire, encoding: encoding}
+		} else if req.Method == "HEAD" {
+			rd = http.NoBody
+		}
+		if a.maxBody > 0 {
+			rd = io.LimitReader(rd, a.maxBody)
+		}
+		body, err := ioutil.ReadAll(rd)
+		if err != nil {
+			err = &readError{n: int64(len(body)), err: err}
+		} else if a.maxBody > 0 {
+			var rest int64
+			result.bytesIn = uint64(len(body))
+			if rest, err = io.Copy(ioutil.Discard, wire); err != nil {
+				err = &readError{n: int64(len(body)) + rest, err: err}
+			}
+			result.truncated = rest > 0
+		}
+		if decoded {
+			result.bytesIn, result.bytesWire = uint64(len(body)), uint64(wire.n)
+		} else if r.ContentLength < 0 && a.maxBody == 0 {
+			result.bytesIn = uint64(wire.n) // Unknown in advance, e.g. chunked
+		}
+		if err != nil {
+			result.err = err
+		} else if upgrade != nil {
+			result.err = upgrade
+		} else if result.code >= 400 && result.outcome != okCode {
 			result.err = errors.New(string(body))
+		} else if a.validator != nil {
+			result.err = a.validator.validate(result.code, body)
+		}
+		if a.bodyBytes > 0 {
+			if len(body) > a.bodyBytes {
+				body = body[:a.bodyBytes]
+			}
+			result.body = append([]byte{}, body...)
 		}
 	}
+	if sent != nil {
+		result.bytesOut = uint64(atomic.LoadInt64(&sent.n))
+	}
+	end := a.clock.Now()
+	result.timing = end.Sub(began)
+	result.phases, result.reused = tr.done(end)
+	result.ttfb = tr.ttfb(began, end)
 
-	res <- result
+	return result
 }
@@ -1,9 +1,24 @@
 package vegeta
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -25,3 +40,999 @@ func TestAttackRate(t *testing.T) {
 		t.Fatalf("Wrong number of hits: want %d, got %d\n", rate, hits)
 	}
 }
+
+func TestAttackTimeout(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}),
+	)
+	defer server.Close()
+
+	timeout := 50 * time.Millisecond
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	r := NewAttacker(Timeout(timeout)).hit(request)
+	if category := errorCategory(r.err); category != errTimeout {
+		t.Fatalf("Wrong error: want a timeout, got %v", r.err)
+	}
+	if r.timing < timeout || r.timing > 4*timeout {
+		t.Fatalf("Wrong timing: want about %s, got %s", timeout, r.timing)
+	}
+}
+
+func TestAttackTargetTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	targets, err := NewTargets([]string{"10ms GET " + server.URL + "/tight", "GET " + server.URL + "/default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := NewResultsReporter()
+	if _, err := NewAttacker(Timeout(time.Second)).Attack(targets, 20, 200*time.Millisecond, rep); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rep.responses {
+		timedOut := errorCategory(r.err) == errTimeout
+		if tight := strings.HasSuffix(r.url, "/tight"); timedOut != tight {
+			t.Errorf("Wrong outcome of %s: want timeout %t, got %v", r.url, tight, r.err)
+		}
+	}
+}
+
+func TestAttackHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- r.Header
+		}),
+	)
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Add("X-Forwarded-For", "10.0.0.1")
+	header.Add("X-Forwarded-For", "10.0.0.2")
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	request.Header.Set("Authorization", "Bearer token")
+	NewAttacker(Headers(header)).hit(request)
+
+	got := <-received
+	if ct := got.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Wrong Content-Type: want application/json, got %s", ct)
+	}
+	if want, xff := []string{"10.0.0.1", "10.0.0.2"}, got["X-Forwarded-For"]; !reflect.DeepEqual(xff, want) {
+		t.Errorf("Wrong X-Forwarded-For: want %v, got %v", want, xff)
+	}
+	if auth := got.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("Target header was lost: got %s", auth)
+	}
+	if len(request.Header) != 1 {
+		t.Errorf("Target was modified: %v", request.Header)
+	}
+}
+
+func TestAttackBasicAuth(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("X-Account-ID", "8675309")
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	NewAttacker(Headers(header), BasicAuth("goku", "kame:hame")).hit(request)
+
+	got := <-received
+	if want, auth := "Basic Z29rdTprYW1lOmhhbWU=", got.Get("Authorization"); auth != want {
+		t.Errorf("Wrong Authorization: want %s, got %s", want, auth)
+	}
+	if id := got.Get("X-Account-ID"); id != "8675309" {
+		t.Errorf("Custom header was clobbered: got %q", id)
+	}
+}
+
+func TestAttackCaptureHeaders(t *testing.T) {
+	var hits uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint64(&hits, 1) <= 4 {
+			w.Header().Set("X-Cache", "HIT")
+		} else {
+			w.Header().Set("X-Cache", "MISS")
+		}
+		w.Header().Set("Age", "42")
+	}))
+	defer server.Close()
+
+	targets, _ := NewTargets([]string{"GET " + server.URL})
+	a := NewAttacker(Workers(1), MaxRequests(6), CaptureHeaders(2, "x-cache", "X-Missing"))
+	rep := NewTextReporter()
+	m, err := a.AttackTargeter(context.Background(), targets.Targeter(), 100, time.Second, rep)
+	if err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	// Every other response of HIT, HIT, HIT, HIT, MISS, MISS
+	want := map[string]map[string]uint64{"X-Cache": {"HIT": 2, "MISS": 1}}
+	if !reflect.DeepEqual(m.Headers, want) {
+		t.Fatalf("Wrong captured headers: want %v, got %v", want, m.Headers)
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "Headers:\nX-Cache: HIT\t2\nX-Cache: MISS\t1\n") {
+		t.Errorf("Captured headers weren't reported:\n%s", out)
+	}
+}
+
+func TestAttackTruncateErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(bytes.Repeat([]byte("enormous stack trace "), 1000))
+	}))
+	defer server.Close()
+
+	targets, _ := NewTargets([]string{"GET " + server.URL})
+	rep := NewTextReporter()
+	a := NewAttacker(TruncateErrors(64), MaxRequests(3))
+	if _, err := a.AttackTargeter(context.Background(), targets.Targeter(), 100, time.Second, rep); err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	section := out.String()[strings.Index(out.String(), "Error Set:"):]
+	lines := strings.Split(strings.TrimSpace(section), "\n")[1:]
+	if len(lines) != 1 {
+		t.Fatalf("Wrong error set: %q", lines)
+	}
+	err := strings.SplitN(lines[0], "\t", 2)[1]
+	if n := len([]rune(err)); n != 64 || !strings.HasPrefix(err, "enormous stack trace") || !strings.HasSuffix(err, "…") {
+		t.Fatalf("Error wasn't truncated to 64 characters: got %d in %q", n, err)
+	}
+	if !strings.HasPrefix(lines[0], "3\t") {
+		t.Errorf("Truncated errors weren't counted together: %q", lines[0])
+	}
+}
+
+func TestAttackHost(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Host
+	}))
+	defer server.Close()
+
+	if !strings.HasPrefix(server.URL, "http://127.0.0.1:") {
+		t.Fatalf("Server isn't listening on 127.0.0.1: %s", server.URL)
+	}
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	if r := NewAttacker(Host("example.com")).hit(request); r.err != nil {
+		t.Fatalf("Hit failed: %s", r.err)
+	}
+	if host := <-received; host != "example.com" {
+		t.Fatalf("Wrong Host: want example.com, got %s", host)
+	}
+	if request.Host == "example.com" {
+		t.Fatal("Target was modified")
+	}
+}
+
+func TestAttackRoundRobin(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[r.URL.Path]++
+			mu.Unlock()
+		}),
+	)
+	defer server.Close()
+
+	source := bytes.NewBufferString(strings.Replace("GET URL/a\nGET URL/b\n# GET URL/c\nGET URL/d\n", "URL", server.URL, -1))
+	targets, err := readTargets(source)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+	Attack(targets, 30, time.Second, NewTextReporter())
+
+	if want := map[string]int{"/a": 10, "/b": 10, "/d": 10}; !reflect.DeepEqual(hits, want) {
+		t.Fatalf("Wrong hits per target: want %v, got %v", want, hits)
+	}
+}
+
+func TestAttackKeepGoing(t *testing.T) {
+	var hits uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint64(&hits, 1)
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(strings.Replace("GET URL/a\nGET\nX-Orphan: true\nGET URL/b\n", "URL", server.URL, -1))
+	file.Close()
+
+	skipped := []string{}
+	targets, err := NewTargetsFromFileKeepGoing(file.Name(), func(err error) { skipped = append(skipped, err.Error()) })
+	if err != nil {
+		t.Fatalf("Malformed line wasn't skipped: %s", err)
+	}
+	if want := []string{"Line 2: Invalid request format: `GET`"}; !reflect.DeepEqual(skipped, want) {
+		t.Fatalf("Wrong skipped lines: want %q, got %q", want, skipped)
+	}
+	if len(targets) != 2 || targets[0].Header.Get("X-Orphan") != "" {
+		t.Fatalf("Header of the skipped line was added to the previous target: %+v", targets)
+	}
+	a := NewAttacker(MaxRequests(uint64(len(targets))))
+	m, err := a.AttackTargeter(context.Background(), targets.Targeter(), 100, time.Second, NewTextReporter())
+	if err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	if n := atomic.LoadUint64(&hits); n != 2 || m.Requests != 2 {
+		t.Fatalf("Wrong requests: want 2, got %d hits of %d requests", n, m.Requests)
+	}
+}
+
+func TestAttackBody(t *testing.T) {
+	body := `{"dragon": "balls"}`
+	received := make(chan string, 2)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := ioutil.ReadAll(r.Body)
+			received <- string(data)
+		}),
+	)
+	defer server.Close()
+
+	targets, err := NewTargets([]string{"POST " + server.URL + " " + body})
+	if err != nil {
+		t.Fatalf("Couldn't parse valid target: %s", err)
+	}
+	a := NewAttacker()
+	for i := 0; i < 2; i++ { // The body must be sent again on each hit
+		r := a.hit(targets[0])
+		if got := <-received; got != body {
+			t.Fatalf("Wrong body received: want %s, got %s", body, got)
+		}
+		if r.bytesOut != uint64(len(body)) {
+			t.Fatalf("Wrong bytes out: want %d, got %d", len(body), r.bytesOut)
+		}
+	}
+}
+
+func TestAttackRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusFound))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusMovedPermanently))
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/a", nil)
+
+	if r := NewAttacker().hit(request); r.err != nil || r.code != 200 || r.redirects != 2 {
+		t.Errorf("Wrong followed redirects: want 200 after 2, got %d after %d (%v)", r.code, r.redirects, r.err)
+	}
+
+	if r := NewAttacker(Redirects(NoFollow)).hit(request); r.err != nil || r.code != 302 || r.redirects != 0 {
+		t.Errorf("Wrong unfollowed redirect: want 302 after 0, got %d after %d (%v)", r.code, r.redirects, r.err)
+	}
+
+	if r := NewAttacker(Redirects(1)).hit(request); r.err == nil {
+		t.Errorf("Exceeding redirects didn't fail: got %d after %d", r.code, r.redirects)
+	}
+}
+
+func TestAttackPacing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	rate, duration := uint64(200), time.Second
+	began := time.Now()
+	first, last, count := time.Time{}, time.Time{}, uint64(0)
+	for res := range NewAttacker().attack(context.Background(), Targets{request}.Targeter(), rate, duration, nil) {
+		if first.IsZero() || res.timestamp.Before(first) {
+			first = res.timestamp
+		}
+		if res.timestamp.After(last) {
+			last = res.timestamp
+		}
+		count++
+	}
+
+	if want := rate * uint64(duration.Seconds()); count != want {
+		t.Fatalf("Wrong number of hits: want %d, got %d", want, count)
+	}
+	// The last hit is due one interval before the end of the duration
+	want := duration - duration/time.Duration(rate)
+	if span := last.Sub(first); span < want-25*time.Millisecond || span > want+25*time.Millisecond {
+		t.Fatalf("Hits drifted: want them spread over %s, got %s", want, span)
+	}
+	if first.Sub(began) > 25*time.Millisecond {
+		t.Fatalf("First hit was late by %s", first.Sub(began))
+	}
+}
+
+func TestAttackPacingClock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	began := time.Unix(1375351200, 0)
+	for name, opts := range map[string]func() []func(*Attacker){
+		"constant": func() []func(*Attacker) { return nil },
+		"ramp":     func() []func(*Attacker) { return []func(*Attacker){Ramp(30)} },
+		"poisson":  func() []func(*Attacker) { return []func(*Attacker){Poisson(true), Rand(NewRand(7))} },
+	} {
+		clock := newFakeClock(began)
+		// Each target is fetched at the time the previous one was sent
+		sent := []time.Duration{}
+		tr := func(context.Context) (*http.Request, error) {
+			sent = append(sent, clock.Now().Sub(began))
+			return request, nil
+		}
+		a := NewAttacker(append(opts(), WithClock(clock))...)
+		want := NewAttacker(opts()...).pacer(10, time.Second)
+		if _, err := a.AttackTargeter(context.Background(), tr, 10, time.Second, NewTextReporter()); err != nil {
+			t.Fatalf("%s: Attack failed: %s", name, err)
+		}
+		if len(sent) < 2 {
+			t.Fatalf("%s: Too few hits: %d", name, len(sent))
+		}
+		for i, got := range sent[1:] {
+			if offset := want.offset(uint64(i)); got != offset {
+				t.Errorf("%s: Wrong time of hit %d: want %s, got %s", name, i, offset, got)
+			}
+		}
+		if last := want.offset(uint64(len(sent) - 1)); last >= time.Second || want.offset(uint64(len(sent))) < time.Second {
+			t.Errorf("%s: Wrong number of hits: %d", name, len(sent))
+		}
+	}
+}
+
+func TestCollectRetainsNothing(t *testing.T) {
+	rep := NewHistogramReporter([]time.Duration{time.Millisecond, time.Second})
+	results := make(chan *result)
+	go func() {
+		defer close(results)
+		for i := 0; i < 10000; i++ {
+			results <- &result{code: 200, timestamp: time.Now(), timing: time.Duration(i) * time.Microsecond}
+		}
+	}()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	m, err := collect(results, rep, window{}, 0, NearestRank, hdrDigits)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		t.Fatalf("Collect failed: %s", err)
+	}
+	if m.Requests != 10000 || rep.counts[0]+rep.counts[1] != 10000 {
+		t.Fatalf("Wrong number of results: want 10000, got %d", m.Requests)
+	}
+	if retained := int64(after.HeapObjects) - int64(before.HeapObjects); retained > 1000 {
+		t.Fatalf("Retained %d objects out of 10000 streamed results", retained)
+	}
+	runtime.KeepAlive(m)
+	runtime.KeepAlive(rep)
+}
+
+// failingWriter fails every write after its first n ones
+type failingWriter struct{ n, writes int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestCollectReporterError(t *testing.T) {
+	results := make(chan *result)
+	go func() {
+		defer close(results)
+		for i := 0; i < 10; i++ {
+			results <- &result{code: 200, timestamp: time.Now()}
+		}
+	}()
+
+	w := &failingWriter{n: 3}
+	m, err := collect(results, NewLiveInfluxReporter(w), window{}, 0, NearestRank, hdrDigits)
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("Reporter error didn't propagate: %v", err)
+	}
+	if w.writes != 4 {
+		t.Fatalf("Results were added after the error: want 4 writes, got %d", w.writes)
+	}
+	if m.Requests != 10 {
+		t.Fatalf("Results after the error weren't aggregated: want 10, got %d", m.Requests)
+	}
+}
+
+func TestAttackTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // Silence handshake errors
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+
+	if r := NewAttacker().hit(request); errorCategory(r.err) != errTLS {
+		t.Errorf("Self-signed certificate was trusted: got %d (%v)", r.code, r.err)
+	}
+
+	if r := NewAttacker(TLSConfig(&tls.Config{InsecureSkipVerify: true})).hit(request); r.err != nil || r.code != 200 {
+		t.Errorf("Skipping verification failed: got %d (%v)", r.code, r.err)
+	}
+}
+
+func TestAttackHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	tlsc := TLSConfig(&tls.Config{InsecureSkipVerify: true})
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	if r := NewAttacker(tlsc, HTTP2(true)).hit(request); r.err != nil || r.proto != "HTTP/2.0" {
+		t.Errorf("Wrong protocol with HTTP/2 enabled: want HTTP/2.0, got %s (%v)", r.proto, r.err)
+	}
+
+	legacy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer legacy.Close()
+	request, _ = http.NewRequest("GET", legacy.URL, nil)
+	if r := NewAttacker(tlsc, HTTP2(false)).hit(request); r.err != nil || r.proto != "HTTP/1.1" {
+		t.Errorf("Wrong protocol with HTTP/2 disabled: want HTTP/1.1, got %s (%v)", r.proto, r.err)
+	}
+}
+
+func TestAttackProxy(t *testing.T) {
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.String())
+	}))
+	defer proxy.Close()
+
+	u, _ := url.Parse(proxy.URL)
+	request, _ := http.NewRequest("GET", "http://vegeta.invalid/target", nil)
+	if r := NewAttacker(Proxy(u)).hit(request); r.err != nil || r.code != 200 || !r.proxied {
+		t.Fatalf("Request wasn't proxied: got %d, proxied %t (%v)", r.code, r.proxied, r.err)
+	}
+	if got, want := proxied.Load(), "http://vegeta.invalid/target"; got != want {
+		t.Fatalf("Wrong proxied request: want %s, got %v", want, got)
+	}
+
+	// Requests to localhost are never proxied from the environment
+	request, _ = http.NewRequest("GET", proxy.URL, nil)
+	if r := NewAttacker().hit(request); r.err != nil || r.proxied {
+		t.Fatalf("Request was proxied without a proxy: %v", r.err)
+	}
+}
+
+func TestAttackCookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t"})
+			return
+		}
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(cookie.Value))
+	}))
+	defer server.Close()
+
+	login, _ := http.NewRequest("GET", server.URL+"/login", nil)
+	request, _ := http.NewRequest("GET", server.URL+"/account", nil)
+
+	a := NewAttacker(Cookies(true), CaptureBodies(64))
+	a.hit(login)
+	if r := a.hit(request); r.code != 200 || string(r.body) != "s3cr3t" {
+		t.Fatalf("Cookie wasn't sent back: got %d %q", r.code, r.body)
+	}
+
+	other := NewAttacker(Cookies(true))
+	if r := other.hit(request); r.code != http.StatusUnauthorized {
+		t.Fatalf("Cookie jar was shared between attackers: got %d", r.code)
+	}
+	if r := NewAttacker().hit(login); r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r := NewAttacker().hit(request); r.code != http.StatusUnauthorized {
+		t.Fatalf("Cookies were kept without a jar: got %d", r.code)
+	}
+}
+
+func TestAttackPartialRead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("0123456789")) // Closes the connection mid body
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	a := NewAttacker()
+	r := a.hit(request)
+	if category := errorCategory(r.err); category != errRead || !strings.Contains(r.err.Error(), "read 10 bytes") {
+		t.Fatalf("Wrong error of a partial read: got %q (%v)", category, r.err)
+	}
+	if r = a.hit(request); r.reused {
+		t.Fatal("Connection of a partial read was reused")
+	}
+}
+
+func TestAttackUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "server.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	server.Listener = ln
+	server.Start()
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", "http://api.internal/", nil)
+	r := NewAttacker(UnixSocket(path), CaptureBodies(64)).hit(request)
+	if r.err != nil || r.code != 200 || r.timing <= 0 {
+		t.Fatalf("Request over the socket failed: got %d in %s (%v)", r.code, r.timing, r.err)
+	}
+	if string(r.body) != "api.internal" {
+		t.Fatalf("Wrong Host header: want api.internal, got %s", r.body)
+	}
+}
+
+func TestAttackLocalAddr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	r := NewAttacker(LocalAddr(net.ParseIP("127.0.0.1")), CaptureBodies(64)).hit(request)
+	if r.err != nil || r.code != 200 {
+		t.Fatalf("Request from the local address failed: got %d (%v)", r.code, r.err)
+	}
+	if host, _, _ := net.SplitHostPort(string(r.body)); host != "127.0.0.1" {
+		t.Fatalf("Wrong source address: want 127.0.0.1, got %s", r.body)
+	}
+
+	r = NewAttacker(LocalAddr(net.ParseIP("192.0.2.1"))).hit(request)
+	if r.err == nil {
+		t.Fatal("Request from an unassignable local address succeeded")
+	}
+}
+
+func TestAttackKeepAlive(t *testing.T) {
+	var conns uint64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddUint64(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	for keepalive, want := range map[bool]uint64{true: 1, false: 5} {
+		atomic.StoreUint64(&conns, 0)
+		a := NewAttacker(KeepAlive(keepalive))
+		reused := 0
+		for i := 0; i < 5; i++ {
+			if a.hit(request).reused {
+				reused++
+			}
+		}
+		if got := atomic.LoadUint64(&conns); got != want {
+			t.Errorf("Wrong number of connections with keep-alive %t: want %d, got %d", keepalive, want, got)
+		}
+		if want := 5 - int(want); reused != want {
+			t.Errorf("Wrong number of reused connections with keep-alive %t: want %d, got %d", keepalive, want, reused)
+		}
+	}
+}
+
+func TestAttackWorkers(t *testing.T) {
+	var inflight, max int64
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt64(&inflight, 1)
+			defer atomic.AddInt64(&inflight, -1)
+			for m := atomic.LoadInt64(&max); n > m && !atomic.CompareAndSwapInt64(&max, m, n); m = atomic.LoadInt64(&max) {
+			}
+			time.Sleep(50 * time.Millisecond)
+		}),
+	)
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	m, _ := NewAttacker(Workers(2)).Attack(Targets{request}, 100, 200*time.Millisecond, NewTextReporter())
+
+	if m.Requests != 20 {
+		t.Fatalf("Wrong number of requests: want 20, got %d", m.Requests)
+	}
+	if got := atomic.LoadInt64(&max); got > 2 {
+		t.Fatalf("Concurrency exceeded the workers: want at most 2, got %d", got)
+	}
+	if m.Delayed == 0 {
+		t.Fatal("Saturated workers didn't delay any request")
+	}
+}
+
+func TestAttackRamp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	rep := NewCSVReporter()
+	began := time.Now()
+	NewAttacker(Ramp(190)).Attack(Targets{request}, 10, time.Second, rep)
+
+	// About 27 hits are due in the first half and 73 in the second one
+	halves := [2]int{}
+	for _, res := range rep.responses {
+		if res.timestamp.Sub(began) < 500*time.Millisecond {
+			halves[0]++
+		} else {
+			halves[1]++
+		}
+	}
+	if halves[0] < 20 || halves[0] > 35 || halves[0]*2 >= halves[1] {
+		t.Fatalf("Rate didn't ramp up: %d requests in the first half and %d in the second", halves[0], halves[1])
+	}
+}
+
+func TestAttackCaptureBodies(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/fail" {
+				w.WriteHeader(500)
+			}
+			w.Write([]byte("0123456789"))
+		}),
+	)
+	defer server.Close()
+
+	fail, _ := http.NewRequest("GET", server.URL+"/fail", nil)
+	ok, _ := http.NewRequest("GET", server.URL+"/ok", nil)
+
+	if r := NewAttacker(CaptureBodies(4)).hit(fail); string(r.body) != "0123" {
+		t.Errorf("Wrong captured body: want 0123, got %q", r.body)
+	}
+	if r := NewAttacker(CaptureBodies(100)).hit(fail); string(r.body) != "0123456789" {
+		t.Errorf("Wrong captured body: want 0123456789, got %q", r.body)
+	}
+	if r := NewAttacker().hit(ok); r.body != nil {
+		t.Errorf("Body captured with the option off: %q", r.body)
+	}
+}
+
+func TestAttackMaxBody(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(bytes.Repeat([]byte("x"), 1<<20))
+		}),
+	)
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	a := NewAttacker(MaxBody(1024))
+	results := []*result{a.hit(request), a.hit(request)}
+	for _, r := range results {
+		if r.err != nil || r.bytesIn != 1024 || !r.truncated {
+			t.Fatalf("Body wasn't capped: want 1024 truncated bytes, got %d (%t, %v)", r.bytesIn, r.truncated, r.err)
+		}
+	}
+	if !results[1].reused {
+		t.Error("Connection wasn't reused after a truncated body")
+	}
+	if m := newMetrics(results, NearestRank); m.Truncated != 2 {
+		t.Errorf("Wrong truncated count: want 2, got %d", m.Truncated)
+	}
+
+	if r := NewAttacker(MaxBody(2 << 20)).hit(request); r.bytesIn != 1<<20 || r.truncated {
+		t.Errorf("Body under the limit was truncated: got %d (%t)", r.bytesIn, r.truncated)
+	}
+}
+
+func TestAttackWeightedTargets(t *testing.T) {
+	var reads, writes uint64
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" {
+				atomic.AddUint64(&reads, 1)
+			} else {
+				atomic.AddUint64(&writes, 1)
+			}
+		}),
+	)
+	defer server.Close()
+
+	targets, _ := NewTargets([]string{"3 GET " + server.URL, "1 POST " + server.URL})
+	targets.Shuffle(time.Now().UnixNano())
+	Attack(targets, 400, time.Second, NewTextReporter())
+
+	if ratio := float64(reads) / float64(writes); ratio < 2.7 || ratio > 3.3 {
+		t.Fatalf("Wrong distribution: want 3:1, got %d:%d", reads, writes)
+	}
+}
+
+func TestAttackContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	for _, workers := range []uint64{0, 1} {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		began := time.Now()
+		m, err := NewAttacker(Workers(workers)).AttackContext(ctx, Targets{request}, 100, 2*time.Second, NewTextReporter())
+		cancel()
+		if err != nil {
+			t.Fatalf("Attack failed: %s", err)
+		}
+		if elapsed := time.Since(began); elapsed > time.Second {
+			t.Fatalf("Attack wasn't stopped: took %s", elapsed)
+		}
+		if m.Requests == 0 || m.Requests >= 200 {
+			t.Fatalf("Wrong number of requests of a stopped attack: got %d of 200", m.Requests)
+		}
+	}
+}
+
+func TestCollectWarmup(t *testing.T) {
+	began := time.Unix(1375351200, 0)
+	results := make(chan *result)
+	go func() {
+		defer close(results)
+		for i := 0; i < 10; i++ {
+			timing := time.Millisecond
+			if i < 2 { // Cold start
+				timing = time.Second
+			}
+			results <- &result{code: 200, timestamp: began.Add(time.Duration(i) * time.Second), timing: timing}
+		}
+	}()
+
+	rep := NewHistogramReporter([]time.Duration{0, time.Second})
+	w := window{from: began.Add(2 * time.Second), to: began.Add(9 * time.Second)}
+	m, err := collect(results, rep, w, 0, NearestRank, hdrDigits)
+	if err != nil {
+		t.Fatalf("Collect failed: %s", err)
+	}
+	if m.Requests != 7 || m.Warmup != 3 {
+		t.Fatalf("Wrong exclusion: want 7 requests and 3 warmup, got %d and %d", m.Requests, m.Warmup)
+	}
+	if m.Latencies.Max != time.Millisecond {
+		t.Fatalf("Warmup latencies weren't excluded: got max %s", m.Latencies.Max)
+	}
+	if rep.counts[1] != 7 || rep.counts[2] != 0 {
+		t.Fatalf("Warmup results were reported: %v", rep.counts)
+	}
+}
+
+func TestCollectSample(t *testing.T) {
+	send := func() <-chan *result {
+		results := make(chan *result)
+		go func() {
+			defer close(results)
+			for i := 0; i < 1000; i++ {
+				results <- &result{code: 200, timing: time.Duration(i) * time.Millisecond}
+			}
+		}()
+		return results
+	}
+
+	rep := NewCSVReporter()
+	m, err := collect(send(), rep, window{}, 10, NearestRank, hdrDigits)
+	if err != nil {
+		t.Fatalf("Collect failed: %s", err)
+	}
+	if m.Requests != 1000 || m.StatusCodes[200] != 1000 || m.Latencies.Max != 999*time.Millisecond {
+		t.Fatalf("Metrics don't aggregate all the results: %+v", m)
+	}
+	if len(rep.responses) != 100 || m.Sampled != 100 {
+		t.Fatalf("Wrong sampled results: want 100, got %d reported and %d counted", len(rep.responses), m.Sampled)
+	}
+
+	text := NewTextReporter()
+	if m, err = collect(send(), text, window{}, 10, NearestRank, hdrDigits); err != nil {
+		t.Fatalf("Collect failed: %s", err)
+	}
+	if text.agg.m.Requests != 1000 || m.Sampled != 0 {
+		t.Fatalf("Aggregating reporter was sampled: got %d reported and %d counted", text.agg.m.Requests, m.Sampled)
+	}
+}
+
+func TestAttackByteRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	body := bytes.Repeat([]byte("x"), 1000)
+	request, _ := http.NewRequest("POST", server.URL, bytes.NewReader(body))
+	a := NewAttacker(ByteRate(20000)) // 20 requests per second
+	m, err := a.Attack(Targets{request}, 1000, time.Second, NewTextReporter())
+	if err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	if m.Requests < 18 || m.Requests > 22 {
+		t.Fatalf("Byte rate wasn't capped: want ~20 requests, got %d", m.Requests)
+	}
+	if m.ByteRate < 18000 || m.ByteRate > 23000 {
+		t.Fatalf("Wrong achieved byte rate: want ~20000, got %.2f", m.ByteRate)
+	}
+}
+
+func TestAttackLazyTargets(t *testing.T) {
+	var mu sync.Mutex
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+
+	r, w := io.Pipe()
+	go func() {
+		defer w.Close()
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(w, "GET %s/%d\n", server.URL, i)
+		}
+	}()
+
+	a := NewAttacker(Workers(1)) // Sent one at a time, in order
+	began := time.Now()
+	m, err := a.AttackTargeter(context.Background(), NewLazyTargeter(r), 50, 10*time.Second, NewTextReporter())
+	if err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	if elapsed := time.Since(began); elapsed > time.Second || elapsed < 80*time.Millisecond {
+		t.Fatalf("Attack didn't stop at the end of the targets at the rate: took %s", elapsed)
+	}
+	if want := []string{"/0", "/1", "/2", "/3", "/4"}; m.Requests != 5 || !reflect.DeepEqual(paths, want) {
+		t.Fatalf("Wrong requests: want %v, got %v", want, paths)
+	}
+}
+
+func TestAttackSwitchingProtocols(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: vegeta\r\n\r\n")
+		buf.Flush()
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "vegeta")
+	if r := NewAttacker().hit(request); r.code != 101 || r.err != nil {
+		t.Fatalf("Wrong informational result: got %d (%v)", r.code, r.err)
+	}
+}
+
+func TestAttackOKCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	missing, _ := http.NewRequest("GET", server.URL+"/missing", nil)
+	m, err := NewAttacker(OKCodes(200, 404)).Attack(Targets{missing}, 100, 200*time.Millisecond, NewTextReporter())
+	if err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	if m.Requests != 20 || m.StatusCodes[404] != 20 || m.Success != 1 || len(m.Errors) != 0 {
+		t.Fatalf("404s weren't successful: %+v", m)
+	}
+
+	ok, _ := http.NewRequest("GET", server.URL, nil)
+	if r := NewAttacker(OKCodes(404)).hit(ok); r.code != 200 || r.successful() {
+		t.Fatalf("200 wasn't unsuccessful without being an OK code: %+v", r)
+	}
+}
+
+func TestCollectFlushes(t *testing.T) {
+	results := make(chan *result)
+	go func() {
+		defer close(results)
+		for i := 0; i < 3; i++ {
+			results <- &result{code: 200, timestamp: time.Now()}
+		}
+	}()
+
+	out := &bytes.Buffer{}
+	if _, err := collect(results, NewJSONLinesReporter(out), window{}, 0, NearestRank, hdrDigits); err != nil {
+		t.Fatalf("Collect failed: %s", err)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 3 {
+		t.Fatalf("Buffered lines weren't flushed: want 3, got %d", lines)
+	}
+
+	results = make(chan *result, 1)
+	results <- &result{code: 200, timestamp: time.Now()}
+	close(results)
+	if _, err := collect(results, NewJSONLinesReporter(&failingWriter{}), window{}, 0, NearestRank, hdrDigits); err == nil || err.Error() != "disk full" {
+		t.Fatalf("Flush error didn't propagate: %v", err)
+	}
+}
+
+func TestAttackMaxRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	began := time.Now()
+	m, err := NewAttacker(MaxRequests(5)).Attack(Targets{request}, 100, 10*time.Second, NewTextReporter())
+	if err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Fatalf("Attack didn't stop after the max requests: took %s", elapsed)
+	}
+	if m.Requests != 5 {
+		t.Fatalf("Wrong number of requests: want 5, got %d", m.Requests)
+	}
+
+	if m, _ = NewAttacker(MaxRequests(1000)).Attack(Targets{request}, 100, 100*time.Millisecond, NewTextReporter()); m.Requests != 10 {
+		t.Fatalf("Attack didn't stop at the end of its duration: want 10 requests, got %d", m.Requests)
+	}
+}
+
+func TestAttackMethods(t *testing.T) {
+	methods := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods <- r.Method
+		w.Header().Set("Content-Length", "5")
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	targets, err := NewTargets([]string{"HEAD " + server.URL, "DELETE " + server.URL})
+	if err != nil {
+		t.Fatalf("Couldn't parse targets: %s", err)
+	}
+	a := NewAttacker(CaptureBodies(10))
+	head, del := a.hit(targets[0]), a.hit(targets[1])
+	if got := []string{<-methods, <-methods}; got[0] != "HEAD" || got[1] != "DELETE" {
+		t.Fatalf("Wrong methods dispatched: %v", got)
+	}
+	if head.err != nil || head.code != 200 || head.bytesIn != 0 || len(head.body) != 0 {
+		t.Errorf("HEAD read a body: %d bytes, %q (%v)", head.bytesIn, head.body, head.err)
+	}
+	if del.err != nil || del.bytesIn != 5 || string(del.body) != "hello" {
+		t.Errorf("Wrong DELETE body: %d bytes, %q (%v)", del.bytesIn, del.body, del.err)
+	}
+}
@@ -0,0 +1,55 @@
+package vegeta
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// BodiesReporter prints the captured response bodies of unsuccessful
+// (non 2xx or invalid) responses for debugging. Bodies are only captured by
+// Attackers with the CaptureBodies option.
+type BodiesReporter struct {
+	responses []*result
+	mu        sync.Mutex
+}
+
+// NewBodiesReporter initializes a BodiesReporter with no responses
+func NewBodiesReporter() *BodiesReporter {
+	return &BodiesReporter{responses: make([]*result, 0)}
+}
+
+// Report writes the timestamp, status code and captured body of each
+// unsuccessful response to out, in order of arrival.
+// It returns an error in case of failure.
+func (r *BodiesReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
+	fmt.Fprintf(w, "Timestamp\tStatus\tBody\n")
+	for _, res := range r.responses {
+		fmt.Fprintf(w, "%s\t%d\t%q\n", res.timestamp.Format(time.RFC3339Nano), res.code, res.body)
+	}
+	return w.Flush()
+}
+
+// add adds an unsuccessful response to be used in the report
+func (r *BodiesReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !res.successful() {
+		r.responses = append(r.responses, res)
+	}
+	return nil
+}
+
+func (r *BodiesReporter) detailed() {}
+
+// Reset clears the responses
+func (r *BodiesReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = r.responses[:0]
+}
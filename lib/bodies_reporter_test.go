@@ -0,0 +1,21 @@
+package vegeta
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBodiesReporter(t *testing.T) {
+	rep := NewBodiesReporter()
+	rep.add(&result{code: 200, body: []byte("all good")})
+	rep.add(&result{code: 503, body: []byte("overloaded\n")})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if report := out.String(); strings.Contains(report, "all good") || !strings.Contains(report, `"overloaded\n"`) {
+		t.Fatalf("Wrong bodies reported. Got: %s", report)
+	}
+}
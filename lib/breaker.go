@@ -0,0 +1,79 @@
+package vegeta
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// breaker trips once the ratio of the errors of the results of an attack
+// over a sliding window of time exceeds a threshold, to abort it. It only
+// judges full windows, so the first results can't trip it on their own.
+type breaker struct {
+	ratio    float64
+	window   time.Duration
+	first    time.Time
+	recent   []breakerSample // The results within the window, in order
+	failures int             // The errors among the recent results
+	reason   string          // Why the breaker tripped, if it did
+}
+
+// breakerSample is a result tracked by a breaker
+type breakerSample struct {
+	at     time.Time
+	failed bool
+}
+
+// newBreaker initializes a breaker which trips when the errors exceed ratio
+// over window
+func newBreaker(ratio float64, window time.Duration) *breaker {
+	return &breaker{ratio: ratio, window: window}
+}
+
+// add tracks a result and returns whether the breaker tripped with it
+func (b *breaker) add(res *result) bool {
+	if b.first.IsZero() {
+		b.first = res.timestamp
+	}
+	b.recent = append(b.recent, breakerSample{res.timestamp, res.err != nil})
+	if res.err != nil {
+		b.failures++
+	}
+	from := res.timestamp.Add(-b.window)
+	evicted := 0
+	for _, s := range b.recent {
+		if !s.at.Before(from) {
+			break
+		}
+		if s.failed {
+			b.failures--
+		}
+		evicted++
+	}
+	b.recent = b.recent[evicted:]
+
+	if b.reason != "" || res.timestamp.Sub(b.first) < b.window {
+		return false
+	}
+	if ratio := float64(b.failures) / float64(len(b.recent)); ratio > b.ratio {
+		b.reason = fmt.Sprintf("error rate of %.2f%% over %s exceeded %.2f%%", ratio*100, b.window, b.ratio*100)
+		return true
+	}
+	return false
+}
+
+// watch forwards the results of in to the returned channel, tracking them,
+// and calls cancel once the breaker trips
+func (b *breaker) watch(in <-chan *result, cancel context.CancelFunc) <-chan *result {
+	out := make(chan *result)
+	go func() {
+		defer close(out)
+		for res := range in {
+			if b.add(res) {
+				cancel()
+			}
+			out <- res
+		}
+	}()
+	return out
+}
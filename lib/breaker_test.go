@@ -0,0 +1,61 @@
+package vegeta
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	began := time.Unix(0, 0)
+	b := newBreaker(0.5, time.Second)
+	failed := &result{err: errors.New("Internal Server Error")}
+	for i := 0; i < 10; i++ {
+		failed.timestamp = began.Add(time.Duration(i) * 100 * time.Millisecond)
+		if b.add(failed) {
+			t.Fatalf("Breaker tripped before a full window at %s", failed.timestamp.Sub(began))
+		}
+	}
+	// The errors of the first second are out of the window by the third
+	for i := 20; i < 30; i++ {
+		if b.add(&result{code: 200, timestamp: began.Add(time.Duration(i) * 100 * time.Millisecond)}) {
+			t.Fatalf("Breaker tripped on the errors out of the window: %s", b.reason)
+		}
+	}
+	for i := 30; i < 36; i++ {
+		failed.timestamp = began.Add(time.Duration(i) * 100 * time.Millisecond)
+		if tripped := b.add(failed); tripped != (i == 35) {
+			t.Fatalf("Breaker tripped at the wrong error: %d (%s)", i, b.reason)
+		}
+	}
+	if want := "error rate of 54.55% over 1s exceeded 50.00%"; b.reason != want {
+		t.Fatalf("Wrong reason: want %q, got %q", want, b.reason)
+	}
+}
+
+func TestAttackAbort(t *testing.T) {
+	hits := uint64(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint64(&hits, 1) > 20 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	began := time.Now()
+	m, err := NewAttacker(Abort(0.5, 100*time.Millisecond)).Attack(Targets{request}, 100, 10*time.Second, NewTextReporter())
+	if err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	if elapsed := time.Since(began); elapsed > 2*time.Second {
+		t.Fatalf("Attack wasn't aborted: took %s", elapsed)
+	}
+	if !strings.HasPrefix(m.Aborted, "error rate of ") || m.StatusCodes[503] == 0 || m.Requests >= 1000 {
+		t.Fatalf("Wrong metrics of an aborted attack: %+v", m)
+	}
+}
@@ -0,0 +1,32 @@
+package vegeta
+
+import "time"
+
+// Clock tells the time of an attack and waits on it. The Attacker takes the
+// pacing of its hits, their timestamps and timings and its progress ticks
+// from its Clock, so tests can drive attacks with a fake one instead of
+// sleeping. SystemClock is the default.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// After returns a channel which receives the time once d elapsed
+	After(d time.Duration) <-chan time.Time
+	// Tick returns a channel which receives the time every d, until stop
+	// is called
+	Tick(d time.Duration) (ticks <-chan time.Time, stop func())
+}
+
+// SystemClock is the Clock of the wall time of the system
+var SystemClock Clock = systemClock{}
+
+// systemClock is the Clock of the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (systemClock) Tick(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
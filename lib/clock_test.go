@@ -0,0 +1,39 @@
+package vegeta
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves when it's waited on: After
+// advances it by d right away, so attacks are paced without sleeping.
+// Its ticks are sent by the tests.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	ticks chan time.Time
+}
+
+// newFakeClock initializes a fakeClock at now
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, ticks: make(chan time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) Tick(time.Duration) (<-chan time.Time, func()) {
+	return c.ticks, func() {}
+}
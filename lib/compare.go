@@ -0,0 +1,78 @@
+package vegeta
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+	"time"
+)
+
+// Comparison holds the changes of the key metrics between two runs, e.g.
+// before and after a deployment, as returned by Compare
+type Comparison struct {
+	Deltas []Delta
+}
+
+// Delta is the change of a metric between two runs
+type Delta struct {
+	Name          string
+	Before, After float64
+	// Change is the relative change from Before to After, e.g. 0.1 for 10%
+	// more. It's infinite when only Before is zero.
+	Change float64
+	// Regression and Improvement tell whether the change is for the worse
+	// or the better, which neither is when there's no change
+	Regression, Improvement bool
+	format                  func(float64) string
+}
+
+// Compare returns the Comparison of the latency percentiles, success ratio
+// and rate of the Metrics of two runs
+func Compare(before, after *Metrics) *Comparison {
+	latency := func(v float64) string { return time.Duration(v).String() }
+	percent := func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) }
+	rate := func(v float64) string { return fmt.Sprintf("%.2f/s", v) }
+	return &Comparison{Deltas: []Delta{
+		newDelta("Time(50th)", float64(before.Latencies.P50), float64(after.Latencies.P50), false, latency),
+		newDelta("Time(95th)", float64(before.Latencies.P95), float64(after.Latencies.P95), false, latency),
+		newDelta("Time(99th)", float64(before.Latencies.P99), float64(after.Latencies.P99), false, latency),
+		newDelta("Success", before.Success, after.Success, true, percent),
+		newDelta("Rate", before.Rate, after.Rate, true, rate),
+	}}
+}
+
+// newDelta returns the Delta of a metric, which is better higher or lower
+func newDelta(name string, before, after float64, higher bool, format func(float64) string) Delta {
+	d := Delta{Name: name, Before: before, After: after, format: format}
+	switch {
+	case before == after:
+	case before == 0:
+		d.Change = math.Inf(1)
+	default:
+		d.Change = (after - before) / before
+	}
+	if before != after {
+		d.Improvement = (after > before) == higher
+		d.Regression = !d.Improvement
+	}
+	return d
+}
+
+// Report writes a table of the deltas of the Comparison to out, with their
+// percentage changes and whether they're regressions or improvements.
+// It returns an error in case of failure.
+func (c *Comparison) Report(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', 0)
+	fmt.Fprintf(w, "Metric\tBefore\tAfter\tChange\t\n")
+	for _, d := range c.Deltas {
+		verdict := ""
+		if d.Regression {
+			verdict = "regression"
+		} else if d.Improvement {
+			verdict = "improvement"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%+.2f%%\t%s\n", d.Name, d.format(d.Before), d.format(d.After), d.Change*100, verdict)
+	}
+	return w.Flush()
+}
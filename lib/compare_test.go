@@ -0,0 +1,68 @@
+package vegeta
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	before := &Metrics{
+		Latencies: LatencyMetrics{P50: 10 * time.Millisecond, P95: 100 * time.Millisecond, P99: 200 * time.Millisecond},
+		Success:   0.8,
+		Rate:      100,
+	}
+	after := &Metrics{
+		Latencies: LatencyMetrics{P50: 12 * time.Millisecond, P95: 75 * time.Millisecond, P99: 200 * time.Millisecond},
+		Success:   1,
+		Rate:      90,
+	}
+
+	c := Compare(before, after)
+	for i, want := range []struct {
+		name                    string
+		change                  float64
+		regression, improvement bool
+	}{
+		{"Time(50th)", 0.2, true, false},
+		{"Time(95th)", -0.25, false, true},
+		{"Time(99th)", 0, false, false},
+		{"Success", 0.25, false, true},
+		{"Rate", -0.1, true, false},
+	} {
+		d := c.Deltas[i]
+		if d.Name != want.name || math.Abs(d.Change-want.change) > 1e-9 ||
+			d.Regression != want.regression || d.Improvement != want.improvement {
+			t.Errorf("Wrong delta: want %+v, got %+v", want, d)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := c.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	rows := map[string][]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			rows[fields[0]] = fields[1:]
+		}
+	}
+	for name, want := range map[string]string{
+		"Time(50th)": "10ms 12ms +20.00% regression",
+		"Time(99th)": "200ms 200ms +0.00%",
+		"Success":    "80.00% 100.00% +25.00% improvement",
+	} {
+		if got := strings.Join(rows[name], " "); got != want {
+			t.Errorf("Wrong %s row: want %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestCompareFromZero(t *testing.T) {
+	d := Compare(&Metrics{}, &Metrics{Rate: 10}).Deltas[4]
+	if !math.IsInf(d.Change, 1) || !d.Improvement {
+		t.Fatalf("Wrong delta from zero: %+v", d)
+	}
+}
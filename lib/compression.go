@@ -0,0 +1,50 @@
+package vegeta
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync/atomic"
+)
+
+// countingReader counts the bytes read through it. Its count can be loaded
+// atomically while it's read by another goroutine.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// decodes returns whether bodies with the passed Content-Encoding are
+// decoded by a decodingReader
+func decodes(encoding string) bool {
+	return encoding == "gzip" || encoding == "deflate"
+}
+
+// decodingReader decodes a gzip or deflate compressed body as it's read.
+// Its decoder is created on the first read, which returns its errors.
+type decodingReader struct {
+	r        io.Reader
+	encoding string
+	dec      io.Reader
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.dec == nil {
+		var err error
+		if d.encoding == "gzip" {
+			d.dec, err = gzip.NewReader(d.r)
+		} else {
+			d.dec, err = zlib.NewReader(d.r)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return d.dec.Read(p)
+}
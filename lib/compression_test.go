@@ -0,0 +1,64 @@
+package vegeta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestAttackDecompress(t *testing.T) {
+	body := bytes.Repeat([]byte("vegeta "), 1000)
+	compressed := map[string][]byte{}
+	for encoding, newWriter := range map[string]func(io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+	} {
+		buf := &bytes.Buffer{}
+		w := newWriter(buf)
+		w.Write(body)
+		w.Close()
+		compressed[encoding] = buf.Bytes()
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.URL.Path[1:]
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("Content-Length", strconv.Itoa(len(compressed[encoding])))
+		w.Write(compressed[encoding])
+	}))
+	defer server.Close()
+
+	for encoding, wire := range compressed {
+		request, _ := http.NewRequest("GET", server.URL+"/"+encoding, nil)
+		r := NewAttacker(CaptureBodies(len(body))).hit(request)
+		if r.err != nil || r.bytesIn != uint64(len(body)) || r.bytesWire != uint64(len(wire)) || !bytes.Equal(r.body, body) {
+			t.Errorf("Wrong decoded %s response: want %d bytes out of %d on the wire, got %d out of %d (%v)",
+				encoding, len(body), len(wire), r.bytesIn, r.bytesWire, r.err)
+		}
+
+		r = NewAttacker(Decompress(false), CaptureBodies(len(body))).hit(request)
+		if r.err != nil || r.bytesIn != uint64(len(wire)) || r.bytesWire != 0 || !bytes.Equal(r.body, wire) {
+			t.Errorf("Wrong undecoded %s response: want %d bytes, got %d (%v)", encoding, len(wire), r.bytesIn, r.err)
+		}
+	}
+}
+
+func TestAttackDecompressAcceptEncoding(t *testing.T) {
+	encodings := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings <- r.Header.Get("Accept-Encoding")
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	NewAttacker().hit(request)
+	request.Header.Set("Accept-Encoding", "identity")
+	NewAttacker().hit(request)
+	if got := []string{<-encodings, <-encodings}; got[0] != "gzip, deflate" || got[1] != "identity" {
+		t.Fatalf("Wrong Accept-Encoding headers: got %q", got)
+	}
+}
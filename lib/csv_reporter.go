@@ -0,0 +1,73 @@
+package vegeta
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CSVReporter writes one CSV row per response with the columns:
+// timestamp, status code, latency (ns), bytes out, bytes in and error
+type CSVReporter struct {
+	// SortByTimestamp makes Report write the rows ordered by timestamp
+	// instead of by order of arrival
+	SortByTimestamp bool
+	responses       []*result
+	mu              sync.Mutex
+}
+
+// NewCSVReporter initializes a CSVReporter with no responses
+func NewCSVReporter() *CSVReporter {
+	return &CSVReporter{responses: make([]*result, 0)}
+}
+
+// Report writes a header row followed by a row per response to out.
+// It returns an error in case of failure.
+func (r *CSVReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.SortByTimestamp {
+		sort.SliceStable(r.responses, func(i, j int) bool {
+			return r.responses[i].timestamp.Before(r.responses[j].timestamp)
+		})
+	}
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"timestamp", "code", "latency", "bytes_out", "bytes_in", "error"})
+	for _, res := range r.responses {
+		errmsg := ""
+		if res.err != nil {
+			errmsg = res.err.Error()
+		}
+		w.Write([]string{
+			res.timestamp.Format(time.RFC3339Nano),
+			strconv.FormatUint(res.code, 10),
+			strconv.FormatInt(res.timing.Nanoseconds(), 10),
+			strconv.FormatUint(res.bytesOut, 10),
+			strconv.FormatUint(res.bytesIn, 10),
+			errmsg,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// add adds a response to be used in the report
+func (r *CSVReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, res)
+	return nil
+}
+
+func (r *CSVReporter) detailed() {}
+
+// Reset clears the responses
+func (r *CSVReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = r.responses[:0]
+}
@@ -0,0 +1,46 @@
+package vegeta
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVReporter(t *testing.T) {
+	began := time.Date(2013, 8, 1, 10, 0, 0, 123456789, time.UTC)
+	rep := NewCSVReporter()
+	rep.SortByTimestamp = true
+	rep.add(&result{
+		code:      500,
+		timestamp: began.Add(time.Second),
+		timing:    20 * time.Millisecond,
+		bytesOut:  5,
+		err:       errors.New("Bad things, really bad"),
+	})
+	rep.add(&result{code: 200, timestamp: began, timing: 10 * time.Millisecond, bytesOut: 5, bytesIn: 42})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if !strings.Contains(out.String(), `"Bad things, really bad"`) {
+		t.Errorf("Error with a comma wasn't quoted. Got: %s", out.String())
+	}
+
+	records, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatalf("Couldn't parse report: %s", err)
+	}
+	want := [][]string{
+		{"timestamp", "code", "latency", "bytes_out", "bytes_in", "error"},
+		{"2013-08-01T10:00:00.123456789Z", "200", "10000000", "5", "42", ""},
+		{"2013-08-01T10:00:01.123456789Z", "500", "20000000", "5", "0", "Bad things, really bad"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("Wrong records: want %v, got %v", want, records)
+	}
+}
@@ -0,0 +1,138 @@
+package vegeta
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+// Categories of the errors of the results
+const (
+	errTimeout           = "timeout"
+	errConnectionRefused = "connection refused"
+	errDNS               = "dns"
+	errTLS               = "tls"
+	errValidation        = "validation"
+	errRead              = "read"
+	errHandshake         = "handshake"
+	errOther             = "other"
+)
+
+// errorCategory classifies err into one of the error categories based on
+// its type, unwrapping it as needed. It returns an empty string for nil.
+func errorCategory(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var (
+		dnsErr  *net.DNSError
+		netErr  net.Error
+		recErr  tls.RecordHeaderError
+		authErr x509.UnknownAuthorityError
+		certErr x509.CertificateInvalidError
+		hostErr x509.HostnameError
+		verErr  *tls.CertificateVerificationError
+		valErr  validationError
+		readErr *readError
+		hsErr   handshakeError
+		catErr  *categorizedError
+	)
+	switch {
+	case errors.As(err, &catErr):
+		return catErr.category
+	case errors.As(err, &valErr):
+		return errValidation
+	case errors.As(err, &hsErr):
+		return errHandshake
+	case errors.As(err, &dnsErr):
+		return errDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errConnectionRefused
+	case errors.As(err, &recErr), errors.As(err, &authErr), errors.As(err, &certErr),
+		errors.As(err, &hostErr), errors.As(err, &verErr):
+		return errTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return errTimeout
+	case errors.As(err, &readErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return errRead
+	}
+	return errOther
+}
+
+// connectionError returns true if err is a failure to connect, e.g.
+// because the connection was refused or the host didn't resolve, as
+// opposed to an error after connecting, e.g. a timeout reading the response
+func connectionError(err error) bool {
+	var (
+		catErr *categorizedError
+		opErr  *net.OpError
+	)
+	if errors.As(err, &catErr) {
+		return catErr.connection
+	}
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	switch errorCategory(err) {
+	case errConnectionRefused, errDNS:
+		return true
+	}
+	return false
+}
+
+// readError is the error of a response whose body was only partially read,
+// e.g. because the connection was closed before its end
+type readError struct {
+	n   int64 // The bytes read
+	err error
+}
+
+func (e *readError) Error() string {
+	return fmt.Sprintf("read %d bytes of the body: %s", e.n, e.err)
+}
+
+func (e *readError) Unwrap() error { return e.err }
+
+// categorizedError is an error of a known category out of its message
+// only, e.g. of the results decoded by Merge
+type categorizedError struct {
+	msg        string
+	category   string
+	connection bool // Whether it's a failure to connect, see connectionError
+}
+
+func (e *categorizedError) Error() string { return e.msg }
+
+// truncatedError is an error whose message was truncated, which unwraps to
+// the original error, e.g. to categorize it
+type truncatedError struct {
+	msg string
+	err error
+}
+
+func (e *truncatedError) Error() string { return e.msg }
+
+func (e *truncatedError) Unwrap() error { return e.err }
+
+// truncateError returns err with its message truncated to n characters,
+// the last of which is an ellipsis, if it's longer. Validation errors are
+// kept as such.
+func truncateError(err error, n int) error {
+	if err == nil || n < 1 {
+		return err
+	}
+	msg := []rune(err.Error())
+	if len(msg) <= n {
+		return err
+	}
+	truncated := string(msg[:n-1]) + "…"
+	if _, ok := err.(validationError); ok {
+		return validationError(truncated)
+	}
+	return &truncatedError{msg: truncated, err: err}
+}
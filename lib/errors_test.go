@@ -0,0 +1,53 @@
+package vegeta
+
+import (
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// timeoutError is a net.Error which timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorCategory(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	for err, want := range map[error]string{
+		nil:            "",
+		timeoutError{}: errTimeout,
+		&url.Error{Op: "Get", Err: timeoutError{}}: errTimeout,
+		refused:                                          errConnectionRefused,
+		&url.Error{Op: "Get", Err: refused}:              errConnectionRefused,
+		&net.DNSError{Err: "no such host"}:               errDNS,
+		x509.UnknownAuthorityError{}:                     errTLS,
+		&url.Error{Op: "Get", Err: x509.HostnameError{}}: errTLS,
+		errors.New("Internal Server Error"):              errOther,
+		&readError{n: 10, err: io.ErrUnexpectedEOF}:      errRead,
+		&readError{n: 10, err: timeoutError{}}:           errTimeout,
+	} {
+		if got := errorCategory(err); got != want {
+			t.Errorf("Wrong category of %v: want %q, got %q", err, want, got)
+		}
+	}
+}
+
+func TestTruncateError(t *testing.T) {
+	err := truncateError(&net.DNSError{Err: "no such host", Name: "lolcathost"}, 12)
+	if err.Error() != "lookup lolc…" || errorCategory(err) != errDNS {
+		t.Errorf("Wrong truncated error: got %q of category %s", err, errorCategory(err))
+	}
+	if _, ok := truncateError(validationError("body doesn't match ^ok$"), 10).(validationError); !ok {
+		t.Error("Truncated validation error isn't one anymore")
+	}
+	if short := errors.New("short"); truncateError(short, 5) != short {
+		t.Error("Error within the length was truncated")
+	}
+}
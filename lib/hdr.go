@@ -0,0 +1,163 @@
+package vegeta
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// hdrHistogram records timings in log-linear buckets, in the style of HDR
+// Histogram, to compute their LatencyMetrics in bounded memory. Timings
+// below 2*10^digits nanoseconds are recorded exactly and the larger ones in
+// buckets at most 10^-digits of their value wide. Percentiles are reported
+// rounded to digits significant digits, within 10^(1-digits) of the exact
+// ones, e.g. 1% with 3 digits. The mean, standard deviation, minimum and
+// maximum are exact.
+type hdrHistogram struct {
+	digits   int
+	k        uint     // The bits of the exactly recorded timings
+	counts   []uint64 // Grown to the bucket of the largest timing
+	n        uint64
+	min, max time.Duration
+	mean, m2 float64 // The running mean and sum of squared differences from it
+}
+
+// newHDRHistogram initializes an hdrHistogram accurate to digits
+// significant digits, between 1 and 5
+func newHDRHistogram(digits int) *hdrHistogram {
+	k := uint(math.Ceil(math.Log2(2 * math.Pow10(digits))))
+	return &hdrHistogram{digits: digits, k: k}
+}
+
+// index returns the index of the bucket of the timing of v nanoseconds
+func (h *hdrHistogram) index(v uint64) int {
+	size := uint64(1) << h.k
+	if v < size {
+		return int(v)
+	}
+	e := uint(bits.Len64(v)) - h.k
+	return int(size + uint64(e-1)*(size/2) + (v>>e - size/2))
+}
+
+// bucket returns the lowest timing and the width of the ith bucket
+func (h *hdrHistogram) bucket(i int) (lo, width uint64) {
+	size := uint64(1) << h.k
+	if uint64(i) < size {
+		return uint64(i), 1
+	}
+	j := uint64(i) - size
+	e := uint(j/(size/2)) + 1
+	return (j%(size/2) + size/2) << e, 1 << e
+}
+
+// add records a timing
+func (h *hdrHistogram) add(timing time.Duration) {
+	if timing < 0 {
+		timing = 0
+	}
+	i := h.index(uint64(timing))
+	for len(h.counts) <= i {
+		h.counts = append(h.counts, 0)
+	}
+	h.counts[i]++
+	h.n++
+	if h.n == 1 || timing < h.min {
+		h.min = timing
+	}
+	if timing > h.max {
+		h.max = timing
+	}
+	delta := float64(timing) - h.mean
+	h.mean += delta / float64(h.n)
+	h.m2 += delta * (float64(timing) - h.mean)
+}
+
+// count returns the number of recorded timings
+func (h *hdrHistogram) count() uint64 {
+	return h.n
+}
+
+// at returns the timing of the given 0 based rank of the recorded timings:
+// the middle of its bucket within the minimum and maximum, rounded to the
+// significant digits of the histogram
+func (h *hdrHistogram) at(rank uint64) time.Duration {
+	if rank == 0 {
+		return h.min
+	} else if rank >= h.n-1 {
+		return h.max
+	}
+	seen := uint64(0)
+	for i, count := range h.counts {
+		if seen += count; seen > rank {
+			lo, width := h.bucket(i)
+			v := time.Duration(h.round(lo + (width-1)/2))
+			if v < h.min {
+				return h.min
+			} else if v > h.max {
+				return h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// round rounds v to the significant digits of the histogram
+func (h *hdrHistogram) round(v uint64) uint64 {
+	scale := uint64(1)
+	for limit := uint64(math.Pow10(h.digits)); v/scale >= limit; scale *= 10 {
+	}
+	return (v + scale/2) / scale * scale
+}
+
+// percentile returns the pth percentile of the recorded timings using
+// method
+func (h *hdrHistogram) percentile(p float64, method PercentileMethod) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	if method == Linear {
+		r := p / 100 * float64(h.n-1)
+		lo := uint64(math.Floor(r))
+		a, b := h.at(lo), h.at(lo+1)
+		return a + time.Duration(math.Round((r-float64(lo))*float64(b-a)))
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.n)))
+	if rank < 1 {
+		rank = 1
+	}
+	return h.at(rank - 1)
+}
+
+// metrics returns the LatencyMetrics of the recorded timings with the
+// percentiles of method
+func (h *hdrHistogram) metrics(method PercentileMethod) LatencyMetrics {
+	if h.n == 0 {
+		return LatencyMetrics{}
+	}
+	return LatencyMetrics{
+		Mean:   time.Duration(math.Round(h.mean)),
+		Min:    h.min,
+		P50:    h.percentile(50, method),
+		P95:    h.percentile(95, method),
+		P99:    h.percentile(99, method),
+		P999:   h.percentile(99.9, method),
+		Max:    h.max,
+		StdDev: time.Duration(math.Sqrt(h.m2 / float64(h.n))),
+	}
+}
+
+// under returns the ratio of the recorded timings whose bucket is below d
+func (h *hdrHistogram) under(d time.Duration) float64 {
+	if h.n == 0 {
+		return 0
+	}
+	below := uint64(0)
+	for i, count := range h.counts {
+		if lo, _ := h.bucket(i); time.Duration(lo) >= d {
+			break
+		}
+		below += count
+	}
+	return float64(below) / float64(h.n)
+}
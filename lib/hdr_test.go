@@ -0,0 +1,78 @@
+package vegeta
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHDRHistogramPercentiles(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	h := newHDRHistogram(3)
+	timings := make([]time.Duration, 100000)
+	for i := range timings { // Log-normal around 20ms, from µs to seconds
+		timings[i] = time.Duration(math.Exp(rnd.NormFloat64()*1.5) * float64(20*time.Millisecond))
+		h.add(timings[i])
+	}
+	sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+
+	bound := math.Pow10(1 - 3)
+	for _, p := range []float64{50, 99, 99.9} {
+		want, got := NearestRank.percentile(timings, p), h.percentile(p, NearestRank)
+		if err := math.Abs(float64(got-want)) / float64(want); err > bound {
+			t.Errorf("Wrong p%v: want %s within %.1f%%, got %s (%.3f%%)", p, want, bound*100, got, err*100)
+		}
+	}
+	if l := h.metrics(NearestRank); l.Min != timings[0] || l.Max != timings[len(timings)-1] {
+		t.Errorf("Wrong extremes: want %s and %s, got %s and %s", timings[0], timings[len(timings)-1], l.Min, l.Max)
+	}
+}
+
+func TestHDRHistogramExact(t *testing.T) {
+	h := newHDRHistogram(3)
+	for i := 1; i <= 1000; i++ {
+		h.add(time.Duration(i))
+	}
+	if got := h.percentile(99, NearestRank); got != 990 {
+		t.Errorf("Wrong p99 of exactly recorded timings: want 990ns, got %s", got)
+	}
+	if got := h.under(501); got != 0.5 {
+		t.Errorf("Wrong ratio under 501ns: want 0.5, got %v", got)
+	}
+}
+
+func TestStreamingAggregator(t *testing.T) {
+	agg := newStreamingAggregator(hdrDigits)
+	for i, timing := range []time.Duration{10, 30, 20} {
+		agg.add(&result{code: 200, timestamp: time.Unix(int64(i), 0), timing: timing * time.Millisecond})
+	}
+	m := agg.metrics(NearestRank)
+	if m.Latencies.Mean != 20*time.Millisecond || m.Latencies.P50 != 20*time.Millisecond {
+		t.Errorf("Wrong latencies: %+v", m.Latencies)
+	}
+	if m.Jitter != 15*time.Millisecond {
+		t.Errorf("Wrong jitter: want 15ms, got %s", m.Jitter)
+	}
+}
+
+func TestStreamingAggregatorDigits(t *testing.T) {
+	for _, tc := range []struct {
+		digits int
+		want   time.Duration
+	}{
+		{0, 123000 * time.Microsecond}, // Out of range, so hdrDigits
+		{1, 100 * time.Millisecond},
+		{3, 123000 * time.Microsecond},
+		{5, 123460 * time.Microsecond},
+	} {
+		agg := newStreamingAggregator(tc.digits)
+		for _, timing := range []time.Duration{123456789, 123456789, 123456789, time.Millisecond, time.Second} {
+			agg.add(&result{code: 200, timing: timing})
+		}
+		if got := agg.metrics(NearestRank).Latencies.P50; got != tc.want {
+			t.Errorf("digits %d: wrong p50: want %s, got %s", tc.digits, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package vegeta
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// histogramBarWidth is the length of the bar of the largest bucket
+const histogramBarWidth = 50
+
+// HistogramReporter prints the distribution of the request latencies
+// over a set of buckets as an ASCII bar chart
+type HistogramReporter struct {
+	buckets []time.Duration
+	counts  []uint64
+	// auto is the number of buckets to compute out of the observed latencies,
+	// which are retained until the report. Zero means fixed buckets.
+	auto     int
+	logScale bool
+	timings  []time.Duration
+	min, max time.Duration
+	mu       sync.Mutex
+}
+
+// NewHistogramReporter initializes a HistogramReporter with the passed
+// bucket boundaries. Bucket i holds the latencies in [buckets[i-1], buckets[i])
+// and latencies of at least the last boundary go into a final +Inf bucket.
+func NewHistogramReporter(buckets []time.Duration) *HistogramReporter {
+	sorted := make([]time.Duration, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return &HistogramReporter{
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)+1),
+	}
+}
+
+// NewAutoHistogramReporter initializes a HistogramReporter with n buckets
+// evenly spaced between the minimum and maximum observed latencies, or
+// logarithmically spaced if logScale is set. Buckets which would be empty
+// ranges are collapsed, so equal latencies all go into a single bucket.
+func NewAutoHistogramReporter(n int, logScale bool) *HistogramReporter {
+	if n < 1 {
+		n = 1
+	}
+	return &HistogramReporter{
+		auto:     n,
+		logScale: logScale,
+		timings:  make([]time.Duration, 0),
+	}
+}
+
+// distribute computes the buckets out of the observed latencies and
+// counts them in
+func (r *HistogramReporter) distribute() {
+	r.min, r.max = time.Duration(math.MaxInt64), time.Duration(0)
+	for _, timing := range r.timings {
+		if timing < r.min {
+			r.min = timing
+		}
+		if timing > r.max {
+			r.max = timing
+		}
+	}
+	if len(r.timings) == 0 {
+		r.min = 0
+	}
+
+	r.buckets = make([]time.Duration, 0, r.auto-1)
+	lo, hi := float64(r.min), float64(r.max)
+	if r.logScale && lo < 1 {
+		lo = 1
+	}
+	for i := 1; i < r.auto; i++ {
+		f := float64(i) / float64(r.auto)
+		b := lo + (hi-lo)*f
+		if r.logScale {
+			b = lo * math.Pow(hi/lo, f)
+		}
+		bucket := time.Duration(math.Round(b))
+		if bucket > r.min && (len(r.buckets) == 0 || bucket > r.buckets[len(r.buckets)-1]) && bucket < r.max {
+			r.buckets = append(r.buckets, bucket)
+		}
+	}
+
+	r.counts = make([]uint64, len(r.buckets)+1)
+	for _, timing := range r.timings {
+		r.count(timing)
+	}
+}
+
+// Report writes each bucket range with its count and a bar scaled to the
+// largest bucket to out.
+// It returns an error in case of failure.
+func (r *HistogramReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.auto > 0 {
+		r.distribute()
+	}
+	max := uint64(0)
+	for _, count := range r.counts {
+		if count > max {
+			max = count
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
+	fmt.Fprintf(w, "Bucket\t\t#\tHistogram\n")
+	for i, count := range r.counts {
+		lo, hi := r.bounds(i)
+		fmt.Fprintf(w, "[%s,\t%s\t%d\t%s\n", lo, hi, count, r.bar(count, max))
+	}
+	return w.Flush()
+}
+
+// bounds returns the printable lower and upper bounds of the ith bucket,
+// the latter with its closing bracket. Computed buckets are bounded by the
+// minimum and maximum observed latencies.
+func (r *HistogramReporter) bounds(i int) (lo, hi string) {
+	lo, hi = time.Duration(0).String(), "+Inf)"
+	if r.auto > 0 {
+		lo, hi = r.min.String(), r.max.String()+"]"
+	}
+	if i > 0 {
+		lo = r.buckets[i-1].String()
+	}
+	if i < len(r.buckets) {
+		hi = r.buckets[i].String() + ")"
+	}
+	return lo, hi
+}
+
+// bar returns the bar of a bucket with count responses, scaled to max
+func (r *HistogramReporter) bar(count, max uint64) string {
+	if max == 0 {
+		return ""
+	}
+	return strings.Repeat("#", int(count*histogramBarWidth/max))
+}
+
+// add counts a response in the bucket its latency falls into, or retains
+// its latency until the report when the buckets are computed
+// Order of arrival is not relevant for this reporter
+func (r *HistogramReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.auto > 0 {
+		r.timings = append(r.timings, res.timing)
+		return nil
+	}
+	r.count(res.timing)
+	return nil
+}
+
+// Reset clears the bucket counts
+func (r *HistogramReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.counts {
+		r.counts[i] = 0
+	}
+	r.timings = r.timings[:0]
+}
+
+// count counts a latency in the bucket it falls into
+func (r *HistogramReporter) count(timing time.Duration) {
+	i := sort.Search(len(r.buckets), func(i int) bool { return timing < r.buckets[i] })
+	r.counts[i]++
+}
@@ -0,0 +1,87 @@
+package vegeta
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogramReporter(t *testing.T) {
+	rep := NewHistogramReporter([]time.Duration{10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond})
+	for _, ms := range []time.Duration{1, 2, 9, 10, 49, 50, 60, 70, 99, 100, 500, 1000} {
+		rep.add(&result{timing: ms * time.Millisecond})
+	}
+	if want := []uint64{3, 2, 4, 3}; !reflect.DeepEqual(rep.counts, want) {
+		t.Fatalf("Wrong bucket counts: want %v, got %v", want, rep.counts)
+	}
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+	if len(lines) != 4 {
+		t.Fatalf("Wrong number of buckets reported: want 4, got %d", len(lines))
+	}
+	for i, count := range rep.counts {
+		bar := strings.Count(lines[i], "#")
+		if want := int(count * histogramBarWidth / 4); bar != want {
+			t.Errorf("Wrong bar length for bucket %d: want %d, got %d", i, want, bar)
+		}
+	}
+	if !strings.Contains(lines[3], "+Inf") {
+		t.Errorf("Last bucket isn't unbounded. Got: %s", lines[3])
+	}
+}
+
+func TestAutoHistogramReporterLinear(t *testing.T) {
+	rep := NewAutoHistogramReporter(3, false)
+	for ms := time.Duration(10); ms <= 100; ms += 10 {
+		rep.add(&result{timing: ms * time.Millisecond})
+	}
+	if err := rep.Report(&bytes.Buffer{}); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if want := []time.Duration{40 * time.Millisecond, 70 * time.Millisecond}; !reflect.DeepEqual(rep.buckets, want) {
+		t.Errorf("Wrong buckets: want %v, got %v", want, rep.buckets)
+	}
+	if want := []uint64{3, 3, 4}; !reflect.DeepEqual(rep.counts, want) {
+		t.Errorf("Wrong bucket counts: want %v, got %v", want, rep.counts)
+	}
+}
+
+func TestAutoHistogramReporterLog(t *testing.T) {
+	rep := NewAutoHistogramReporter(3, true)
+	for _, ms := range []time.Duration{1, 5, 10, 50, 100, 500, 1000} {
+		rep.add(&result{timing: ms * time.Millisecond})
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if want := []time.Duration{10 * time.Millisecond, 100 * time.Millisecond}; !reflect.DeepEqual(rep.buckets, want) {
+		t.Errorf("Wrong buckets: want %v, got %v", want, rep.buckets)
+	}
+	if want := []uint64{2, 2, 3}; !reflect.DeepEqual(rep.counts, want) {
+		t.Errorf("Wrong bucket counts: want %v, got %v", want, rep.counts)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); !strings.Contains(lines[1], "1ms") ||
+		!strings.Contains(lines[3], "1s]") {
+		t.Errorf("Buckets aren't bounded by the observed latencies. Got: %s", out)
+	}
+}
+
+func TestAutoHistogramReporterEqualLatencies(t *testing.T) {
+	rep := NewAutoHistogramReporter(5, false)
+	for i := 0; i < 10; i++ {
+		rep.add(&result{timing: 20 * time.Millisecond})
+	}
+	if err := rep.Report(&bytes.Buffer{}); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if want := []uint64{10}; len(rep.buckets) != 0 || !reflect.DeepEqual(rep.counts, want) {
+		t.Errorf("Equal latencies weren't collapsed into one bucket: %v %v", rep.buckets, rep.counts)
+	}
+}
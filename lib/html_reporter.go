@@ -0,0 +1,222 @@
+package vegeta
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTMLReporter writes the test results as a self-contained HTML page
+// with a summary table of the Metrics, an SVG chart of the latency of the
+// requests over the elapsed time of the test, sampled down to htmlMaxPoints,
+// and an SVG histogram of the status codes. The page has no external
+// resources so it renders offline.
+type HTMLReporter struct {
+	// Percentiles is the method of the latency percentiles of the summary
+	// table, NearestRank by default
+	Percentiles PercentileMethod
+	agg         *aggregator
+	chart       []htmlPoint // Of the responses of at least level, for the latency chart
+	level       int
+	mu          sync.Mutex
+}
+
+// NewHTMLReporter initializes an HTMLReporter with no responses
+func NewHTMLReporter() *HTMLReporter {
+	return &HTMLReporter{agg: newAggregator()}
+}
+
+// Dimensions of the charts of the HTML report, in pixels
+const (
+	htmlChartWidth  = 800
+	htmlChartHeight = 240
+)
+
+// htmlMaxPoints is the number of points of the latency chart retained, so
+// that the memory of the report doesn't grow with the responses. Once
+// reached, about half of them are dropped.
+const htmlMaxPoints = 2 * htmlChartWidth
+
+// htmlPoint is a point of the latency chart
+type htmlPoint struct {
+	timestamp time.Time
+	timing    time.Duration
+}
+
+// level returns the pseudo random level of p, which is at least n for about
+// one in 2^n points. Keeping the points of at least a level samples the
+// same ones whatever the order they're added in.
+func (p htmlPoint) level() int {
+	h := uint64(p.timestamp.UnixNano())*0x9e3779b97f4a7c15 ^ uint64(p.timing)
+	h ^= h >> 31
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 29
+	return bits.TrailingZeros64(h)
+}
+
+// htmlReport is the data of the HTML report template
+type htmlReport struct {
+	*Metrics
+	Width, Height int
+	Points        string // Points of the latency polyline
+	Statuses      []htmlBar
+}
+
+// htmlBar is a bar of the status codes histogram
+type htmlBar struct {
+	Label               string // The status code, or what its 0 stands for
+	Count               uint64
+	X, Y, Width, Height float64
+}
+
+// htmlTemplate is the template of the HTML report
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes":   humanBytes,
+	"percent": func(ratio float64) string { return fmt.Sprintf("%.2f%%", ratio*100) },
+	"rate":    func(rate float64) string { return fmt.Sprintf("%.2f/s", rate) },
+	"total":   func(n uint64) float64 { return float64(n) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8"/>
+<title>Vegeta Report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+svg { border: 1px solid #ccc; margin: 1em 0; }
+</style>
+</head>
+<body>
+<h1>Vegeta Report</h1>
+<table id="summary">
+<tr><th>Requests</th><td>{{.Requests}}</td></tr>
+<tr><th>Rate</th><td>{{rate .Rate}}</td></tr>
+<tr><th>Success</th><td>{{percent .Success}}</td></tr>
+<tr><th>Time(avg)</th><td>{{.Metrics.Latencies.Mean}}</td></tr>
+<tr><th>Time(50th)</th><td>{{.Metrics.Latencies.P50}}</td></tr>
+<tr><th>Time(95th)</th><td>{{.Metrics.Latencies.P95}}</td></tr>
+<tr><th>Time(99th)</th><td>{{.Metrics.Latencies.P99}}</td></tr>
+<tr><th>Time(99.9th)</th><td>{{.Metrics.Latencies.P999}}</td></tr>
+<tr><th>Time(max)</th><td>{{.Metrics.Latencies.Max}}</td></tr>
+<tr><th>Bytes In(total/avg)</th><td>{{bytes (total .BytesIn.Total)}} / {{bytes .BytesIn.Mean}}</td></tr>
+<tr><th>Bytes Out(total/avg)</th><td>{{bytes (total .BytesOut.Total)}} / {{bytes .BytesOut.Mean}}</td></tr>
+</table>
+<h2>Latency</h2>
+<svg id="latencies" xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}">
+<polyline fill="none" stroke="#1f77b4" points="{{.Points}}"/>
+</svg>
+<h2>Status Codes</h2>
+<svg id="status-codes" xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}">
+{{range .Statuses}}<rect fill="#1f77b4" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Label}}: {{.Count}}</title></rect>
+<text x="{{.X}}" y="{{$.Height}}" dy="-0.3em">{{.Label}}</text>
+{{end}}</svg>
+{{if .Errors}}<h2>Error Set</h2>
+<ul>
+{{range .Errors}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+// Report computes and writes the report to out as an HTML page.
+// It returns an error in case of failure.
+func (r *HTMLReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.agg.metrics(r.Percentiles)
+	rep := htmlReport{
+		Metrics: m,
+		Width:   htmlChartWidth,
+		Height:  htmlChartHeight,
+		Points:  r.points(m),
+	}
+
+	codes := m.statusCodes()
+	max := uint64(0)
+	for _, code := range codes {
+		if m.StatusCodes[code] > max {
+			max = m.StatusCodes[code]
+		}
+	}
+	for i, code := range codes {
+		width := float64(htmlChartWidth) / float64(len(codes))
+		height := float64(m.StatusCodes[code]) / float64(max) * (htmlChartHeight - 20)
+		rep.Statuses = append(rep.Statuses, htmlBar{
+			Label:  statusLabel(code),
+			Count:  m.StatusCodes[code],
+			X:      float64(i) * width,
+			Y:      htmlChartHeight - 20 - height,
+			Width:  width * 0.8,
+			Height: height,
+		})
+	}
+
+	return htmlTemplate.Execute(out, rep)
+}
+
+// points returns the points of the latency polyline of the retained
+// responses, sorted by timestamp, scaled to the dimensions of the chart
+func (r *HTMLReporter) points(m *Metrics) string {
+	if len(r.chart) == 0 {
+		return ""
+	}
+	sort.SliceStable(r.chart, func(i, j int) bool {
+		return r.chart[i].timestamp.Before(r.chart[j].timestamp)
+	})
+	first := r.chart[0].timestamp
+	span := r.chart[len(r.chart)-1].timestamp.Sub(first).Seconds()
+	points := make([]string, 0, len(r.chart))
+	for i, p := range r.chart {
+		x := 0.0
+		if span > 0 {
+			x = p.timestamp.Sub(first).Seconds() / span * htmlChartWidth
+		} else if len(r.chart) > 1 {
+			x = float64(i) / float64(len(r.chart)-1) * htmlChartWidth
+		}
+		y := float64(htmlChartHeight)
+		if m.Latencies.Max > 0 {
+			y -= p.timing.Seconds() / m.Latencies.Max.Seconds() * htmlChartHeight
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return strings.Join(points, " ")
+}
+
+// add aggregates a response into the report, retaining its point for the
+// latency chart if it's of at least the level of the report, which is raised
+// whenever htmlMaxPoints are exceeded. Points are sorted by timestamp only
+// once in Report.
+func (r *HTMLReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg.add(res)
+	p := htmlPoint{timestamp: res.timestamp, timing: res.timing}
+	if p.level() < r.level {
+		return nil
+	}
+	r.chart = append(r.chart, p)
+	for len(r.chart) > htmlMaxPoints {
+		r.level++
+		kept := r.chart[:0]
+		for _, p := range r.chart {
+			if p.level() >= r.level {
+				kept = append(kept, p)
+			}
+		}
+		r.chart = kept
+	}
+	return nil
+}
+
+// Reset clears the aggregated responses
+func (r *HTMLReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg, r.chart, r.level = newAggregator(), nil, 0
+}
@@ -0,0 +1,83 @@
+package vegeta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLReporter(t *testing.T) {
+	rep := NewHTMLReporter()
+	began := time.Now()
+	for i := 0; i < 3; i++ {
+		rep.add(&result{code: 200, timestamp: began.Add(time.Duration(i) * time.Second), timing: 10 * time.Millisecond, bytesIn: 1536})
+	}
+	rep.add(&result{code: 500, timestamp: began.Add(3 * time.Second), timing: 30 * time.Millisecond, err: errors.New("<Internal> & \"Error\"")})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	page := out.String()
+	for _, want := range []string{
+		"<td>4</td>",
+		"<td>75.00%</td>",
+		"<td>30ms</td>",
+		"<td>4.5 KiB / 1.1 KiB</td>",
+		`<svg id="latencies"`,
+		"<polyline",
+		`<svg id="status-codes"`,
+		"<title>500: 1</title>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Report doesn't contain %s", want)
+		}
+	}
+	for _, ref := range []string{"src=", "href=", "url("} {
+		if strings.Contains(page, ref) {
+			t.Errorf("Report references external resources with %s", ref)
+		}
+	}
+
+	dec := xml.NewDecoder(out)
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Report isn't well formed: %s", err)
+		}
+	}
+}
+
+func TestHTMLReporterNoResults(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := NewHTMLReporter().Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "<td>0</td>") {
+		t.Fatalf("Wrong report of no results. Got: %s", out)
+	}
+}
+
+func TestHTMLReporterBoundedChart(t *testing.T) {
+	rep := NewHTMLReporter()
+	began, n := time.Now(), 10*htmlMaxPoints
+	for i := 0; i < n; i++ {
+		rep.add(&result{code: 200, timestamp: began.Add(time.Duration(i) * time.Millisecond), timing: time.Millisecond})
+	}
+	if len(rep.chart) > htmlMaxPoints || len(rep.chart) < htmlMaxPoints/4 {
+		t.Fatalf("Wrong number of chart points: want at most %d, got %d", htmlMaxPoints, len(rep.chart))
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if want := fmt.Sprintf("<td>%d</td>", n); !strings.Contains(out.String(), want) {
+		t.Errorf("Report doesn't count all the responses: want %s", want)
+	}
+}
@@ -0,0 +1,111 @@
+package vegeta
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// influxMeasurement is the measurement name of every written point
+const influxMeasurement = "vegeta"
+
+// InfluxReporter writes the test results in InfluxDB line protocol
+// with one point per response
+type InfluxReporter struct {
+	// Metadata tags every point, after the status code, e.g. with the name
+	// of the run
+	Metadata  map[string]string
+	responses []*result
+	live      io.Writer // Where points are written as they arrive, if set
+	mu        sync.Mutex
+}
+
+// NewInfluxReporter initializes an InfluxReporter with no responses
+func NewInfluxReporter() *InfluxReporter {
+	return &InfluxReporter{responses: make([]*result, 0)}
+}
+
+// NewLiveInfluxReporter initializes an InfluxReporter which writes each
+// point to w as soon as its response arrives instead of retaining it.
+// Write failures are returned during the attack and Report writes nothing.
+func NewLiveInfluxReporter(w io.Writer) *InfluxReporter {
+	return &InfluxReporter{live: w}
+}
+
+// Report writes a point per response to out, tagged by status code and
+// timestamped with nanosecond precision.
+// It returns an error in case of failure.
+func (r *InfluxReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := bufio.NewWriter(out)
+	for _, res := range r.responses {
+		if err := r.writePoint(w, res); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// writePoint writes the point of a response to w
+func (r *InfluxReporter) writePoint(w io.Writer, res *result) error {
+	_, err := fmt.Fprintf(w, "%s,code=%s%s latency_ns=%di,bytes_in=%di,bytes_out=%di %d\n",
+		influxMeasurement,
+		influxEscape(strconv.FormatUint(res.code, 10)),
+		r.tags(),
+		res.timing.Nanoseconds(),
+		res.bytesIn,
+		res.bytesOut,
+		res.timestamp.UnixNano(),
+	)
+	return err
+}
+
+// tags returns the tags of the Metadata, sorted by key, each preceded by
+// a comma
+func (r *InfluxReporter) tags() string {
+	keys := make([]string, 0, len(r.Metadata))
+	for key := range r.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, ",%s=%s", influxEscape(key), influxEscape(r.Metadata[key]))
+	}
+	return b.String()
+}
+
+// influxTagEscaper escapes tag keys and values per the line protocol spec
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxEscape escapes a tag key or value
+func influxEscape(s string) string {
+	return influxTagEscaper.Replace(s)
+}
+
+// add adds a response to be used in the report, or writes its point
+// right away in live mode
+// Order of arrival is not relevant for this reporter
+func (r *InfluxReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.live != nil {
+		return r.writePoint(r.live, res)
+	}
+	r.responses = append(r.responses, res)
+	return nil
+}
+
+func (r *InfluxReporter) detailed() {}
+
+// Reset clears the responses
+func (r *InfluxReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = r.responses[:0]
+}
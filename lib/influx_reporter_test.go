@@ -0,0 +1,106 @@
+package vegeta
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxReporter(t *testing.T) {
+	began := time.Unix(1375351200, 5)
+	rep := NewInfluxReporter()
+	rep.add(&result{code: 200, timestamp: began, timing: 12 * time.Millisecond, bytesIn: 251, bytesOut: 10})
+	rep.add(&result{code: 503, timestamp: began.Add(time.Second), timing: 3 * time.Millisecond})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+
+	want := []struct {
+		tags, fields map[string]string
+		timestamp    string
+	}{
+		{
+			map[string]string{"code": "200"},
+			map[string]string{"latency_ns": "12000000i", "bytes_in": "251i", "bytes_out": "10i"},
+			"1375351200000000005",
+		},
+		{
+			map[string]string{"code": "503"},
+			map[string]string{"latency_ns": "3000000i", "bytes_in": "0i", "bytes_out": "0i"},
+			"1375351201000000005",
+		},
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("Wrong number of points: want %d, got %d", len(want), len(lines))
+	}
+	for i, line := range lines {
+		parts := strings.Split(line, " ")
+		if len(parts) != 3 {
+			t.Fatalf("Malformed point: %s", line)
+		}
+		series := strings.Split(parts[0], ",")
+		if series[0] != "vegeta" {
+			t.Errorf("Wrong measurement: want vegeta, got %s", series[0])
+		}
+		if tags := keyValues(series[1:]); !reflect.DeepEqual(tags, want[i].tags) {
+			t.Errorf("Wrong tags: want %v, got %v", want[i].tags, tags)
+		}
+		if fields := keyValues(strings.Split(parts[1], ",")); !reflect.DeepEqual(fields, want[i].fields) {
+			t.Errorf("Wrong fields: want %v, got %v", want[i].fields, fields)
+		}
+		if parts[2] != want[i].timestamp {
+			t.Errorf("Wrong timestamp: want %s, got %s", want[i].timestamp, parts[2])
+		}
+	}
+}
+
+func TestInfluxEscape(t *testing.T) {
+	if got, want := influxEscape("a b,c=d"), `a\ b\,c\=d`; got != want {
+		t.Fatalf("Wrong escaping: want %s, got %s", want, got)
+	}
+}
+
+// keyValues parses a slice of key=value pairs into a map
+func keyValues(pairs []string) map[string]string {
+	kvs := map[string]string{}
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		kvs[kv[0]] = kv[1]
+	}
+	return kvs
+}
+
+func TestLiveInfluxReporter(t *testing.T) {
+	live := &bytes.Buffer{}
+	rep := NewLiveInfluxReporter(live)
+	if err := rep.add(&result{code: 200, timestamp: time.Unix(0, 42), timing: time.Millisecond}); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	if want := "vegeta,code=200 latency_ns=1000000i,bytes_in=0i,bytes_out=0i 42\n"; live.String() != want {
+		t.Fatalf("Point wasn't written on add: want %q, got %q", want, live.String())
+	}
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil || out.Len() != 0 {
+		t.Fatalf("Report of a live reporter wrote %q: %v", out.String(), err)
+	}
+}
+
+func TestInfluxReporterMetadata(t *testing.T) {
+	rep := NewInfluxReporter()
+	rep.Metadata = map[string]string{"run": "night ly", "commit": "8f3a2c1"}
+	rep.add(&result{code: 200, timestamp: time.Unix(0, 42)})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if want := "vegeta,code=200,commit=8f3a2c1,run=night\\ ly latency_ns=0i,bytes_in=0i,bytes_out=0i 42\n"; out.String() != want {
+		t.Fatalf("Wrong point: want %q, got %q", want, out.String())
+	}
+}
@@ -0,0 +1,100 @@
+package vegeta
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSONLinesReporter streams a JSON object per response, on its own line,
+// as each response arrives, e.g. to feed real-time dashboards.
+// Response lines are tagged with "type":"response" and the final summary
+// line written by Report with "type":"summary".
+type JSONLinesReporter struct {
+	// Percentiles is the method of the latency percentiles of the summary
+	// line, NearestRank by default
+	Percentiles PercentileMethod
+	// Digits is the significant digits of the histograms of the latencies
+	// of the summary line, between 1 and 5. It is 3 by default, and set
+	// before adding results.
+	Digits int
+	w      *bufio.Writer
+	enc    *json.Encoder
+	agg    *aggregator
+	mu     sync.Mutex
+}
+
+// jsonLine is the JSON representation of a response line
+type jsonLine struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Code      uint64    `json:"code"`
+	Latency   int64     `json:"latency_ns"`
+	BytesOut  uint64    `json:"bytes_out"`
+	BytesIn   uint64    `json:"bytes_in"`
+	Error     string    `json:"error"`
+}
+
+// jsonSummary is the JSON representation of the summary line
+type jsonSummary struct {
+	Type string `json:"type"`
+	JSONReport
+}
+
+// NewJSONLinesReporter initializes a JSONLinesReporter which streams the
+// response lines to w, buffered
+func NewJSONLinesReporter(w io.Writer) *JSONLinesReporter {
+	bw := bufio.NewWriter(w)
+	return &JSONLinesReporter{w: bw, enc: json.NewEncoder(bw), agg: newStreamingAggregator(hdrDigits)}
+}
+
+// Report flushes the streamed response lines and writes the summary line,
+// with the same fields as the JSONReporter, to out.
+// It returns an error in case of failure.
+func (r *JSONLinesReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	return json.NewEncoder(out).Encode(jsonSummary{"summary", newJSONReport(r.agg.metrics(r.Percentiles))})
+}
+
+// Flush writes the buffered response lines to the stream.
+// It returns an error in case of failure.
+func (r *JSONLinesReporter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.w.Flush()
+}
+
+// add writes the line of a response to the stream
+func (r *JSONLinesReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.agg.m.Requests == 0 {
+		r.agg = newStreamingAggregator(r.Digits)
+	}
+	r.agg.add(res)
+	line := jsonLine{
+		Type:      "response",
+		Timestamp: res.timestamp,
+		Code:      res.code,
+		Latency:   res.timing.Nanoseconds(),
+		BytesOut:  res.bytesOut,
+		BytesIn:   res.bytesIn,
+	}
+	if res.err != nil {
+		line.Error = res.err.Error()
+	}
+	return r.enc.Encode(line)
+}
+
+// Reset clears the summary of the streamed responses
+func (r *JSONLinesReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg = newStreamingAggregator(r.Digits)
+}
@@ -0,0 +1,71 @@
+package vegeta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLinesReporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	rep := NewJSONLinesReporter(out)
+	began := time.Unix(1375351200, 0).UTC()
+	for i := 0; i < 3; i++ {
+		rep.add(&result{code: 200, timestamp: began.Add(time.Duration(i) * time.Second), timing: time.Millisecond, bytesIn: 10})
+	}
+	rep.add(&result{code: 500, timestamp: began.Add(3 * time.Second), err: errors.New("Internal Server Error")})
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Wrong number of lines: want 5, got %d", len(lines))
+	}
+	for i, line := range lines[:4] {
+		var got jsonLine
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("Invalid response line %q: %s", line, err)
+		}
+		if got.Type != "response" || !got.Timestamp.Equal(began.Add(time.Duration(i)*time.Second)) {
+			t.Errorf("Wrong response line %d: %s", i, line)
+		}
+	}
+	var last jsonLine
+	json.Unmarshal([]byte(lines[3]), &last)
+	if last.Code != 500 || last.Error != "Internal Server Error" {
+		t.Errorf("Wrong error line: %s", lines[3])
+	}
+
+	var summary struct {
+		Type     string  `json:"type"`
+		Requests int     `json:"requests"`
+		BytesIn  uint64  `json:"bytes_in"`
+		Success  float64 `json:"success"`
+	}
+	if err := json.Unmarshal([]byte(lines[4]), &summary); err != nil {
+		t.Fatalf("Invalid summary line %q: %s", lines[4], err)
+	}
+	if summary.Type != "summary" || summary.Requests != 4 || summary.BytesIn != 30 || summary.Success != 0.75 {
+		t.Errorf("Wrong summary line: %s", lines[4])
+	}
+}
+
+func TestJSONLinesReporterBuffered(t *testing.T) {
+	out := &bytes.Buffer{}
+	rep := NewJSONLinesReporter(out)
+	rep.add(&result{code: 200})
+	if out.Len() != 0 {
+		t.Fatalf("Line was written unbuffered: %q", out.String())
+	}
+	if err := rep.Report(&bytes.Buffer{}); err != nil || out.Len() == 0 {
+		t.Fatalf("Line wasn't flushed by Report: %v", err)
+	}
+	rep.add(&result{code: 200})
+	if err := rep.Flush(); err != nil || strings.Count(out.String(), "\n") != 2 {
+		t.Fatalf("Line added after Report wasn't flushed: %q (%v)", out.String(), err)
+	}
+}
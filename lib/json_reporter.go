@@ -0,0 +1,114 @@
+package vegeta
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// JSONReporter writes the test results as a JSON object
+// Metrics include total requests, success ratio, latencies in nanoseconds,
+// total bytes in and out, the status code histogram and the error set
+type JSONReporter struct {
+	// Metadata is written as the "metadata" object of the report, e.g. the
+	// name of the run and the commit it attacked
+	Metadata map[string]string
+	// Percentiles is the method of the latency percentiles of the report,
+	// NearestRank by default
+	Percentiles PercentileMethod
+	agg         *aggregator
+	mu          sync.Mutex
+}
+
+// JSONSchemaVersion is the version of the schema of the JSON reports, their
+// "schema_version". It is only bumped by breaking changes, such as removed,
+// renamed or retyped fields, while new fields may be added to any version.
+const JSONSchemaVersion = 1
+
+// JSONReport is the report written by the JSONReporter, and the summary line
+// of the JSONLinesReporter, to decode it with encoding/json. Latencies are in
+// nanoseconds, like the wall duration between the run start and end, and
+// the status codes are keyed by their decimal string.
+type JSONReport struct {
+	SchemaVersion int `json:"schema_version"`
+	Requests      int `json:"requests"`
+	Latencies     struct {
+		Mean time.Duration `json:"mean"`
+		Min  time.Duration `json:"min"`
+		P50  time.Duration `json:"p50"`
+		P95  time.Duration `json:"p95"`
+		P99  time.Duration `json:"p99"`
+		P999 time.Duration `json:"p999"`
+		Max  time.Duration `json:"max"`
+	} `json:"latencies"`
+	BytesIn      uint64            `json:"bytes_in"`
+	BytesOut     uint64            `json:"bytes_out"`
+	Success      float64           `json:"success"`
+	StatusCodes  map[string]uint64 `json:"status_codes"`
+	Errors       []string          `json:"errors"`
+	ErrorCounts  map[string]uint64 `json:"error_counts"`
+	RunStart     time.Time         `json:"run_start"`
+	RunEnd       time.Time         `json:"run_end"`
+	WallDuration time.Duration     `json:"wall_duration"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// NewJSONReporter initializes a JSONReporter with no responses
+func NewJSONReporter() *JSONReporter {
+	return &JSONReporter{agg: newAggregator()}
+}
+
+// Report computes and writes the report to out as a single JSON object.
+// It returns an error in case of failure.
+func (r *JSONReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := newJSONReport(r.agg.metrics(r.Percentiles))
+	rep.Metadata = r.Metadata
+	return json.NewEncoder(out).Encode(rep)
+}
+
+// newJSONReport returns the JSONReport of m
+func newJSONReport(m *Metrics) JSONReport {
+	rep := JSONReport{
+		SchemaVersion: JSONSchemaVersion,
+		Requests:      int(m.Requests),
+		BytesIn:       m.BytesIn.Total,
+		BytesOut:      m.BytesOut.Total,
+		Success:       m.Success,
+		StatusCodes:   make(map[string]uint64, len(m.StatusCodes)),
+		Errors:        m.Errors,
+		ErrorCounts:   m.ErrorCounts,
+		RunStart:      m.RunStart,
+		RunEnd:        m.RunEnd,
+		WallDuration:  m.WallDuration,
+	}
+	rep.Latencies.Mean = m.Latencies.Mean
+	rep.Latencies.Min = m.Latencies.Min
+	rep.Latencies.P50 = m.Latencies.P50
+	rep.Latencies.P95 = m.Latencies.P95
+	rep.Latencies.P99 = m.Latencies.P99
+	rep.Latencies.P999 = m.Latencies.P999
+	rep.Latencies.Max = m.Latencies.Max
+	for code, count := range m.StatusCodes {
+		rep.StatusCodes[strconv.FormatUint(code, 10)] = count
+	}
+	return rep
+}
+
+// add aggregates a response into the report, without retaining it
+func (r *JSONReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg.add(res)
+	return nil
+}
+
+// Reset clears the aggregated responses
+func (r *JSONReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg = newAggregator()
+}
@@ -0,0 +1,114 @@
+package vegeta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONReporter(t *testing.T) {
+	rep := NewJSONReporter()
+	for _, res := range []*result{
+		{code: 200, timing: 10 * time.Millisecond, bytesIn: 100, bytesOut: 10},
+		{code: 200, timing: 20 * time.Millisecond, bytesIn: 100, bytesOut: 10},
+		{code: 500, timing: 30 * time.Millisecond, bytesOut: 10, err: errors.New("Internal Server Error")},
+		{code: 404, timing: 40 * time.Millisecond, bytesOut: 10, err: errors.New("Not Found")},
+	} {
+		rep.add(res)
+	}
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+
+	var got struct {
+		Requests  int `json:"requests"`
+		Latencies struct {
+			Mean int64 `json:"mean"`
+			Min  int64 `json:"min"`
+			P50  int64 `json:"p50"`
+			P95  int64 `json:"p95"`
+			P99  int64 `json:"p99"`
+			Max  int64 `json:"max"`
+		} `json:"latencies"`
+		BytesIn     uint64            `json:"bytes_in"`
+		BytesOut    uint64            `json:"bytes_out"`
+		Success     float64           `json:"success"`
+		StatusCodes map[string]uint64 `json:"status_codes"`
+		Errors      []string          `json:"errors"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("Couldn't decode report: %s", err)
+	}
+
+	if got.Requests != 4 {
+		t.Errorf("Wrong requests: want 4, got %d", got.Requests)
+	}
+	if got.Success != 0.5 {
+		t.Errorf("Wrong success: want 0.5, got %f", got.Success)
+	}
+	for field, pair := range map[string][2]int64{
+		"mean": {got.Latencies.Mean, int64(25 * time.Millisecond)},
+		"min":  {got.Latencies.Min, int64(10 * time.Millisecond)},
+		"p50":  {got.Latencies.P50, int64(20 * time.Millisecond)},
+		"p95":  {got.Latencies.P95, int64(40 * time.Millisecond)},
+		"p99":  {got.Latencies.P99, int64(40 * time.Millisecond)},
+		"max":  {got.Latencies.Max, int64(40 * time.Millisecond)},
+	} {
+		if pair[0] != pair[1] {
+			t.Errorf("Wrong %s latency: want %d, got %d", field, pair[1], pair[0])
+		}
+	}
+	if got.BytesIn != 200 || got.BytesOut != 40 {
+		t.Errorf("Wrong bytes in/out: want 200/40, got %d/%d", got.BytesIn, got.BytesOut)
+	}
+	if want := map[string]uint64{"200": 2, "404": 1, "500": 1}; !reflect.DeepEqual(got.StatusCodes, want) {
+		t.Errorf("Wrong status codes: want %v, got %v", want, got.StatusCodes)
+	}
+	if want := []string{"Internal Server Error", "Not Found"}; !reflect.DeepEqual(got.Errors, want) {
+		t.Errorf("Wrong errors: want %v, got %v", want, got.Errors)
+	}
+}
+
+func TestJSONReporterMetadata(t *testing.T) {
+	rep := NewJSONReporter()
+	rep.Metadata = map[string]string{"name": "nightly", "commit": "8f3a2c1", "region": "eu \"west\""}
+	rep.add(&result{code: 200})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	var got struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("Invalid JSON: %s", err)
+	}
+	if !reflect.DeepEqual(got.Metadata, rep.Metadata) {
+		t.Fatalf("Wrong metadata: want %v, got %v", rep.Metadata, got.Metadata)
+	}
+}
+
+func TestJSONReporterSchema(t *testing.T) {
+	rep := NewJSONReporter()
+	rep.add(&result{code: 200, timing: 10 * time.Millisecond})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	dec := json.NewDecoder(out)
+	dec.DisallowUnknownFields()
+	var got JSONReport
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Couldn't decode report into JSONReport: %s", err)
+	}
+	if got.SchemaVersion != JSONSchemaVersion || got.Requests != 1 || got.Latencies.Max != 10*time.Millisecond {
+		t.Fatalf("Wrong report: %+v", got)
+	}
+}
@@ -0,0 +1,541 @@
+package vegeta
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Metrics holds the metrics aggregated out of a set of results
+type Metrics struct {
+	Requests  uint64
+	Success   float64 // Ratio of successful (2xx and valid) responses
+	Latencies LatencyMetrics
+	BytesIn   ByteMetrics
+	BytesOut  ByteMetrics
+	// TTFB holds the metrics of the times to first byte of the responses,
+	// which unlike their Latencies exclude reading their bodies
+	TTFB LatencyMetrics
+	// Phases holds the mean timings of the phases of the requests
+	Phases PhaseMetrics
+	// Rate is the number of requests per second achieved over the span from
+	// the first to the last request. It's zero with less than two requests.
+	Rate float64
+	// ByteRate is the number of bytes sent per second over the same span
+	ByteRate float64
+	// RunStart and RunEnd are the timestamps of the first and the last
+	// requests, and WallDuration the span between them
+	RunStart     time.Time
+	RunEnd       time.Time
+	WallDuration time.Duration
+	// Redirected is the number of requests which followed redirects
+	Redirected uint64
+	// Reused is the number of requests which reused a connection
+	Reused uint64
+	// Delayed is the number of requests which waited for a busy worker
+	Delayed uint64
+	// Truncated is the number of responses whose body exceeded the maximum read
+	Truncated uint64
+	// Proxied is the number of requests which went through a proxy
+	Proxied uint64
+	// Retries is the total number of retried attempts of the requests
+	Retries uint64
+	// Failures is the number of requests which failed to connect, e.g.
+	// whose connection was refused or whose host didn't resolve
+	Failures uint64
+	// Warmup is the number of results excluded from the Metrics for falling
+	// within the warmup or cooldown of an attack
+	Warmup uint64
+	// Sampled is the number of results of a sampled attack added to its
+	// Reporter, out of all of its Requests. It's zero unless sampled.
+	Sampled uint64
+	// Aborted is the reason the attack was aborted early, if it was
+	Aborted string
+	// BackedOff is the time the hits of an attack were held back for by the
+	// rate limiting headers of its responses, see FollowRateLimits
+	BackedOff time.Duration
+	// StatusCodes is the histogram of response status codes
+	StatusCodes map[uint64]uint64
+	// StatusLatencies holds the latency metrics of each status code
+	StatusLatencies map[uint64]LatencyMetrics
+	// Errors is the sorted set of distinct errors
+	Errors []string
+	// ErrorCounts counts the occurrences of each distinct error
+	ErrorCounts map[string]uint64
+	// ErrorCategories counts the errors by category
+	ErrorCategories map[string]uint64
+	// Protocols counts the responses by protocol, e.g. HTTP/1.1 or HTTP/2.0
+	Protocols map[string]uint64
+	// Headers counts the captured values of each response header by name,
+	// see CaptureHeaders
+	Headers map[string]map[string]uint64
+	// Hosts holds the metrics of the requests to each host, e.g. to tell
+	// which of the hosts of the targets is slow
+	Hosts map[string]HostMetrics
+	// Jitter is the mean absolute difference between the latencies of
+	// consecutive requests, in order of their timestamps
+	Jitter time.Duration
+}
+
+// LatencyMetrics holds the latency metrics of a set of results
+type LatencyMetrics struct {
+	Mean time.Duration
+	Min  time.Duration
+	P50  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	P999 time.Duration // The 99.9th percentile
+	Max  time.Duration
+	// StdDev is the population standard deviation of the latencies
+	StdDev time.Duration
+}
+
+// HostMetrics holds the metrics of the requests to a host
+type HostMetrics struct {
+	Requests  uint64
+	Success   float64
+	Latencies LatencyMetrics
+}
+
+// PhaseMetrics holds the mean timings of the phases of a set of results.
+// Their sum is roughly the mean latency.
+type PhaseMetrics struct {
+	DNS      time.Duration // Resolving the host
+	Connect  time.Duration // Establishing the connection
+	TLS      time.Duration // The TLS handshake
+	Wait     time.Duration // From sending the request to its first response byte
+	Transfer time.Duration // From the first response byte to the end of the body
+}
+
+// ByteMetrics holds the byte metrics of a set of results
+type ByteMetrics struct {
+	Total uint64
+	Mean  float64
+}
+
+// newMetrics computes the Metrics of the passed results with the
+// percentiles of method. All the means and ratios are zero when there are
+// no results.
+func newMetrics(results []*result, method PercentileMethod) *Metrics {
+	agg := newAggregator()
+	for _, res := range results {
+		agg.add(res)
+	}
+	return agg.metrics(method)
+}
+
+// aggregator accumulates results into Metrics as they arrive, without
+// retaining the results themselves
+type aggregator struct {
+	m           *Metrics
+	timings     latencies
+	ttfbs       latencies
+	samples     []sample // Retained for the jitter unless streaming
+	streaming   bool
+	digits      int           // The significant digits of the histograms when streaming
+	previous    time.Duration // The timing of the last result when streaming
+	deviation   time.Duration // The sum of the deviations when streaming
+	codeTimings map[uint64]latencies
+	hostTimings map[string]latencies
+	hostSuccess map[string]uint64
+	errors      map[string]uint64
+	success     uint64
+	first, last time.Time
+	phases      phases
+}
+
+// newAggregator initializes an aggregator with no results which computes
+// the exact Metrics of the ones it aggregates
+func newAggregator() *aggregator {
+	return &aggregator{
+		m: &Metrics{
+			StatusCodes:     map[uint64]uint64{},
+			StatusLatencies: map[uint64]LatencyMetrics{},
+			Errors:          []string{},
+			ErrorCounts:     map[string]uint64{},
+			ErrorCategories: map[string]uint64{},
+			Protocols:       map[string]uint64{},
+			Headers:         map[string]map[string]uint64{},
+			Hosts:           map[string]HostMetrics{},
+		},
+		timings:     &exactLatencies{},
+		ttfbs:       &exactLatencies{},
+		samples:     make([]sample, 0),
+		codeTimings: map[uint64]latencies{},
+		hostTimings: map[string]latencies{},
+		hostSuccess: map[string]uint64{},
+		errors:      map[string]uint64{},
+	}
+}
+
+// newStreamingAggregator initializes an aggregator with no results which
+// records latencies in histograms of digits significant digits, between 1
+// and 5 or else hdrDigits, so its memory doesn't grow with the results. Its
+// percentiles are within the error bound of hdrHistogram and its jitter
+// follows the order of arrival.
+func newStreamingAggregator(digits int) *aggregator {
+	if digits < 1 || digits > 5 {
+		digits = hdrDigits
+	}
+	agg := newAggregator()
+	agg.streaming, agg.digits = true, digits
+	agg.timings = agg.latencies()
+	agg.ttfbs = agg.latencies()
+	agg.samples = nil
+	return agg
+}
+
+// hdrDigits are the default significant digits of the latencies of
+// streaming aggregators
+const hdrDigits = 3
+
+// latencies returns new latencies of the kind of the aggregator
+func (agg *aggregator) latencies() latencies {
+	if agg.streaming {
+		return newHDRHistogram(agg.digits)
+	}
+	return &exactLatencies{}
+}
+
+// add aggregates a result
+func (agg *aggregator) add(res *result) {
+	m := agg.m
+	m.Requests++
+	if m.Requests == 1 || res.timestamp.Before(agg.first) {
+		agg.first = res.timestamp
+	}
+	if m.Requests == 1 || res.timestamp.After(agg.last) {
+		agg.last = res.timestamp
+	}
+	m.StatusCodes[res.code]++
+	m.BytesOut.Total += res.bytesOut
+	m.BytesIn.Total += res.bytesIn
+	agg.timings.add(res.timing)
+	if res.ttfb > 0 {
+		agg.ttfbs.add(res.ttfb)
+	}
+	agg.phases.dns += res.phases.dns
+	agg.phases.connect += res.phases.connect
+	agg.phases.tls += res.phases.tls
+	agg.phases.wait += res.phases.wait
+	agg.phases.transfer += res.phases.transfer
+	if agg.streaming {
+		if m.Requests > 1 {
+			d := res.timing - agg.previous
+			if d < 0 {
+				d = -d
+			}
+			agg.deviation += d
+		}
+		agg.previous = res.timing
+	} else {
+		agg.samples = append(agg.samples, sample{res.timestamp, res.timing})
+	}
+	timings, ok := agg.codeTimings[res.code]
+	if !ok {
+		timings = agg.latencies()
+		agg.codeTimings[res.code] = timings
+	}
+	timings.add(res.timing)
+	if res.host != "" {
+		timings, ok = agg.hostTimings[res.host]
+		if !ok {
+			timings = agg.latencies()
+			agg.hostTimings[res.host] = timings
+		}
+		timings.add(res.timing)
+	}
+	if res.successful() {
+		agg.success++
+		if res.host != "" {
+			agg.hostSuccess[res.host]++
+		}
+	}
+	if res.redirects > 0 {
+		m.Redirected++
+	}
+	if res.reused {
+		m.Reused++
+	}
+	if res.delayed {
+		m.Delayed++
+	}
+	if res.truncated {
+		m.Truncated++
+	}
+	if res.proxied {
+		m.Proxied++
+	}
+	if res.attempts > 1 {
+		m.Retries += res.attempts - 1
+	}
+	if res.proto != "" {
+		m.Protocols[res.proto]++
+	}
+	for name, values := range res.headers {
+		counts, ok := m.Headers[name]
+		if !ok {
+			counts = map[string]uint64{}
+			m.Headers[name] = counts
+		}
+		for _, value := range values {
+			counts[value]++
+		}
+	}
+	if res.err != nil {
+		agg.errors[res.err.Error()]++
+		m.ErrorCategories[errorCategory(res.err)]++
+		if connectionError(res.err) {
+			m.Failures++
+		}
+	}
+}
+
+// metrics computes and returns the Metrics of the aggregated results, with
+// the percentiles of method
+func (agg *aggregator) metrics(method PercentileMethod) *Metrics {
+	m := agg.m
+	if m.Requests > 0 {
+		m.Success = float64(agg.success) / float64(m.Requests)
+		m.BytesOut.Mean = float64(m.BytesOut.Total) / float64(m.Requests)
+		m.BytesIn.Mean = float64(m.BytesIn.Total) / float64(m.Requests)
+		n := time.Duration(m.Requests)
+		m.Phases = PhaseMetrics{
+			DNS:      agg.phases.dns / n,
+			Connect:  agg.phases.connect / n,
+			TLS:      agg.phases.tls / n,
+			Wait:     agg.phases.wait / n,
+			Transfer: agg.phases.transfer / n,
+		}
+	}
+	m.RunStart, m.RunEnd = agg.first, agg.last
+	m.WallDuration = agg.last.Sub(agg.first)
+	if span := agg.last.Sub(agg.first); m.Requests > 1 && span > 0 {
+		m.Rate = float64(m.Requests) / span.Seconds()
+		m.ByteRate = float64(m.BytesOut.Total) / span.Seconds()
+	}
+	m.Latencies = agg.timings.metrics(method)
+	m.TTFB = agg.ttfbs.metrics(method)
+	if !agg.streaming {
+		m.Jitter = jitter(agg.samples)
+	} else if m.Requests > 1 {
+		m.Jitter = agg.deviation / time.Duration(m.Requests-1)
+	}
+	for code, timings := range agg.codeTimings {
+		m.StatusLatencies[code] = timings.metrics(method)
+	}
+	for host, timings := range agg.hostTimings {
+		m.Hosts[host] = HostMetrics{
+			Requests:  timings.count(),
+			Success:   float64(agg.hostSuccess[host]) / float64(timings.count()),
+			Latencies: timings.metrics(method),
+		}
+	}
+	m.Errors = m.Errors[:0]
+	for err, count := range agg.errors {
+		m.Errors = append(m.Errors, err)
+		m.ErrorCounts[err] = count
+	}
+	sort.Strings(m.Errors)
+	return m
+}
+
+// under returns the ratio of the aggregated timings below d. The timings
+// are sorted by metrics, which must be called first.
+func (agg *aggregator) under(d time.Duration) float64 {
+	return agg.timings.under(d)
+}
+
+// latencies records the timings of results to compute their LatencyMetrics
+type latencies interface {
+	add(timing time.Duration)
+	count() uint64
+	metrics(method PercentileMethod) LatencyMetrics
+	under(d time.Duration) float64
+}
+
+// exactLatencies retains every timing to compute exact LatencyMetrics
+type exactLatencies struct {
+	timings []time.Duration
+}
+
+func (l *exactLatencies) add(timing time.Duration) {
+	l.timings = append(l.timings, timing)
+}
+
+func (l *exactLatencies) count() uint64 {
+	return uint64(len(l.timings))
+}
+
+// metrics computes the LatencyMetrics of the timings with the percentiles
+// of method, sorting them in place
+func (l *exactLatencies) metrics(method PercentileMethod) LatencyMetrics {
+	return newLatencyMetrics(l.timings, method)
+}
+
+// under returns the ratio of the timings below d. The timings are sorted by
+// metrics, which must be called first.
+func (l *exactLatencies) under(d time.Duration) float64 {
+	if len(l.timings) == 0 {
+		return 0
+	}
+	n := sort.Search(len(l.timings), func(i int) bool { return l.timings[i] >= d })
+	return float64(n) / float64(len(l.timings))
+}
+
+// newLatencyMetrics computes the LatencyMetrics of the passed timings with
+// the percentiles of method, sorting them in place.
+func newLatencyMetrics(timings []time.Duration, method PercentileMethod) LatencyMetrics {
+	sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+	l := LatencyMetrics{
+		Min:  method.percentile(timings, 0),
+		P50:  method.percentile(timings, 50),
+		P95:  method.percentile(timings, 95),
+		P99:  method.percentile(timings, 99),
+		P999: method.percentile(timings, 99.9),
+		Max:  method.percentile(timings, 100),
+	}
+	if len(timings) > 0 {
+		total := time.Duration(0)
+		for _, timing := range timings {
+			total += timing
+		}
+		l.Mean = total / time.Duration(len(timings))
+
+		variance := 0.0
+		for _, timing := range timings {
+			d := float64(timing - l.Mean)
+			variance += d * d
+		}
+		l.StdDev = time.Duration(math.Sqrt(variance / float64(len(timings))))
+	}
+	return l
+}
+
+// sample is the latency of a request at its timestamp
+type sample struct {
+	timestamp time.Time
+	timing    time.Duration
+}
+
+// jitter returns the mean absolute difference between the timings of
+// consecutive samples, sorting them in place by timestamp.
+// It returns zero when there are less than two samples.
+func jitter(samples []sample) time.Duration {
+	if len(samples) < 2 {
+		return 0
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].timestamp.Before(samples[j].timestamp)
+	})
+	total := time.Duration(0)
+	for i := 1; i < len(samples); i++ {
+		d := samples[i].timing - samples[i-1].timing
+		if d < 0 {
+			d = -d
+		}
+		total += d
+	}
+	return total / time.Duration(len(samples)-1)
+}
+
+// successful returns whether a response with the status code is successful,
+// which only 2xx ones are. Informational 1xx responses, e.g. 101 Switching
+// Protocols, are counted with their status code but aren't successful, nor
+// are they errors.
+func successful(code uint64) bool {
+	return code >= 200 && code < 300
+}
+
+// outcome overrides whether a result is successful by its status code
+type outcome uint8
+
+const (
+	byStatus  outcome = iota // Successful when 2xx
+	okCode                   // Successful as one of the OK codes of the attack
+	notOKCode                // Not successful as none of the OK codes of the attack
+)
+
+// successful returns whether the result is successful by its status code,
+// as overridden by its outcome. Responses failing validation never are.
+func (r *result) successful() bool {
+	if _, invalid := r.err.(validationError); invalid {
+		return false
+	}
+	switch r.outcome {
+	case okCode:
+		return true
+	case notOKCode:
+		return false
+	}
+	return successful(r.code)
+}
+
+// errorsByCount returns the distinct errors from the most to the least
+// frequent, in alphabetical order when equally frequent
+func (m *Metrics) errorsByCount() []string {
+	errs := append([]string{}, m.Errors...)
+	sort.SliceStable(errs, func(i, j int) bool {
+		return m.ErrorCounts[errs[i]] > m.ErrorCounts[errs[j]]
+	})
+	return errs
+}
+
+// connectionFailures is the label of the status code 0 of the requests
+// which got no response, in the histogram of status codes
+const connectionFailures = "connection failures"
+
+// statusLabel returns the label of code in the histogram of status codes
+func statusLabel(code uint64) string {
+	if code == 0 {
+		return connectionFailures
+	}
+	return strconv.FormatUint(code, 10)
+}
+
+// statusCodes returns the status codes of the histogram in ascending order
+func (m *Metrics) statusCodes() []uint64 {
+	codes := make([]uint64, 0, len(m.StatusCodes))
+	for code := range m.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// PercentileMethod is a method of computing the percentiles of latencies.
+// Both methods agree on the minimum and the maximum.
+type PercentileMethod int
+
+const (
+	// NearestRank picks the smallest latency which at least p percent of
+	// the latencies are less than or equal to, so it's always one of them.
+	// It's the default of the Metrics and reports.
+	NearestRank PercentileMethod = iota
+	// Linear interpolates linearly between the latencies of the two closest
+	// ranks, like numpy's default and the PERCENTILE.INC of spreadsheets
+	Linear
+)
+
+// percentile returns the pth percentile of the ascending sorted timings
+// using the method m. The 0th percentile is the minimum. It returns zero
+// when there are no timings.
+func (m PercentileMethod) percentile(timings []time.Duration, p float64) time.Duration {
+	if len(timings) == 0 {
+		return 0
+	}
+	if m == Linear {
+		h := p / 100 * float64(len(timings)-1)
+		lo := int(math.Floor(h))
+		if lo >= len(timings)-1 {
+			return timings[len(timings)-1]
+		}
+		return timings[lo] + time.Duration(math.Round((h-float64(lo))*float64(timings[lo+1]-timings[lo])))
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(timings))))
+	if rank < 1 {
+		rank = 1
+	}
+	return timings[rank-1]
+}
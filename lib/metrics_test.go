@@ -0,0 +1,257 @@
+package vegeta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewMetricsNoResults(t *testing.T) {
+	m := newMetrics([]*result{}, NearestRank)
+	if m.Requests != 0 || m.Success != 0 || m.BytesIn.Mean != 0 || m.BytesOut.Mean != 0 ||
+		m.Latencies != (LatencyMetrics{}) || len(m.StatusCodes) != 0 || len(m.Errors) != 0 {
+		t.Fatalf("Wrong metrics of no results: %+v", m)
+	}
+}
+
+func TestNewMetrics(t *testing.T) {
+	m := newMetrics([]*result{
+		{code: 200, timing: 10 * time.Millisecond, bytesIn: 100, bytesOut: 20, proto: "HTTP/1.1"},
+		{code: 200, timing: 30 * time.Millisecond, bytesIn: 300, bytesOut: 20, redirects: 2, proto: "HTTP/2.0"},
+		{code: 500, timing: 50 * time.Millisecond, err: errors.New("Server Timeout"), proto: "HTTP/2.0"},
+		{code: 0, timing: 70 * time.Millisecond, err: errors.New("Connection Refused")},
+	}, NearestRank)
+
+	if m.Requests != 4 {
+		t.Errorf("Wrong requests: want 4, got %d", m.Requests)
+	}
+	if m.Success != 0.5 {
+		t.Errorf("Wrong success: want 0.5, got %f", m.Success)
+	}
+	if m.Redirected != 1 {
+		t.Errorf("Wrong redirected: want 1, got %d", m.Redirected)
+	}
+	got := m.Latencies
+	got.StdDev = 0 // See TestNewLatencyMetricsStdDev
+	if want := (LatencyMetrics{
+		Mean: 40 * time.Millisecond,
+		Min:  10 * time.Millisecond,
+		P50:  30 * time.Millisecond,
+		P95:  70 * time.Millisecond,
+		P99:  70 * time.Millisecond,
+		P999: 70 * time.Millisecond,
+		Max:  70 * time.Millisecond,
+	}); got != want {
+		t.Errorf("Wrong latencies: want %+v, got %+v", want, got)
+	}
+	if want := (ByteMetrics{Total: 400, Mean: 100}); m.BytesIn != want {
+		t.Errorf("Wrong bytes in: want %+v, got %+v", want, m.BytesIn)
+	}
+	if want := (ByteMetrics{Total: 40, Mean: 10}); m.BytesOut != want {
+		t.Errorf("Wrong bytes out: want %+v, got %+v", want, m.BytesOut)
+	}
+	if want := map[uint64]uint64{0: 1, 200: 2, 500: 1}; !reflect.DeepEqual(m.StatusCodes, want) {
+		t.Errorf("Wrong status codes: want %v, got %v", want, m.StatusCodes)
+	}
+	if want := map[string]uint64{"HTTP/1.1": 1, "HTTP/2.0": 2}; !reflect.DeepEqual(m.Protocols, want) {
+		t.Errorf("Wrong protocols: want %v, got %v", want, m.Protocols)
+	}
+	if got := m.StatusLatencies[200].Mean; got != 20*time.Millisecond {
+		t.Errorf("Wrong mean latency of 200s: want 20ms, got %s", got)
+	}
+	if want := []string{"Connection Refused", "Server Timeout"}; !reflect.DeepEqual(m.Errors, want) {
+		t.Errorf("Wrong errors: want %v, got %v", want, m.Errors)
+	}
+	if want := map[string]uint64{errOther: 2}; !reflect.DeepEqual(m.ErrorCategories, want) {
+		t.Errorf("Wrong error categories: want %v, got %v", want, m.ErrorCategories)
+	}
+}
+
+func TestNewMetricsRate(t *testing.T) {
+	began := time.Now()
+	results := []*result{}
+	for i := 0; i < 11; i++ { // Spanning 2s
+		results = append(results, &result{code: 200, timestamp: began.Add(time.Duration(i) * 200 * time.Millisecond)})
+	}
+	results[0], results[10] = results[10], results[0] // Out of order on purpose
+	if got := newMetrics(results, NearestRank).Rate; got != 5.5 {
+		t.Errorf("Wrong rate: want 5.5, got %f", got)
+	}
+	if got := newMetrics(results[:1], NearestRank).Rate; got != 0 {
+		t.Errorf("Wrong rate of a single request: want 0, got %f", got)
+	}
+}
+
+func TestNewLatencyMetricsStdDev(t *testing.T) {
+	timings := []time.Duration{2, 4, 4, 4, 5, 5, 7, 9}
+	for i := range timings {
+		timings[i] *= time.Millisecond
+	}
+	if got := newLatencyMetrics(timings, NearestRank).StdDev; math.Abs(float64(got-2*time.Millisecond)) > 1 {
+		t.Errorf("Wrong standard deviation: want 2ms, got %s", got)
+	}
+	if got := newLatencyMetrics([]time.Duration{time.Second}, NearestRank).StdDev; got != 0 {
+		t.Errorf("Wrong standard deviation of a single timing: want 0, got %s", got)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	now := time.Now()
+	samples := []sample{ // Out of order on purpose
+		{now.Add(2 * time.Second), 40 * time.Millisecond},
+		{now, 10 * time.Millisecond},
+		{now.Add(time.Second), 30 * time.Millisecond},
+	}
+	if got, want := jitter(samples), 15*time.Millisecond; got != want {
+		t.Errorf("Wrong jitter: want %s, got %s", want, got)
+	}
+	if got := jitter(samples[:1]); got != 0 {
+		t.Errorf("Wrong jitter of a single sample: want 0, got %s", got)
+	}
+}
+
+func TestMetricsRun(t *testing.T) {
+	began := time.Date(2013, 8, 1, 10, 0, 0, 0, time.UTC)
+	m := newMetrics([]*result{ // Out of order on purpose
+		{code: 200, timestamp: began.Add(2 * time.Second), timing: time.Second},
+		{code: 200, timestamp: began, timing: 10 * time.Millisecond},
+		{code: 200, timestamp: began.Add(3500 * time.Millisecond), timing: 20 * time.Millisecond},
+	}, NearestRank)
+	if !m.RunStart.Equal(began) || !m.RunEnd.Equal(began.Add(3500*time.Millisecond)) {
+		t.Errorf("Wrong run bounds: got %s to %s", m.RunStart, m.RunEnd)
+	}
+	if want := m.RunEnd.Sub(m.RunStart); m.WallDuration != want || want != 3500*time.Millisecond {
+		t.Errorf("Wrong wall duration: want %s, got %s", want, m.WallDuration)
+	}
+
+	out := &bytes.Buffer{}
+	rep := NewJSONReporter()
+	rep.add(&result{code: 200, timestamp: began})
+	rep.add(&result{code: 200, timestamp: began.Add(time.Minute)})
+	rep.Report(out)
+	var report JSONReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil || report.WallDuration != time.Minute || !report.RunStart.Equal(began) {
+		t.Errorf("Wrong run in the JSON report: %s (%v)", out, err)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	timings := make([]time.Duration, 100)
+	for i := range timings {
+		timings[i] = time.Duration(i+1) * time.Millisecond
+	}
+	for p, want := range map[float64]time.Duration{
+		0:   1 * time.Millisecond,
+		50:  50 * time.Millisecond,
+		95:  95 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+	} {
+		if got := NearestRank.percentile(timings, p); got != want {
+			t.Errorf("Wrong %vth percentile: want %s, got %s", p, want, got)
+		}
+	}
+	if got := NearestRank.percentile([]time.Duration{}, 99); got != 0 {
+		t.Errorf("Wrong percentile of no timings: want 0, got %s", got)
+	}
+}
+
+func TestPercentileMethods(t *testing.T) {
+	timings := []time.Duration{1 * time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, 4 * time.Millisecond}
+	for p, want := range map[float64][2]time.Duration{
+		0:   {1 * time.Millisecond, 1 * time.Millisecond},
+		25:  {1 * time.Millisecond, 1750 * time.Microsecond},
+		50:  {2 * time.Millisecond, 2500 * time.Microsecond},
+		95:  {4 * time.Millisecond, 3850 * time.Microsecond},
+		100: {4 * time.Millisecond, 4 * time.Millisecond},
+	} {
+		for i, method := range []PercentileMethod{NearestRank, Linear} {
+			if got := method.percentile(timings, p); got != want[i] {
+				t.Errorf("Wrong %vth percentile of method %d: want %s, got %s", p, method, want[i], got)
+			}
+		}
+	}
+	if got := Linear.percentile([]time.Duration{time.Second}, 50); got != time.Second {
+		t.Errorf("Wrong percentile of a single timing: want 1s, got %s", got)
+	}
+}
+
+func TestNewMetricsInformational(t *testing.T) {
+	m := newMetrics([]*result{{code: 100}, {code: 103}, {code: 200}, {code: 304}}, NearestRank)
+	if m.StatusCodes[100] != 1 || m.StatusCodes[103] != 1 {
+		t.Fatalf("Informational responses weren't counted: %v", m.StatusCodes)
+	}
+	if m.Success != 0.25 {
+		t.Fatalf("Wrong success ratio: want 0.25, got %f", m.Success)
+	}
+}
+
+func TestResultSuccessfulInvalid(t *testing.T) {
+	invalid := validationError("body doesn't match ok")
+	for res, want := range map[*result]bool{
+		{code: 200}:                                                true,
+		{code: 200, err: invalid}:                                  false,
+		{code: 404, outcome: okCode}:                               true,
+		{code: 404, outcome: okCode, err: invalid}:                 false,
+		{code: 200, err: truncateError(invalid, 5)}:                false,
+		{code: 200, err: decodeError("nope", "validation", false)}: false,
+	} {
+		if got := res.successful(); got != want {
+			t.Errorf("Wrong success of %d (%v): want %t, got %t", res.code, res.err, want, got)
+		}
+	}
+
+	// Every reporter agrees on the success of invalid responses
+	results := []*result{{code: 200}, {code: 200, err: invalid, body: []byte("not ok")}}
+	prom, bodies := NewPrometheusReporter(""), NewBodiesReporter()
+	for _, res := range results {
+		prom.add(res)
+		bodies.add(res)
+	}
+	out := &bytes.Buffer{}
+	if err := prom.Report(out); err != nil || !strings.Contains(out.String(), "vegeta_success_ratio 0.5\n") {
+		t.Errorf("Invalid response counted as successful by Prometheus: %v %s", err, out)
+	}
+	out.Reset()
+	if err := bodies.Report(out); err != nil || !strings.Contains(out.String(), "not ok") {
+		t.Errorf("Invalid response left out of the bodies: %v %s", err, out)
+	}
+	if m := newMetrics(results, NearestRank); m.Success != 0.5 {
+		t.Errorf("Wrong success ratio: want 0.5, got %f", m.Success)
+	}
+}
+
+func TestNewMetricsHosts(t *testing.T) {
+	m := newMetrics([]*result{
+		{code: 200, timing: 10 * time.Millisecond, host: "a:80"},
+		{code: 500, timing: 20 * time.Millisecond, host: "a:80"},
+		{code: 200, timing: 30 * time.Millisecond, host: "a:80"},
+		{code: 200, timing: 100 * time.Millisecond, host: "b:80"},
+		{code: 200, timing: 200 * time.Millisecond, host: "b:80"},
+	}, NearestRank)
+
+	want := map[string]HostMetrics{
+		"a:80": {Requests: 3, Success: 2.0 / 3, Latencies: newLatencyMetrics([]time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}, NearestRank)},
+		"b:80": {Requests: 2, Success: 1, Latencies: newLatencyMetrics([]time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, NearestRank)},
+	}
+	if !reflect.DeepEqual(m.Hosts, want) {
+		t.Fatalf("Wrong hosts: want %+v, got %+v", want, m.Hosts)
+	}
+
+	requests, success := uint64(0), 0.0
+	for _, h := range m.Hosts {
+		requests += h.Requests
+		success += h.Success * float64(h.Requests)
+	}
+	if requests != m.Requests {
+		t.Errorf("Wrong sum of host requests: want %d, got %d", m.Requests, requests)
+	}
+	if math.Abs(success-m.Success*float64(m.Requests)) > 1e-9 {
+		t.Errorf("Wrong sum of host successes: want %f, got %f", m.Success*float64(m.Requests), success)
+	}
+}
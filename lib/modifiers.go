@@ -0,0 +1,201 @@
+package vegeta
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// RequestModifier modifies each request of an attack right before it's
+// sent, e.g. to sign it or to authenticate it with a fresh token.
+// Requests whose modification fails aren't sent and are recorded with
+// the error. Modify is called concurrently.
+type RequestModifier interface {
+	Modify(*http.Request) error
+}
+
+// RequestModifierFunc is an adapter to use ordinary functions as
+// RequestModifiers
+type RequestModifierFunc func(*http.Request) error
+
+// Modify calls f(req)
+func (f RequestModifierFunc) Modify(req *http.Request) error {
+	return f(req)
+}
+
+// BearerToken is a RequestModifier which sets the Authorization header of
+// each request to a bearer token, refreshed from its source once expired
+type BearerToken struct {
+	source func() (string, error)
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewBearerToken returns a BearerToken which gets its token from source,
+// again every ttl. Zero ttl means the token never expires.
+func NewBearerToken(source func() (string, error), ttl time.Duration) *BearerToken {
+	return &BearerToken{source: source, ttl: ttl}
+}
+
+// Modify sets the Authorization header of req to the current token
+func (b *BearerToken) Modify(req *http.Request) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now := time.Now(); b.token == "" || (b.ttl > 0 && !now.Before(b.expires)) {
+		token, err := b.source()
+		if err != nil {
+			return err
+		}
+		b.token, b.expires = token, now.Add(b.ttl)
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	return nil
+}
+
+// HMACSigner is a RequestModifier which signs each request with the
+// hex encoded HMAC-SHA256 of its method, request URI and body, separated
+// by newlines, set in its header
+type HMACSigner struct {
+	key    []byte
+	header string
+}
+
+// NewHMACSigner returns an HMACSigner which signs with key into header
+func NewHMACSigner(key []byte, header string) *HMACSigner {
+	return &HMACSigner{key: key, header: header}
+}
+
+// Modify sets the signature header of req
+func (s *HMACSigner) Modify(req *http.Request) error {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(req.Method + "\n" + req.URL.RequestURI() + "\n"))
+	if err := writeBody(mac, req); err != nil {
+		return err
+	}
+	req.Header.Set(s.header, hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// writeBody writes a fresh copy of the body of req, if any, to h
+func writeBody(h hash.Hash, req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	h.Write(b)
+	return nil
+}
+
+// TemplateBody is a RequestModifier which sets the body of each request
+// to a fresh execution of a text/template, e.g. to send distinct payloads
+// to write endpoints. The template can use {{.Seq}}, the sequence number
+// of the request starting at 1, and {{.UUID}}, a random version 4 UUID.
+type TemplateBody struct {
+	tmpl *template.Template
+	seq  uint64
+	mu   sync.Mutex // Guards rnd
+	rnd  io.Reader
+}
+
+// bodyData is the data a TemplateBody is executed with
+type bodyData struct {
+	Seq  uint64
+	UUID string
+}
+
+// NewTemplateBody parses text into a TemplateBody whose UUIDs are read
+// from rnd, e.g. one of NewRand to reproduce them. A nil rnd uses
+// crypto/rand.
+func NewTemplateBody(text string, rnd io.Reader) (*TemplateBody, error) {
+	tmpl, err := template.New("body").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if rnd == nil {
+		rnd = rand.Reader
+	}
+	return &TemplateBody{tmpl: tmpl, rnd: rnd}, nil
+}
+
+// Modify sets the body of req to the next execution of the template
+func (b *TemplateBody) Modify(req *http.Request) error {
+	b.mu.Lock()
+	id, err := newUUID(b.rnd)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := b.tmpl.Execute(buf, bodyData{Seq: atomic.AddUint64(&b.seq, 1), UUID: id}); err != nil {
+		return err
+	}
+	body := buf.Bytes()
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
+
+// StreamBody is a RequestModifier which sets the body of each request to a
+// fresh stream of its generator, e.g. to upload large bodies without holding
+// them in memory. Their length is unknown, so they're sent with chunked
+// transfer encoding and their bytes are counted as they're sent. Streams
+// can't be sent again, so their requests aren't retried.
+type StreamBody struct {
+	generate func() (io.Reader, error)
+}
+
+// NewStreamBody returns a StreamBody of the streams of generate, which is
+// called concurrently. Streams which are io.Closers are closed once sent.
+func NewStreamBody(generate func() (io.Reader, error)) *StreamBody {
+	return &StreamBody{generate: generate}
+}
+
+// Modify sets the body of req to the next stream of the generator
+func (b *StreamBody) Modify(req *http.Request) error {
+	stream, err := b.generate()
+	if err != nil {
+		return err
+	}
+	body, ok := stream.(io.ReadCloser)
+	if !ok {
+		body = ioutil.NopCloser(stream)
+	}
+	req.Body, req.GetBody, req.ContentLength = body, nil, -1
+	return nil
+}
+
+// newUUID returns a version 4 UUID read from rnd
+func newUUID(rnd io.Reader) (string, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(rnd, u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40 // Version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
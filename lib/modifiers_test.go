@@ -0,0 +1,175 @@
+package vegeta
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAttackModifiers(t *testing.T) {
+	seen := make(chan string, 1)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen <- r.Header.Get("X-Path")
+		}),
+	)
+	defer server.Close()
+
+	fromURL := RequestModifierFunc(func(req *http.Request) error {
+		req.Header.Set("X-Path", "path="+req.URL.Path)
+		return nil
+	})
+	request, _ := http.NewRequest("GET", server.URL+"/users/42", nil)
+	if r := NewAttacker(Modifiers(fromURL)).hit(request); r.err != nil {
+		t.Fatalf("Hit failed: %s", r.err)
+	}
+	if got := <-seen; got != "path=/users/42" {
+		t.Fatalf("Wrong modified header: want path=/users/42, got %s", got)
+	}
+	if request.Header.Get("X-Path") != "" {
+		t.Fatal("Target was modified")
+	}
+
+	failing := RequestModifierFunc(func(*http.Request) error { return errors.New("no token") })
+	if r := NewAttacker(Modifiers(failing)).hit(request); r.err == nil || r.err.Error() != "no token" {
+		t.Fatalf("Modifier error wasn't recorded: %v", r.err)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	refreshes := 0
+	b := NewBearerToken(func() (string, error) {
+		refreshes++
+		return "token" + strconv.Itoa(refreshes), nil
+	}, 50*time.Millisecond)
+
+	req, _ := http.NewRequest("GET", "http://localhost/", nil)
+	for i := 0; i < 3; i++ {
+		if err := b.Modify(req); err != nil {
+			t.Fatalf("Modify failed: %s", err)
+		}
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer token1" || refreshes != 1 {
+		t.Fatalf("Token was refreshed before it expired: %s after %d refreshes", got, refreshes)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	b.Modify(req)
+	if got := req.Header.Get("Authorization"); got != "Bearer token2" {
+		t.Fatalf("Expired token wasn't refreshed: got %s", got)
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	key := []byte("secret")
+	req, _ := http.NewRequest("POST", "http://localhost/orders?page=2", bytes.NewReader([]byte(`{"id":1}`)))
+	if err := NewHMACSigner(key, "X-Signature").Modify(req); err != nil {
+		t.Fatalf("Modify failed: %s", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("POST\n/orders?page=2\n{\"id\":1}"))
+	if want, got := hex.EncodeToString(mac.Sum(nil)), req.Header.Get("X-Signature"); got != want {
+		t.Fatalf("Wrong signature: want %s, got %s", want, got)
+	}
+}
+
+func TestTemplateBody(t *testing.T) {
+	bodies := make(chan string, 2)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies <- string(body)
+		}),
+	)
+	defer server.Close()
+
+	tmpl, err := NewTemplateBody(`{"seq":{{.Seq}},"id":"{{.UUID}}"}`, nil)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid template: %s", err)
+	}
+	request, _ := http.NewRequest("POST", server.URL, nil)
+	a := NewAttacker(Modifiers(tmpl))
+
+	var got [2]struct {
+		Seq uint64
+		ID  string
+	}
+	for i := range got {
+		r := a.hit(request)
+		body := <-bodies
+		if r.err != nil || r.bytesOut != uint64(len(body)) {
+			t.Fatalf("Wrong bytes out: want %d, got %d (%v)", len(body), r.bytesOut, r.err)
+		}
+		if err := json.Unmarshal([]byte(body), &got[i]); err != nil {
+			t.Fatalf("Invalid body %q: %s", body, err)
+		}
+	}
+	if got[0].Seq != 1 || got[1].Seq != 2 {
+		t.Errorf("Sequence numbers weren't incremented: %+v", got)
+	}
+	if len(got[0].ID) != 36 || got[0].ID == got[1].ID {
+		t.Errorf("UUIDs aren't distinct: %+v", got)
+	}
+
+	if _, err := NewTemplateBody("{{.Seq", nil); err == nil {
+		t.Error("Invalid template didn't fail")
+	}
+}
+
+func TestStreamBody(t *testing.T) {
+	type received struct {
+		n       int64
+		chunked bool
+	}
+	got := make(chan received, 1)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, _ := io.Copy(ioutil.Discard, r.Body)
+			got <- received{n, len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked"}
+		}),
+	)
+	defer server.Close()
+
+	size := int64(5 << 20)
+	stream := NewStreamBody(func() (io.Reader, error) {
+		return io.LimitReader(NewRand(1), size), nil
+	})
+	request, _ := http.NewRequest("PUT", server.URL, nil)
+	r := NewAttacker(Modifiers(stream), Retry(RetryPolicy{Attempts: 3})).hit(request)
+	if r.err != nil || r.code != 200 {
+		t.Fatalf("Streamed request failed: got %d (%v)", r.code, r.err)
+	}
+	if server := <-got; server.n != size || !server.chunked {
+		t.Fatalf("Wrong body received: want %d chunked bytes, got %+v", size, server)
+	}
+	if r.bytesOut != uint64(size) || r.attempts != 1 {
+		t.Fatalf("Wrong bytes out: want %d in 1 attempt, got %d in %d", size, r.bytesOut, r.attempts)
+	}
+}
+
+func TestTemplateBodySeed(t *testing.T) {
+	bodies := [2]string{}
+	for i := range bodies {
+		tmpl, _ := NewTemplateBody("{{.UUID}}", NewRand(42))
+		req, _ := http.NewRequest("POST", "http://lolcathost:9999/", nil)
+		if err := tmpl.Modify(req); err != nil {
+			t.Fatalf("Modify failed: %s", err)
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies[i] = string(body)
+	}
+	if bodies[0] != bodies[1] {
+		t.Fatalf("UUIDs differ with the same seed: %q", bodies)
+	}
+}
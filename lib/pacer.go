@@ -0,0 +1,58 @@
+package vegeta
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// pacer schedules the hits of an attack
+type pacer interface {
+	// offset returns the time of the ith hit since the start of the attack
+	offset(i uint64) time.Duration
+}
+
+// constantPacer paces hits at a constant rate per second
+type constantPacer struct {
+	rate uint64
+}
+
+func (p constantPacer) offset(i uint64) time.Duration {
+	return time.Duration(i * uint64(time.Second) / p.rate)
+}
+
+// rampPacer paces hits at a rate increasing linearly from one rate per
+// second to another over duration
+type rampPacer struct {
+	from, to uint64
+	duration time.Duration
+}
+
+// offset solves hits(t) = i for t, where the number of hits up to t is the
+// integral of the rate: hits(t) = from*t + (to-from)*t²/(2*duration)
+func (p rampPacer) offset(i uint64) time.Duration {
+	from, to, duration := float64(p.from), float64(p.to), p.duration.Seconds()
+	if from == to {
+		return constantPacer{p.from}.offset(i)
+	}
+	a := (to - from) / (2 * duration)
+	t := (-from + math.Sqrt(from*from+4*a*float64(i))) / (2 * a)
+	return time.Duration(t * float64(time.Second))
+}
+
+// poissonPacer paces hits as a Poisson process at a mean rate per second,
+// with exponentially distributed intervals between them drawn from rnd.
+// Its offsets must be asked for in order.
+type poissonPacer struct {
+	rate uint64
+	rnd  *rand.Rand
+	i    uint64        // The last hit whose offset was drawn
+	at   time.Duration // The offset of the last hit
+}
+
+func (p *poissonPacer) offset(i uint64) time.Duration {
+	for ; p.i < i; p.i++ {
+		p.at += time.Duration(p.rnd.ExpFloat64() / float64(p.rate) * float64(time.Second))
+	}
+	return p.at
+}
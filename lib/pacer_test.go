@@ -0,0 +1,66 @@
+package vegeta
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestConstantPacer(t *testing.T) {
+	p := constantPacer{rate: 4}
+	for i, want := range []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond, time.Second} {
+		if got := p.offset(uint64(i)); got != want {
+			t.Errorf("Wrong offset of hit %d: want %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestRampPacer(t *testing.T) {
+	p := rampPacer{from: 10, to: 190, duration: time.Second}
+	hits := uint64(0)
+	for i := uint64(0); p.offset(i) < time.Second; i++ {
+		if i > 0 && p.offset(i) <= p.offset(i-1) {
+			t.Fatalf("Offsets aren't increasing at hit %d", i)
+		}
+		hits++
+	}
+	// The average rate is (10 + 190) / 2 over a second
+	if hits < 99 || hits > 101 {
+		t.Fatalf("Wrong number of hits: want about 100, got %d", hits)
+	}
+	if equal := (rampPacer{from: 4, to: 4, duration: time.Second}); equal.offset(2) != 500*time.Millisecond {
+		t.Fatalf("Ramp between equal rates isn't constant: got %s", equal.offset(2))
+	}
+}
+
+func TestPoissonPacer(t *testing.T) {
+	p := &poissonPacer{rate: 1000, rnd: rand.New(rand.NewSource(1))}
+	const n = 100000
+	offsets := make([]time.Duration, n+1)
+	for i := range offsets {
+		offsets[i] = p.offset(uint64(i))
+	}
+	if offsets[0] != 0 {
+		t.Fatalf("First hit isn't at the start: got %s", offsets[0])
+	}
+	// The mean rate is within 1% of the rate
+	if rate := n / offsets[n].Seconds(); math.Abs(rate-1000) > 10 {
+		t.Fatalf("Wrong mean rate: want about 1000/s, got %.2f/s", rate)
+	}
+	distinct := map[time.Duration]bool{}
+	for i := 1; i <= n; i++ {
+		if offsets[i] < offsets[i-1] {
+			t.Fatalf("Offsets are decreasing at hit %d", i)
+		}
+		distinct[offsets[i]-offsets[i-1]] = true
+	}
+	if len(distinct) < n/2 {
+		t.Fatalf("Intervals aren't random: %d distinct out of %d", len(distinct), n)
+	}
+
+	same := &poissonPacer{rate: 1000, rnd: rand.New(rand.NewSource(1))}
+	if got := same.offset(n); got != offsets[n] {
+		t.Fatalf("Offsets of the same seed differ: want %s, got %s", offsets[n], got)
+	}
+}
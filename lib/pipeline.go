@@ -0,0 +1,410 @@
+package vegeta
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// pipeline is an http.RoundTripper which pipelines the requests of
+// idempotent methods over HTTP/1.1 connections, writing up to depth of them
+// on each connection before their responses are read, in order. The other
+// requests, the ones going through a proxy and all of them without
+// keep-alives are sent by transport. Requests are traced like those of
+// transport, except for the DNS lookups which are part of connecting.
+// Connections are closed once idle for the IdleConnTimeout of transport,
+// if any, or by CloseIdleConnections.
+type pipeline struct {
+	depth     int
+	transport *http.Transport
+	mu        sync.Mutex
+	conns     map[string][]*pipelinedConn // The open connections of each address
+	dialing   map[string]*sync.Mutex      // Held while dialing each address
+}
+
+// newPipeline initializes a pipeline of the given depth over transport
+func newPipeline(depth int, transport *http.Transport) *pipeline {
+	return &pipeline{
+		depth:     depth,
+		transport: transport,
+		conns:     map[string][]*pipelinedConn{},
+		dialing:   map[string]*sync.Mutex{},
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (p *pipeline) RoundTrip(req *http.Request) (*http.Response, error) {
+	if p.transport.DisableKeepAlives || !idempotentMethods[req.Method] || req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return p.transport.RoundTrip(req)
+	}
+	if p.transport.Proxy != nil {
+		if u, err := p.transport.Proxy(req); err != nil || u != nil {
+			return p.transport.RoundTrip(req)
+		}
+	}
+	c, err := p.conn(req)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return c.roundTrip(req)
+}
+
+// conn returns an open connection to the address of req with a free slot,
+// which is taken, dialing a new one when there's none. Connections to an
+// address are dialed one at a time so that concurrent requests fill up their
+// slots, while the requests to the other addresses go on.
+func (p *pipeline) conn(req *http.Request) (*pipelinedConn, error) {
+	addr := canonicalAddr(req)
+	key := req.URL.Scheme + "://" + addr
+	trace := httptrace.ContextClientTrace(req.Context())
+	if trace == nil {
+		trace = &httptrace.ClientTrace{}
+	}
+
+	p.mu.Lock()
+	dialing, ok := p.dialing[key]
+	if !ok {
+		dialing = &sync.Mutex{}
+		p.dialing[key] = dialing
+	}
+	p.mu.Unlock()
+	dialing.Lock()
+	defer dialing.Unlock()
+	if c := p.free(key); c != nil {
+		if trace.GotConn != nil {
+			trace.GotConn(httptrace.GotConnInfo{Conn: c.conn, Reused: true})
+		}
+		return c, nil
+	}
+
+	if trace.ConnectStart != nil {
+		trace.ConnectStart("tcp", addr)
+	}
+	conn, err := p.transport.DialContext(req.Context(), "tcp", addr)
+	if trace.ConnectDone != nil {
+		trace.ConnectDone("tcp", addr, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme == "https" {
+		config := &tls.Config{}
+		if p.transport.TLSClientConfig != nil {
+			config = p.transport.TLSClientConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = req.URL.Hostname()
+		}
+		config.NextProtos = []string{"http/1.1"}
+		tc := tls.Client(conn, config)
+		if trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		err := tc.HandshakeContext(req.Context())
+		if trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(tc.ConnectionState(), err)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	if trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn})
+	}
+	c := &pipelinedConn{
+		conn:    conn,
+		w:       bufio.NewWriter(conn),
+		slots:   make(chan struct{}, p.depth),
+		pending: make(chan *pipelined, p.depth),
+		done:    func(c *pipelinedConn) { p.remove(key, c) },
+	}
+	if d := p.transport.IdleConnTimeout; d > 0 {
+		c.idle = time.AfterFunc(d, func() { p.closeIdle(key, c) })
+		c.idle.Stop()
+		c.idleTimeout = d
+	}
+	c.slots <- struct{}{}
+	go c.readLoop(bufio.NewReader(conn))
+	p.mu.Lock()
+	p.conns[key] = append(p.conns[key], c)
+	p.mu.Unlock()
+	return c, nil
+}
+
+// free returns an open connection to the address of key whose free slot
+// was taken, or nil if there's none
+func (p *pipeline) free(key string) *pipelinedConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns[key] {
+		select {
+		case c.slots <- struct{}{}:
+			return c
+		default:
+		}
+	}
+	return nil
+}
+
+// remove removes the broken connection c to the address of key
+func (p *pipeline) remove(key string, c *pipelinedConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeLocked(key, c)
+}
+
+// removeLocked removes the connection c to the address of key, with p.mu
+// held
+func (p *pipeline) removeLocked(key string, c *pipelinedConn) {
+	conns := p.conns[key]
+	for i := range conns {
+		if conns[i] == c {
+			p.conns[key] = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+}
+
+// closeIdle closes the connection c to the address of key unless one of
+// its slots was taken since it became idle
+func (p *pipeline) closeIdle(key string, c *pipelinedConn) {
+	p.mu.Lock()
+	idle := len(c.slots) == 0 // Slots of listed connections are taken with p.mu held
+	if idle {
+		p.removeLocked(key, c)
+	}
+	p.mu.Unlock()
+	if idle {
+		c.close(errPipelineClosed)
+	}
+}
+
+// CloseIdleConnections closes the pipelined connections without requests
+// in flight, and the idle connections of transport, e.g. once an attack
+// stopped, so that their read loops don't outlive it
+func (p *pipeline) CloseIdleConnections() {
+	p.mu.Lock()
+	idle := []*pipelinedConn{}
+	for key, conns := range p.conns {
+		for _, c := range append([]*pipelinedConn{}, conns...) {
+			if len(c.slots) == 0 {
+				p.removeLocked(key, c)
+				idle = append(idle, c)
+			}
+		}
+	}
+	p.mu.Unlock()
+	for _, c := range idle {
+		c.close(errPipelineClosed)
+	}
+	p.transport.CloseIdleConnections()
+}
+
+// canonicalAddr returns the host:port address of the URL of req, with the
+// default port of its scheme unless it has one
+func canonicalAddr(req *http.Request) string {
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(req.URL.Hostname(), port)
+}
+
+// pipelinedConn is a connection which requests are written to as they
+// come, up to the number of its slots, and whose responses are read in the
+// same order by its read loop
+type pipelinedConn struct {
+	conn    net.Conn
+	mu      sync.Mutex // Serializes the writes of the requests
+	w       *bufio.Writer
+	slots   chan struct{}   // Taken by the requests until their response is read
+	pending chan *pipelined // The written requests waiting for their response
+	done    func(*pipelinedConn)
+	once    sync.Once
+	err     error // Why the connection broke, set before pending is closed
+
+	idle        *time.Timer // Closes the connection once idle, if not nil
+	idleTimeout time.Duration
+}
+
+// release frees the slot of a request whose response was read, arming the
+// idle timer of c if it was the last one taken
+func (c *pipelinedConn) release() {
+	<-c.slots
+	if c.idle != nil && len(c.slots) == 0 {
+		c.idle.Reset(c.idleTimeout)
+	}
+}
+
+// pipelined is a written request waiting for its response
+type pipelined struct {
+	req  *http.Request
+	resp chan *http.Response
+	errc chan error
+}
+
+// errPipelineClosed is the error of the requests whose connection closed
+// before their response was read
+var errPipelineClosed = errors.New("pipelined connection closed before the response")
+
+// roundTrip writes req, in one of the taken slots of c, and waits for its
+// response, or for the cancellation of req which breaks the connection
+func (c *pipelinedConn) roundTrip(req *http.Request) (*http.Response, error) {
+	p := &pipelined{req: req, resp: make(chan *http.Response, 1), errc: make(chan error, 1)}
+	c.mu.Lock()
+	if err := c.err; err != nil { // Broken since its slot was taken
+		c.mu.Unlock()
+		return nil, err
+	}
+	err := req.Write(c.w)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	if err == nil {
+		c.pending <- p
+	}
+	c.mu.Unlock()
+	if err != nil {
+		c.close(err)
+		return nil, err
+	}
+	select {
+	case r := <-p.resp:
+		return r, nil
+	case err := <-p.errc:
+		return nil, err
+	case <-req.Context().Done():
+		c.close(errPipelineClosed) // The others fail as pipelined behind it
+		return nil, req.Context().Err()
+	}
+}
+
+// readLoop reads the responses of the pending requests in order, each
+// once the body of the previous one was read or its request was canceled,
+// until the connection breaks. It waits for the first byte of each response
+// before its request, so that a server closing an idle connection breaks it
+// and the next requests dial a new one. Requests written as the server
+// closes it still fail.
+func (c *pipelinedConn) readLoop(r *bufio.Reader) {
+	for {
+		if _, err := r.Peek(1); err != nil {
+			if err == io.EOF {
+				err = errPipelineClosed
+			}
+			c.close(err)
+			break
+		}
+		p, ok := <-c.pending
+		if !ok {
+			break
+		}
+		if trace := httptrace.ContextClientTrace(p.req.Context()); trace != nil && trace.GotFirstResponseByte != nil {
+			trace.GotFirstResponseByte()
+		}
+		resp, err := http.ReadResponse(r, p.req)
+		if err != nil {
+			c.close(err)
+			p.errc <- err
+			break
+		}
+		ctx := p.req.Context()
+		body := &pipelinedBody{ReadCloser: resp.Body, ctx: ctx, done: make(chan struct{})}
+		if !resp.Close { // Whose connection isn't reused
+			body.release = c.release
+		}
+		resp.Body = body
+		p.resp <- resp
+		if !body.wait() {
+			c.close(errPipelineClosed) // Unblocks the reads of the body
+			break
+		}
+		if resp.Close {
+			c.close(errPipelineClosed)
+			break
+		}
+	}
+	for p := range c.pending { // Written before the connection broke
+		p.errc <- c.err
+	}
+}
+
+// close breaks the connection because of err, failing the requests which
+// are still waiting for their response
+func (c *pipelinedConn) close(err error) {
+	c.once.Do(func() {
+		if c.idle != nil {
+			c.idle.Stop()
+		}
+		c.done(c)
+		c.mu.Lock()
+		c.err = err
+		c.conn.Close()
+		close(c.pending)
+		c.mu.Unlock()
+	})
+}
+
+// pipelinedBody is the body of a pipelined response, which is read to its
+// end when closed so that the next response can be read, and frees the slot
+// of its request. Its reads fail with the error of ctx once it's done.
+type pipelinedBody struct {
+	io.ReadCloser
+	ctx     context.Context // Of the request of the response
+	release func()          // Frees the slot of the request, if not nil
+	once    sync.Once
+	done    chan struct{}
+}
+
+// Read reads the body, failing with the error of its context once done
+func (b *pipelinedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.ctx.Err() != nil {
+		err = b.ctx.Err()
+	}
+	return n, err
+}
+
+// wait waits for the body to be closed and returns true, or returns false
+// if its context is done first
+func (b *pipelinedBody) wait() bool {
+	select {
+	case <-b.done:
+		return true
+	case <-b.ctx.Done():
+		select { // Closed right before its context was canceled
+		case <-b.done:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// Close reads the rest of the body and closes it
+func (b *pipelinedBody) Close() error {
+	io.Copy(ioutil.Discard, b.ReadCloser)
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if b.release != nil {
+			b.release()
+		}
+		close(b.done)
+	})
+	return err
+}
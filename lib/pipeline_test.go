@@ -0,0 +1,287 @@
+package vegeta
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAttackPipeline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		paths := []string{}
+		for len(paths) < 3 { // All of them before responding to any
+			req, err := http.ReadRequest(r)
+			if err != nil {
+				return
+			}
+			paths = append(paths, req.URL.Path)
+		}
+		received <- paths
+		for i, path := range paths {
+			time.Sleep(50 * time.Millisecond) // The later ones wait longer
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nX-Order: %d\r\nContent-Length: %d\r\n\r\n%s", i, len(path), path)
+		}
+	}()
+
+	a := NewAttacker(Pipeline(3), CaptureBodies(8), CaptureHeaders(0, "X-Order"), Timeout(5*time.Second))
+	results := make([]*result, 3)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			request, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/"+strconv.Itoa(i), nil)
+			results[i] = a.hit(request)
+		}(i)
+	}
+	wg.Wait()
+
+	var paths []string
+	select {
+	case paths = <-received:
+	default:
+		t.Fatalf("Requests weren't pipelined on one connection: %+v", results)
+	}
+	byOrder := make([]*result, len(results))
+	for i, r := range results {
+		if r.err != nil || r.code != 200 {
+			t.Fatalf("Pipelined request %d failed: got %d (%v)", i, r.code, r.err)
+		}
+		if want := "/" + strconv.Itoa(i); string(r.body) != want {
+			t.Errorf("Response wasn't correlated to its request: want %s, got %s", want, r.body)
+		}
+		order, _ := strconv.Atoi(r.headers.Get("X-Order"))
+		if paths[order] != string(r.body) {
+			t.Errorf("Wrong response order: %s was received %s", r.body, paths)
+		}
+		// The nth received request waits for the n responses until its own
+		if min := time.Duration(order+1) * 50 * time.Millisecond; r.timing < min {
+			t.Errorf("Timing of pipelined request %d received %dth didn't wait for the ones ahead: want at least %s, got %s", i, order, min, r.timing)
+		}
+		byOrder[order] = r
+	}
+	for i := 1; i < len(byOrder); i++ {
+		if byOrder[i] == nil || byOrder[i-1] == nil {
+			t.Fatalf("Responses weren't received once each: %s", paths)
+		}
+		if byOrder[i].timing <= byOrder[i-1].timing {
+			t.Errorf("Pipelined request received %dth took %s, no longer than the one ahead of it at %s", i, byOrder[i].timing, byOrder[i-1].timing)
+		}
+	}
+}
+
+func TestAttackPipelineNonIdempotent(t *testing.T) {
+	p := newPipeline(3, &http.Transport{})
+	request, _ := http.NewRequest("POST", "http://127.0.0.1:1/", nil)
+	p.RoundTrip(request)
+	if len(p.conns) != 0 {
+		t.Fatalf("Non idempotent request was pipelined: %v", p.conns)
+	}
+}
+
+func TestAttackPipelineRedial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var accepted uint64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddUint64(&accepted, 1)
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					req, err := http.ReadRequest(r)
+					if err != nil {
+						return
+					}
+					fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+					if req.URL.Path == "/close" { // Like an idle timeout, without Connection: close
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	a := NewAttacker(Pipeline(3), Timeout(5*time.Second))
+	hit := func(path string) *result {
+		request, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+path, nil)
+		return a.hit(request)
+	}
+	first, closing := hit("/"), hit("/close")
+	time.Sleep(50 * time.Millisecond)
+	after := hit("/")
+	for i, r := range []*result{first, closing, after} {
+		if r.err != nil || r.code != 200 || r.ttfb <= 0 {
+			t.Fatalf("Request %d failed: got %d with ttfb %s (%v)", i, r.code, r.ttfb, r.err)
+		}
+	}
+	if first.reused || !closing.reused || after.reused {
+		t.Errorf("Wrong reused connections: got %t, %t and %t", first.reused, closing.reused, after.reused)
+	}
+	if first.phases.connect <= 0 {
+		t.Errorf("Connecting wasn't traced: %+v", first.phases)
+	}
+	if n := atomic.LoadUint64(&accepted); n != 2 {
+		t.Errorf("Closed connection wasn't redialed: want 2 connections, got %d", n)
+	}
+}
+
+func TestAttackPipelineBodyTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+			return
+		}
+		fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\npartial")
+		time.Sleep(2 * time.Second) // Stalls the rest of the body
+	}()
+
+	a := NewAttacker(Pipeline(3), Timeout(100*time.Millisecond))
+	request, _ := http.NewRequest("GET", "http://"+ln.Addr().String(), nil)
+	began := time.Now()
+	r := a.hit(request)
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Fatalf("Reading the body ignored the timeout: took %s", elapsed)
+	}
+	if errorCategory(r.err) != errTimeout {
+		t.Fatalf("Wrong error of a stalled body: %v", r.err)
+	}
+}
+
+func TestAttackPipelineCancelOne(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(ioutil.Discard, conn) // Never responds
+	}()
+
+	a := NewAttacker(Pipeline(3), Timeout(5*time.Second))
+	results := make([]*result, 2)
+	var wg sync.WaitGroup
+	for i, timeout := range []time.Duration{50 * time.Millisecond, 0} {
+		wg.Add(1)
+		go func(i int, timeout time.Duration) {
+			defer wg.Done()
+			request, _ := http.NewRequest("GET", "http://"+ln.Addr().String(), nil)
+			if timeout > 0 { // Pipelined on the same connection as the other
+				request = WithTimeout(request, timeout)
+			}
+			results[i] = a.hit(request)
+		}(i, timeout)
+	}
+	wg.Wait()
+
+	if errorCategory(results[0].err) != errTimeout {
+		t.Errorf("Timed out request didn't fail with a timeout: %v", results[0].err)
+	}
+	if results[1].err == nil || errorCategory(results[1].err) == errTimeout {
+		t.Errorf("Request pipelined behind a timed out one failed as a timeout: %v", results[1].err)
+	}
+}
+
+func TestAttackPipelineIdleConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	closed := make(chan struct{}, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := http.ReadRequest(r); err != nil {
+						closed <- struct{}{} // By the client
+						return
+					}
+					fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+				}
+			}()
+		}
+	}()
+	waitClosed := func(what string) {
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatalf("%s connection wasn't closed", what)
+		}
+	}
+
+	a := NewAttacker(Pipeline(3), Timeout(5*time.Second))
+	targets := Targets{&http.Request{Method: "GET", URL: &url.URL{Scheme: "http", Host: ln.Addr().String(), Path: "/"}, Header: http.Header{}}}
+	if _, err := a.AttackTargeter(context.Background(), targets.Targeter(), 100, 50*time.Millisecond, NewTextReporter()); err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	waitClosed("Stopped attack's")
+
+	a.transport.IdleConnTimeout = 50 * time.Millisecond
+	request, _ := http.NewRequest("GET", "http://"+ln.Addr().String(), nil)
+	if r := a.hit(request); r.err != nil {
+		t.Fatalf("Request failed: %s", r.err)
+	}
+	waitClosed("Idle")
+
+	p := newPipeline(3, &http.Transport{DisableKeepAlives: true, DialContext: (&net.Dialer{}).DialContext})
+	if resp, err := p.RoundTrip(request); err != nil {
+		t.Fatalf("Request without keep-alives failed: %s", err)
+	} else {
+		resp.Body.Close()
+	}
+	if len(p.conns) != 0 {
+		t.Fatalf("Request without keep-alives was pipelined: %v", p.conns)
+	}
+}
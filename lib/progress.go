@@ -0,0 +1,82 @@
+package vegeta
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// progressSamples is the number of the most recent timings the rolling
+// percentiles of the progress of an attack are computed over
+const progressSamples = 1000
+
+// progress tracks the results of an attack as they arrive to report on it
+// while it runs. Its memory is bounded by a ring buffer of recent timings.
+type progress struct {
+	method   PercentileMethod // Of the rolling percentiles
+	began    time.Time
+	requests uint64
+	success  uint64
+	recent   []time.Duration
+	next     int // The index of the ring buffer to overwrite next
+}
+
+// newProgress initializes the progress of an attack which began at began,
+// with the rolling percentiles of method
+func newProgress(began time.Time, method PercentileMethod) *progress {
+	return &progress{method: method, began: began, recent: make([]time.Duration, 0, progressSamples)}
+}
+
+// add tracks a result
+func (p *progress) add(res *result) {
+	p.requests++
+	if res.successful() {
+		p.success++
+	}
+	if len(p.recent) < cap(p.recent) {
+		p.recent = append(p.recent, res.timing)
+		return
+	}
+	p.recent[p.next] = res.timing
+	p.next = (p.next + 1) % len(p.recent)
+}
+
+// line returns the progress line at now, e.g.
+//
+//	[5s] reqs=250 success=100.00% p99=12ms
+func (p *progress) line(now time.Time) string {
+	success := 0.0
+	if p.requests > 0 {
+		success = float64(p.success) / float64(p.requests)
+	}
+	timings := append([]time.Duration{}, p.recent...)
+	sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+	return fmt.Sprintf("[%s] reqs=%d success=%.2f%% p99=%s",
+		now.Sub(p.began).Round(time.Second), p.requests, success*100, p.method.percentile(timings, 99))
+}
+
+// watch forwards the results of in to the returned channel, tracking them,
+// and writes the progress line to w every interval of clock until in is
+// closed
+func (p *progress) watch(in <-chan *result, w io.Writer, interval time.Duration, clock Clock) <-chan *result {
+	out := make(chan *result)
+	go func() {
+		defer close(out)
+		ticks, stop := clock.Tick(interval)
+		defer stop()
+		for {
+			select {
+			case res, ok := <-in:
+				if !ok {
+					return
+				}
+				p.add(res)
+				out <- res
+			case now := <-ticks:
+				fmt.Fprintln(w, p.line(now))
+			}
+		}
+	}()
+	return out
+}
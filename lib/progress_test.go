@@ -0,0 +1,67 @@
+package vegeta
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttackProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	out := &bytes.Buffer{}
+	a := NewAttacker(Progress(out, 200*time.Millisecond))
+	if _, err := a.Attack(Targets{request}, 100, time.Second, NewTextReporter()); err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+
+	if out.Len() == 0 {
+		t.Fatal("No progress line was written")
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	format := regexp.MustCompile(`^\[\d+(ms|s)\] reqs=\d+ success=100\.00% p99=[\d.]+[µnm]?s$`)
+	for _, line := range lines {
+		if !format.MatchString(line) {
+			t.Errorf("Wrong progress line: %q", line)
+		}
+	}
+}
+
+func TestProgressRingBuffer(t *testing.T) {
+	p := newProgress(time.Unix(0, 0), NearestRank)
+	for i := 0; i < 2*progressSamples; i++ {
+		timing := time.Second // Older timings roll out of the buffer
+		if i >= progressSamples {
+			timing = time.Millisecond
+		}
+		p.add(&result{code: 200, timing: timing})
+	}
+	if len(p.recent) != progressSamples {
+		t.Fatalf("Ring buffer grew to %d timings", len(p.recent))
+	}
+	if want, got := "[5s] reqs=2000 success=100.00% p99=1ms", p.line(time.Unix(5, 0)); got != want {
+		t.Fatalf("Wrong progress line: want %q, got %q", want, got)
+	}
+}
+
+func TestProgressClock(t *testing.T) {
+	clock := newFakeClock(time.Unix(0, 0))
+	in, out := make(chan *result), &bytes.Buffer{}
+	results := newProgress(clock.Now(), NearestRank).watch(in, out, time.Second, clock)
+
+	in <- &result{code: 200, timing: time.Millisecond}
+	<-results
+	clock.ticks <- time.Unix(5, 0)
+	close(in)
+	for range results {
+	}
+	if want, got := "[5s] reqs=1 success=100.00% p99=1ms\n", out.String(); got != want {
+		t.Fatalf("Wrong progress: want %q, got %q", want, got)
+	}
+}
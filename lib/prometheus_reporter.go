@@ -0,0 +1,166 @@
+package vegeta
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prometheusBuckets are the upper bounds of the latency histogram buckets
+var prometheusBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// PrometheusReporter writes the test results in the Prometheus text
+// exposition format, suitable for the node_exporter textfile collector
+type PrometheusReporter struct {
+	// Metadata labels every sample, e.g. with the name of the run. Its keys
+	// must be valid label names.
+	Metadata map[string]string
+	prefix   string
+	buckets  []uint64 // Non cumulative counts of each latency bucket
+	sum      time.Duration
+	count    uint64
+	success  uint64
+	codes    map[uint64]uint64
+	bytesIn  uint64
+	bytesOut uint64
+	mu       sync.Mutex
+}
+
+// NewPrometheusReporter initializes a PrometheusReporter whose metric
+// names are prefixed with prefix, which defaults to "vegeta_" when empty
+func NewPrometheusReporter(prefix string) *PrometheusReporter {
+	if prefix == "" {
+		prefix = "vegeta_"
+	}
+	return &PrometheusReporter{
+		prefix:  prefix,
+		buckets: make([]uint64, len(prometheusBuckets)+1),
+		codes:   map[uint64]uint64{},
+	}
+}
+
+// Report writes the latency histogram, the requests counter by status code
+// and the success ratio and bytes gauges to out.
+// It returns an error in case of failure.
+func (r *PrometheusReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := bufio.NewWriter(out)
+
+	name := r.prefix + "request_duration_seconds"
+	r.family(w, name, "histogram", "Latency of the requests.")
+	cumulative := uint64(0)
+	for i, count := range r.buckets {
+		cumulative += count
+		le := "+Inf"
+		if i < len(prometheusBuckets) {
+			le = strconv.FormatFloat(prometheusBuckets[i].Seconds(), 'g', -1, 64)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, r.labels("le", le), cumulative)
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, r.labels(), strconv.FormatFloat(r.sum.Seconds(), 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, r.labels(), r.count)
+
+	name = r.prefix + "requests_total"
+	r.family(w, name, "counter", "Number of requests by status code.")
+	codes := make([]uint64, 0, len(r.codes))
+	for code := range r.codes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		fmt.Fprintf(w, "%s%s %d\n", name, r.labels("code", strconv.FormatUint(code, 10)), r.codes[code])
+	}
+
+	ratio := 0.0
+	if r.count > 0 {
+		ratio = float64(r.success) / float64(r.count)
+	}
+	name = r.prefix + "success_ratio"
+	r.family(w, name, "gauge", "Ratio of successful (2xx and valid) responses.")
+	fmt.Fprintf(w, "%s%s %s\n", name, r.labels(), strconv.FormatFloat(ratio, 'g', -1, 64))
+
+	name = r.prefix + "bytes_in"
+	r.family(w, name, "gauge", "Total number of bytes received.")
+	fmt.Fprintf(w, "%s%s %d\n", name, r.labels(), r.bytesIn)
+
+	name = r.prefix + "bytes_out"
+	r.family(w, name, "gauge", "Total number of bytes sent.")
+	fmt.Fprintf(w, "%s%s %d\n", name, r.labels(), r.bytesOut)
+
+	return w.Flush()
+}
+
+// family writes the HELP and TYPE lines of a metric family
+func (r *PrometheusReporter) family(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labels returns the label set of a sample with the passed label name and
+// value pairs followed by the Metadata, sorted by key, or nothing when empty
+func (r *PrometheusReporter) labels(pairs ...string) string {
+	keys := make([]string, 0, len(r.Metadata))
+	for key := range r.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pairs = append(pairs, key, r.Metadata[key])
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		labels = append(labels, fmt.Sprintf("%s=%q", pairs[i], pairs[i+1]))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// add aggregates a response into the metrics
+// Order of arrival is not relevant for this reporter
+func (r *PrometheusReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.Search(len(prometheusBuckets), func(i int) bool { return res.timing <= prometheusBuckets[i] })
+	r.buckets[i]++
+	r.sum += res.timing
+	r.count++
+	r.codes[res.code]++
+	r.bytesIn += res.bytesIn
+	r.bytesOut += res.bytesOut
+	if res.successful() {
+		r.success++
+	}
+	return nil
+}
+
+// Reset clears the aggregated metrics
+func (r *PrometheusReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.buckets {
+		r.buckets[i] = 0
+	}
+	for code := range r.codes {
+		delete(r.codes, code)
+	}
+	r.sum, r.count, r.success, r.bytesIn, r.bytesOut = 0, 0, 0, 0, 0
+}
@@ -0,0 +1,103 @@
+package vegeta
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	promComment = regexp.MustCompile(`^# (HELP|TYPE) ([a-zA-Z_:][a-zA-Z0-9_:]*) (.+)$`)
+	promSample  = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{([a-zA-Z_][a-zA-Z0-9_]*="[^"]*",?)*\})? (\S+)$`)
+)
+
+func TestPrometheusReporter(t *testing.T) {
+	rep := NewPrometheusReporter("")
+	rep.add(&result{code: 200, timing: 3 * time.Millisecond, bytesIn: 10})
+	rep.add(&result{code: 200, timing: 300 * time.Millisecond, bytesIn: 10})
+	rep.add(&result{code: 500, timing: 20 * time.Second, bytesOut: 5})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+
+	types := map[string]string{}
+	samples := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if m := promComment.FindStringSubmatch(line); m != nil {
+			if m[1] == "TYPE" {
+				types[m[2]] = m[3]
+			}
+			continue
+		}
+		m := promSample.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("Invalid exposition line: %s", line)
+		}
+		family := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(m[1], "_bucket"), "_sum"), "_count")
+		if _, ok := types[family]; !ok {
+			t.Fatalf("Sample without a preceding TYPE line: %s", line)
+		}
+		samples[m[1]+m[2]] = m[4]
+	}
+
+	for family, typ := range map[string]string{
+		"vegeta_request_duration_seconds": "histogram",
+		"vegeta_requests_total":           "counter",
+		"vegeta_success_ratio":            "gauge",
+		"vegeta_bytes_in":                 "gauge",
+		"vegeta_bytes_out":                "gauge",
+	} {
+		if types[family] != typ {
+			t.Errorf("Wrong type of %s: want %s, got %s", family, typ, types[family])
+		}
+	}
+	for sample, value := range map[string]string{
+		`vegeta_request_duration_seconds_bucket{le="0.005"}`: "1",
+		`vegeta_request_duration_seconds_bucket{le="0.5"}`:   "2",
+		`vegeta_request_duration_seconds_bucket{le="+Inf"}`:  "3",
+		`vegeta_request_duration_seconds_count`:              "3",
+		`vegeta_requests_total{code="200"}`:                  "2",
+		`vegeta_requests_total{code="500"}`:                  "1",
+		`vegeta_bytes_in`:                                    "20",
+		`vegeta_bytes_out`:                                   "5",
+	} {
+		if samples[sample] != value {
+			t.Errorf("Wrong value of %s: want %s, got %s", sample, value, samples[sample])
+		}
+	}
+}
+
+func TestPrometheusReporterPrefix(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := NewPrometheusReporter("lt_").Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if !strings.Contains(out.String(), "lt_success_ratio 0\n") {
+		t.Fatalf("Prefix wasn't applied. Got: %s", out)
+	}
+}
+
+func TestPrometheusReporterMetadata(t *testing.T) {
+	rep := NewPrometheusReporter("")
+	rep.Metadata = map[string]string{"run": "nightly", "commit": "8f3a2c1"}
+	rep.add(&result{code: 200, timing: time.Millisecond})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	for _, want := range []string{
+		`vegeta_request_duration_seconds_bucket{le="0.005",commit="8f3a2c1",run="nightly"} 1` + "\n",
+		`vegeta_request_duration_seconds_count{commit="8f3a2c1",run="nightly"} 1` + "\n",
+		`vegeta_requests_total{code="200",commit="8f3a2c1",run="nightly"} 1` + "\n",
+		`vegeta_success_ratio{commit="8f3a2c1",run="nightly"} 1` + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Missing %q in:\n%s", want, out)
+		}
+	}
+}
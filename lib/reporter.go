@@ -4,8 +4,29 @@ import (
 	"io"
 )
 
-// Reporter represents any reporter of the results of the test
+// Reporter represents any reporter of the results of the test.
+// Reporters which stream results as they arrive return their failures
+// from add, after which no more results are added to them.
+// Reset clears the results added to a reporter so it can be reused by
+// another attack. Report after Reset behaves like that of a fresh reporter.
+// All the methods of a reporter are safe for concurrent use, so results
+// can be added to it from several goroutines, even while it reports.
 type Reporter interface {
 	Report(io.Writer) error
-	add(res *result)
+	Reset()
+	add(res *result) error
+}
+
+// Flusher is implemented by the Reporters which buffer what they stream as
+// results arrive. Attacks flush them once they complete or are stopped, so
+// that nothing streamed is lost, and return the error of Flush, if any.
+type Flusher interface {
+	Flush() error
+}
+
+// detailedReporter is implemented by the Reporters which detail every
+// result they're added, e.g. csv, rather than aggregate them. They're the
+// only ones sampled by the attacks with the Sample option.
+type detailedReporter interface {
+	detailed()
 }
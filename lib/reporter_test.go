@@ -0,0 +1,135 @@
+package vegeta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testReporters returns the constructors of every reporter by name
+func testReporters() map[string]func() Reporter {
+	return map[string]func() Reporter{
+		"text":       func() Reporter { return NewTextReporter() },
+		"json":       func() Reporter { return NewJSONReporter() },
+		"jsonlines":  func() Reporter { return NewJSONLinesReporter(ioutil.Discard) },
+		"csv":        func() Reporter { return NewCSVReporter() },
+		"influx":     func() Reporter { return NewInfluxReporter() },
+		"prometheus": func() Reporter { return NewPrometheusReporter("") },
+		"histogram":  func() Reporter { return NewHistogramReporter([]time.Duration{10 * time.Millisecond}) },
+		"auto":       func() Reporter { return NewAutoHistogramReporter(3, false) },
+		"throughput": func() Reporter { return NewThroughputReporter(time.Second) },
+		"bodies":     func() Reporter { return NewBodiesReporter() },
+		"results":    func() Reporter { return NewResultsReporter() },
+		"plot":       func() Reporter { return NewTimingsPlotReporter() },
+		"html":       func() Reporter { return NewHTMLReporter() },
+		"summary":    func() Reporter { return NewSummaryReporter() },
+	}
+}
+
+func TestReportersReset(t *testing.T) {
+	began := time.Unix(1375351200, 0).UTC()
+	first := []*result{
+		{code: 500, timestamp: began, timing: time.Second, bytesIn: 100, err: errors.New("Internal Server Error")},
+		{code: 404, timestamp: began.Add(10 * time.Second), timing: 2 * time.Second, err: errors.New("Not Found")},
+	}
+	second := []*result{
+		{code: 200, timestamp: began.Add(time.Minute), timing: time.Millisecond, bytesIn: 10},
+		{code: 200, timestamp: began.Add(time.Minute + time.Second), timing: 3 * time.Millisecond, bytesIn: 10},
+	}
+
+	for name, newReporter := range testReporters() {
+		fresh, reused := newReporter(), newReporter()
+		for _, res := range first {
+			reused.add(res)
+		}
+		if err := reused.Report(&bytes.Buffer{}); err != nil {
+			t.Fatalf("%s: Report failed: %s", name, err)
+		}
+		reused.Reset()
+		for _, res := range second {
+			fresh.add(res)
+			reused.add(res)
+		}
+
+		want, got := &bytes.Buffer{}, &bytes.Buffer{}
+		if err := fresh.Report(want); err != nil {
+			t.Fatalf("%s: Report failed: %s", name, err)
+		}
+		if err := reused.Report(got); err != nil {
+			t.Fatalf("%s: Report failed: %s", name, err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%s: Report after Reset differs from a fresh one:\nwant %s\ngot  %s", name, want, got)
+		}
+	}
+}
+
+func TestReportersConcurrentAdd(t *testing.T) {
+	began := time.Unix(1375351200, 0).UTC()
+	results := make([]*result, 0, 100*100)
+	for i := 0; i < cap(results); i++ {
+		results = append(results, &result{
+			code:      uint64(200 + 100*(i%4)),
+			timestamp: began.Add(time.Duration(i) * time.Millisecond),
+			timing:    time.Duration(i%50) * time.Millisecond,
+			err:       fmt.Errorf("error %d", i%3),
+		})
+	}
+
+	for name, newReporter := range testReporters() {
+		sequential, concurrent := newReporter(), newReporter()
+		for _, res := range results {
+			sequential.add(res)
+		}
+		var wg sync.WaitGroup
+		for g := 0; g < 100; g++ {
+			wg.Add(1)
+			go func(batch []*result) {
+				defer wg.Done()
+				for _, res := range batch {
+					concurrent.add(res)
+				}
+			}(results[g*100 : (g+1)*100])
+		}
+		wg.Wait()
+
+		// Only the order of the lines of the reports may differ
+		want, got := reportLines(t, sequential), reportLines(t, concurrent)
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: Report of concurrent adds differs from sequential ones", name)
+		}
+	}
+
+	rep := NewTextReporter()
+	var wg sync.WaitGroup
+	for g := 0; g < 100; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				rep.add(&result{code: 200})
+			}
+		}()
+	}
+	wg.Wait()
+	if rep.agg.m.Requests != 10000 {
+		t.Fatalf("Concurrent adds were lost: want 10000, got %d", rep.agg.m.Requests)
+	}
+}
+
+// reportLines returns the sorted lines of the report of rep
+func reportLines(t *testing.T, rep Reporter) []string {
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	sort.Strings(lines)
+	return lines
+}
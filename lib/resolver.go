@@ -0,0 +1,98 @@
+package vegeta
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// pinnedHosts resolves each host once, with the resolver of the dialer it
+// dials with, and reuses its first address for all the later connections.
+// Concurrent dials to a host share its resolution, which doesn't hold up the
+// dials to the other hosts.
+type pinnedHosts struct {
+	mu    sync.Mutex
+	hosts map[string]*pinnedHost // The resolved or resolving hosts
+}
+
+// pinnedHost is the resolution of a host, whose address or error is set
+// before done is closed
+type pinnedHost struct {
+	done chan struct{}
+	ip   string
+	err  error
+}
+
+// newPinnedHosts initializes pinnedHosts with no resolved hosts
+func newPinnedHosts() *pinnedHosts {
+	return &pinnedHosts{hosts: map[string]*pinnedHost{}}
+}
+
+// dial dials addr with d, resolving its host unless it's already pinned or
+// being resolved by another dial, whose resolution it waits for. Failed
+// resolutions aren't pinned, so they're retried by the next dial.
+func (p *pinnedHosts) dial(ctx context.Context, d *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.DialContext(ctx, network, addr)
+	}
+	p.mu.Lock()
+	h, ok := p.hosts[host]
+	if !ok {
+		h = &pinnedHost{done: make(chan struct{})}
+		p.hosts[host] = h
+	}
+	p.mu.Unlock()
+	if ok {
+		select {
+		case <-h.done:
+		case <-ctx.Done():
+			return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+		}
+	} else {
+		p.resolve(ctx, d, host, h)
+	}
+	if h.err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: h.err}
+	}
+	return d.DialContext(ctx, network, net.JoinHostPort(h.ip, port))
+}
+
+// resolve resolves host with the resolver of d into h, forgetting it on
+// failure
+func (p *pinnedHosts) resolve(ctx context.Context, d *net.Dialer, host string, h *pinnedHost) {
+	defer close(h.done)
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	switch {
+	case err != nil:
+		h.err = err
+	case len(addrs) == 0:
+		h.err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	default:
+		h.ip = addrs[0].String()
+		return
+	}
+	p.mu.Lock()
+	delete(p.hosts, host)
+	p.mu.Unlock()
+}
+
+// newResolver returns a resolver which queries the DNS server at addr, on
+// port 53 unless it has one
+func newResolver(addr string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	d := &net.Dialer{Timeout: 5 * time.Second}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
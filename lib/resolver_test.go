@@ -0,0 +1,166 @@
+package vegeta
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveDNS answers the A queries received on conn with 127.0.0.1 and the
+// others with no records, counting them in queries
+func serveDNS(conn net.PacketConn, queries *uint64) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		atomic.AddUint64(queries, 1)
+		end := 12 // The end of the question, after the header
+		for end < n && buf[end] != 0 {
+			end += int(buf[end]) + 1
+		}
+		end += 5 // The root label, type and class
+		if end > n {
+			continue
+		}
+		msg := append([]byte{}, buf[:end]...)
+		msg[2], msg[3] = 0x81, 0x80 // A recursive response without errors
+		msg[6], msg[7] = 0, 0       // No answers
+		msg[8], msg[9], msg[10], msg[11] = 0, 0, 0, 0
+		if qtype := int(buf[end-4])<<8 | int(buf[end-3]); qtype == 1 {
+			msg[7] = 1
+			msg = append(msg,
+				0xc0, 12, // The name of the question
+				0, 1, 0, 1, // Type A, class IN
+				0, 0, 0, 60, // TTL
+				0, 4, 127, 0, 0, 1,
+			)
+		}
+		conn.WriteTo(msg, addr)
+	}
+}
+
+func TestAttackResolver(t *testing.T) {
+	dns, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dns.Close()
+	var queries uint64
+	go serveDNS(dns, &queries)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	url := "http://vegeta.test:" + port + "/"
+
+	for _, pinned := range []bool{false, true} {
+		atomic.StoreUint64(&queries, 0)
+		a := NewAttacker(Resolver(dns.LocalAddr().String()), PinDNS(pinned), KeepAlive(false))
+		var first uint64
+		for i := 0; i < 3; i++ {
+			request, _ := http.NewRequest("GET", url, nil)
+			r := a.hit(request)
+			if r.err != nil || r.code != 200 {
+				t.Fatalf("Request resolved by the resolver failed: got %d (%v)", r.code, r.err)
+			}
+			if i == 0 {
+				first = atomic.LoadUint64(&queries)
+				if first == 0 || r.phases.dns <= 0 {
+					t.Fatalf("Resolver wasn't queried: %d queries in %s", first, r.phases.dns)
+				}
+			} else if pinned && r.phases.dns != 0 {
+				t.Errorf("Pinned host was resolved again in %s", r.phases.dns)
+			}
+		}
+		want := 3 * first
+		if pinned {
+			want = first
+		}
+		if got := atomic.LoadUint64(&queries); got != want {
+			t.Errorf("Wrong number of queries with pinned=%t: want %d, got %d", pinned, want, got)
+		}
+	}
+}
+
+func TestPinnedHostsConcurrentDials(t *testing.T) {
+	dns, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dns.Close()
+	var queries uint64
+	go serveDNS(dns, &queries)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// The lookups wait for release, once one of them queries the resolver
+	dialing, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	d := &net.Dialer{Resolver: &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			once.Do(func() { close(dialing) })
+			<-release
+			return (&net.Dialer{}).DialContext(ctx, network, dns.LocalAddr().String())
+		},
+	}}
+	p := newPinnedHosts()
+	pinned := &pinnedHost{done: make(chan struct{}), ip: "127.0.0.1"}
+	close(pinned.done)
+	p.hosts["pinned.test"] = pinned
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := p.dial(context.Background(), d, "tcp", "vegeta.test:"+port)
+			if err == nil {
+				conn.Close()
+			}
+			errs <- err
+		}()
+	}
+	<-dialing
+
+	// The resolution of vegeta.test doesn't hold up the other hosts
+	done := make(chan error, 1)
+	go func() {
+		conn, err := p.dial(context.Background(), d, "tcp", "pinned.test:"+port)
+		if err == nil {
+			conn.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Dial to a pinned host failed: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Dial to a pinned host waited for the resolution of another")
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Concurrent dial failed: %s", err)
+		}
+	}
+	// One lookup of both A and AAAA records, shared by all the dials
+	if got := atomic.LoadUint64(&queries); got > 2 {
+		t.Errorf("Concurrent dials weren't deduplicated: %d queries", got)
+	}
+}
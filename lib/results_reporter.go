@@ -0,0 +1,240 @@
+package vegeta
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ResultsReporter writes the raw results of the test as JSON lines, one
+// object per response, so that they can be merged and reported later on
+// with Merge. The encoding is lossless.
+type ResultsReporter struct {
+	responses []*result
+	live      *json.Encoder // Where results are written as they arrive, if set
+	mu        sync.Mutex
+}
+
+// NewResultsReporter initializes a ResultsReporter with no responses
+func NewResultsReporter() *ResultsReporter {
+	return &ResultsReporter{responses: make([]*result, 0)}
+}
+
+// NewLiveResultsReporter initializes a ResultsReporter which writes each
+// result to w as soon as it arrives instead of retaining it.
+// Write failures are returned during the attack and Report writes nothing.
+func NewLiveResultsReporter(w io.Writer) *ResultsReporter {
+	return &ResultsReporter{live: json.NewEncoder(w)}
+}
+
+// Report writes a line per response to out in order of arrival.
+// It returns an error in case of failure.
+func (r *ResultsReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	for _, res := range r.responses {
+		if err := enc.Encode(encodeResult(res)); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// add adds a response to be used in the report, or writes it right away
+// in live mode
+func (r *ResultsReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.live != nil {
+		return r.live.Encode(encodeResult(res))
+	}
+	r.responses = append(r.responses, res)
+	return nil
+}
+
+func (r *ResultsReporter) detailed() {}
+
+// Reset clears the responses
+func (r *ResultsReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = r.responses[:0]
+}
+
+// jsonResult is the encoding of a result written by the ResultsReporter
+type jsonResult struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Code      uint64        `json:"code"`
+	Latency   time.Duration `json:"latency"`
+	TTFB      time.Duration `json:"ttfb,omitempty"`
+	BytesOut  uint64        `json:"bytes_out"`
+	BytesIn   uint64        `json:"bytes_in"`
+	BytesWire uint64        `json:"bytes_wire,omitempty"`
+	Error     string        `json:"error"`
+	Category  string        `json:"error_category,omitempty"`
+	ConnFail  bool          `json:"connection_failure,omitempty"`
+	Redirects uint64        `json:"redirects,omitempty"`
+	Reused    bool          `json:"reused,omitempty"`
+	Delayed   bool          `json:"delayed,omitempty"`
+	Proto     string        `json:"proto,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Proxied   bool          `json:"proxied,omitempty"`
+	Attempts  uint64        `json:"attempts,omitempty"`
+	OK        *bool         `json:"ok,omitempty"` // Set by the OK codes of the attack
+	URL       string        `json:"url,omitempty"`
+	DNS       time.Duration `json:"dns,omitempty"`
+	Connect   time.Duration `json:"connect,omitempty"`
+	TLS       time.Duration `json:"tls,omitempty"`
+	Wait      time.Duration `json:"wait,omitempty"`
+	Transfer  time.Duration `json:"transfer,omitempty"`
+	Body      []byte        `json:"body,omitempty"`
+	Headers   http.Header   `json:"headers,omitempty"`
+}
+
+// encodeResult returns the encoding of res
+func encodeResult(res *result) *jsonResult {
+	enc := &jsonResult{
+		Timestamp: res.timestamp,
+		Code:      res.code,
+		Latency:   res.timing,
+		TTFB:      res.ttfb,
+		BytesOut:  res.bytesOut,
+		BytesIn:   res.bytesIn,
+		BytesWire: res.bytesWire,
+		Redirects: res.redirects,
+		Reused:    res.reused,
+		Delayed:   res.delayed,
+		Proto:     res.proto,
+		Truncated: res.truncated,
+		Proxied:   res.proxied,
+		Attempts:  res.attempts,
+		URL:       res.url,
+		DNS:       res.phases.dns,
+		Connect:   res.phases.connect,
+		TLS:       res.phases.tls,
+		Wait:      res.phases.wait,
+		Transfer:  res.phases.transfer,
+		Body:      res.body,
+		Headers:   res.headers,
+	}
+	if res.outcome != byStatus {
+		ok := res.outcome == okCode
+		enc.OK = &ok
+	}
+	if res.err != nil {
+		enc.Error, enc.Category = res.err.Error(), errorCategory(res.err)
+		enc.ConnFail = connectionError(res.err)
+	}
+	return enc
+}
+
+// decode returns the result of the encoding
+func (enc *jsonResult) decode() *result {
+	res := &result{
+		timestamp: enc.Timestamp,
+		code:      enc.Code,
+		timing:    enc.Latency,
+		ttfb:      enc.TTFB,
+		bytesOut:  enc.BytesOut,
+		bytesIn:   enc.BytesIn,
+		bytesWire: enc.BytesWire,
+		redirects: enc.Redirects,
+		reused:    enc.Reused,
+		delayed:   enc.Delayed,
+		proto:     enc.Proto,
+		truncated: enc.Truncated,
+		proxied:   enc.Proxied,
+		attempts:  enc.Attempts,
+		url:       enc.URL,
+		phases: phases{
+			dns:      enc.DNS,
+			connect:  enc.Connect,
+			tls:      enc.TLS,
+			wait:     enc.Wait,
+			transfer: enc.Transfer,
+		},
+		body:    enc.Body,
+		headers: enc.Headers,
+	}
+	if enc.Error != "" {
+		res.err = decodeError(enc.Error, enc.Category, enc.ConnFail)
+	}
+	if enc.OK != nil {
+		res.outcome = notOKCode
+		if *enc.OK {
+			res.outcome = okCode
+		}
+	}
+	if u, err := url.Parse(enc.URL); err == nil {
+		res.host = u.Host
+	}
+	return res
+}
+
+// decodeError returns the error of the message msg and the category of
+// errorCategory, which is categorized as the encoded error was and is a
+// connection failure if connection
+func decodeError(msg, category string, connection bool) error {
+	if connection {
+		return &categorizedError{msg: msg, category: category, connection: true}
+	}
+	switch category {
+	case errValidation:
+		return validationError(msg)
+	case errHandshake:
+		return handshakeError(msg)
+	case "", errOther:
+		return errors.New(msg)
+	}
+	return &categorizedError{msg: msg, category: category}
+}
+
+// Merge reads the results written by ResultsReporters to each of ins,
+// e.g. by the attackers of several machines, and adds them all to rep.
+// Timestamps are preserved, so time based reporters work across inputs.
+// It returns the aggregated Metrics of all the results or the first
+// error of decoding them or of rep.
+func Merge(rep Reporter, ins ...io.Reader) (*Metrics, error) {
+	return MergePercentiles(NearestRank, rep, ins...)
+}
+
+// MergePercentiles is like Merge but computes the latency percentiles of
+// the returned Metrics with method.
+func MergePercentiles(method PercentileMethod, rep Reporter, ins ...io.Reader) (*Metrics, error) {
+	results := make(chan *result)
+	var err error
+	go func() {
+		defer close(results)
+		for _, in := range ins {
+			if err = decodeResults(in, results); err != nil {
+				return
+			}
+		}
+	}()
+	m, rerr := collect(results, rep, window{}, 0, method, hdrDigits)
+	if err != nil {
+		return nil, err
+	}
+	return m, rerr
+}
+
+// decodeResults sends each result read from in to results
+func decodeResults(in io.Reader, results chan<- *result) error {
+	dec := json.NewDecoder(in)
+	for {
+		var enc jsonResult
+		if err := dec.Decode(&enc); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		results <- enc.decode()
+	}
+}
@@ -0,0 +1,171 @@
+package vegeta
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestResultsReporterRoundTrip(t *testing.T) {
+	began := time.Unix(1375351200, 123456789).UTC()
+	want := []*result{
+		{code: 200, timestamp: began, timing: 12345678 * time.Nanosecond, bytesOut: 10, bytesIn: 251, bytesWire: 120, redirects: 2, reused: true, proto: "HTTP/2.0",
+			phases: phases{dns: 1, connect: 2, tls: 3, wait: 4, transfer: 5}},
+		{code: 503, timestamp: began.Add(time.Nanosecond), timing: time.Second, delayed: true, truncated: true, proxied: true, attempts: 3, url: "http://lolcathost:9999/?q=1", host: "lolcathost:9999", outcome: notOKCode,
+			body: []byte("overloaded"), err: errors.New("Service Unavailable: \"retry\"\n")},
+		{code: 404, timestamp: began.Add(time.Second), outcome: okCode},
+		{code: 0, timestamp: began.Add(time.Minute), err: errors.New("dial tcp: connection refused")},
+		{code: 200, timestamp: began.Add(time.Hour), err: validationError("body doesn't match ok")},
+	}
+
+	for name, encode := range map[string]func([]*result) (*bytes.Buffer, error){
+		"report": func(results []*result) (*bytes.Buffer, error) {
+			out, rep := &bytes.Buffer{}, NewResultsReporter()
+			for _, res := range results {
+				rep.add(res)
+			}
+			return out, rep.Report(out)
+		},
+		"live": func(results []*result) (*bytes.Buffer, error) {
+			out := &bytes.Buffer{}
+			rep := NewLiveResultsReporter(out)
+			for _, res := range results {
+				if err := rep.add(res); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		},
+	} {
+		out, err := encode(want)
+		if err != nil {
+			t.Fatalf("%s: Encoding failed: %s", name, err)
+		}
+		done := make(chan error, 1)
+		got := []*result{}
+		results := make(chan *result)
+		go func() {
+			defer close(results)
+			done <- decodeResults(out, results)
+		}()
+		for res := range results {
+			got = append(got, res)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("%s: Decoding failed: %s", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Wrong decoded results:\nwant %+v\ngot  %+v", name, want, got)
+		}
+	}
+}
+
+func TestResultsReporterErrorCategories(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	errs := []error{
+		&url.Error{Op: "Get", URL: "http://lolcathost", Err: timeoutError{}},
+		&url.Error{Op: "Get", URL: "http://lolcathost", Err: refused},
+		&net.DNSError{Err: "no such host", Name: "lolcathost"},
+		x509.UnknownAuthorityError{},
+		&readError{n: 10, err: io.ErrUnexpectedEOF},
+		handshakeError("unexpected status code 200"),
+		validationError("body doesn't match ok"),
+		errors.New("Internal Server Error"),
+	}
+	rep := NewResultsReporter()
+	for _, err := range errs {
+		rep.add(&result{err: err})
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	m, err := Merge(NewSummaryReporter(), out)
+	if err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	}
+	for _, err := range errs {
+		if category := errorCategory(err); m.ErrorCategories[category] != 1 {
+			t.Errorf("Category %s of %q wasn't decoded: got %v", category, err, m.ErrorCategories)
+		}
+		if m.ErrorCounts[err.Error()] != 1 {
+			t.Errorf("Message of %q wasn't decoded: got %v", err, m.Errors)
+		}
+	}
+}
+
+func TestResultsReporterConnectionFailures(t *testing.T) {
+	results := []*result{
+		{err: &url.Error{Op: "Get", URL: "http://lolcathost", Err: &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}}},
+		{err: &url.Error{Op: "Get", URL: "http://lolcathost", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}},
+		{err: &url.Error{Op: "Get", URL: "http://lolcathost", Err: &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}}},
+		{code: 200},
+	}
+	live := newStreamingAggregator(hdrDigits)
+	rep := NewResultsReporter()
+	for _, res := range results {
+		live.add(res)
+		rep.add(res)
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	merged, err := Merge(NewSummaryReporter(), out)
+	if err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	}
+	if got := live.metrics(NearestRank).Failures; got != 2 || merged.Failures != got {
+		t.Fatalf("Connection failures weren't decoded: want 2, got %d live and %d merged", got, merged.Failures)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	began := time.Unix(1375351200, 0).UTC()
+	nodes := make([]io.Reader, 2)
+	for i := range nodes {
+		rep := NewResultsReporter()
+		for j := 0; j < 5+i; j++ { // Disjoint timestamp ranges
+			rep.add(&result{
+				code:      200,
+				timestamp: began.Add(time.Duration(10*i+j) * time.Second),
+				timing:    time.Millisecond,
+			})
+		}
+		rep.add(&result{code: 500, timestamp: began.Add(time.Duration(10*i+9) * time.Second), err: errors.New("Internal Server Error")})
+		out := &bytes.Buffer{}
+		if err := rep.Report(out); err != nil {
+			t.Fatalf("Report failed: %s", err)
+		}
+		nodes[i] = out
+	}
+
+	rep := NewThroughputReporter(time.Second)
+	m, err := Merge(rep, nodes...)
+	if err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	}
+	if want := uint64(6 + 7); m.Requests != want {
+		t.Fatalf("Wrong number of merged requests: want %d, got %d", want, m.Requests)
+	}
+	if m.StatusCodes[500] != 2 || len(m.Errors) != 1 || m.Errors[0] != "Internal Server Error" {
+		t.Fatalf("Wrong merged errors: %v %v", m.StatusCodes, m.Errors)
+	}
+	if first, last := rep.bounds(); last-first != 19 {
+		t.Fatalf("Timestamps weren't preserved: want 20 windows, got %d", last-first+1)
+	}
+}
+
+func TestMergeInvalidInput(t *testing.T) {
+	if _, err := Merge(NewTextReporter(), bytes.NewBufferString("{\"code\": 200}\nnot json\n")); err == nil {
+		t.Fatal("Invalid input didn't fail")
+	}
+}
@@ -0,0 +1,52 @@
+package vegeta
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy describes how failed hits of idempotent requests are retried
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts of each request,
+	// including the first one. Less than two means no retries.
+	Attempts int
+	// Backoff is the wait before the first retry, doubled on every retry
+	Backoff time.Duration
+	// Jitter is the fraction of each wait, between 0 and 1, which is
+	// randomized to spread the retries of concurrent requests
+	Jitter float64
+	// ServerErrors enables retrying 5xx responses, besides the
+	// connection-level errors which are always retried
+	ServerErrors bool
+}
+
+// idempotentMethods are the methods of the requests which are retried
+var idempotentMethods = map[string]bool{
+	"GET": true, "HEAD": true, "OPTIONS": true, "TRACE": true, "PUT": true, "DELETE": true,
+}
+
+// retry returns whether the attempt of req which returned r and err is
+// to be retried
+func (p RetryPolicy) retry(req *http.Request, r *http.Response, err error, attempt int) bool {
+	if attempt >= p.Attempts || !idempotentMethods[req.Method] || req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false // The body can't be sent again, e.g. a stream
+	}
+	if err != nil {
+		return true
+	}
+	return p.ServerErrors && r.StatusCode >= 500
+}
+
+// backoff returns the wait before the retry following attempt, randomized
+// with rnd
+func (p RetryPolicy) backoff(attempt int, rnd *rand.Rand) time.Duration {
+	d := p.Backoff << uint(attempt-1)
+	if jitter := time.Duration(p.Jitter * float64(d)); jitter > 0 {
+		d += time.Duration(rnd.Int63n(int64(jitter))) - jitter/2
+	}
+	return d
+}
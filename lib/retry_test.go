@@ -0,0 +1,70 @@
+package vegeta
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAttackRetry(t *testing.T) {
+	var hits uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint64(&hits, 1) == 1 { // Drop the first connection
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	a := NewAttacker(Retry(RetryPolicy{Attempts: 3, Backoff: time.Millisecond}))
+	if r := a.hit(request); r.err != nil || r.code != 200 || r.attempts != 2 {
+		t.Fatalf("Wrong retried result: want 200 after 2 attempts, got %d after %d (%v)", r.code, r.attempts, r.err)
+	}
+
+	atomic.StoreUint64(&hits, 0)
+	request, _ = http.NewRequest("POST", server.URL, strings.NewReader("body"))
+	if r := a.hit(request); r.err == nil || r.attempts != 1 {
+		t.Fatalf("Non idempotent request was retried: %d attempts (%v)", r.attempts, r.err)
+	}
+}
+
+func TestAttackRetryServerErrors(t *testing.T) {
+	var hits uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint64(&hits, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	for enabled, want := range map[bool]uint64{false: 503, true: 200} {
+		atomic.StoreUint64(&hits, 0)
+		a := NewAttacker(Retry(RetryPolicy{Attempts: 2, ServerErrors: enabled}))
+		if r := a.hit(request); r.code != want {
+			t.Errorf("Wrong code with 5xx retries %t: want %d, got %d", enabled, want, r.code)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, Jitter: 0.5}
+	for attempt, base := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond} {
+		for i := 0; i < 100; i++ {
+			if d := p.backoff(attempt, NewRand(0)); d < base*3/4 || d > base*5/4 {
+				t.Fatalf("Backoff of attempt %d out of bounds: %s", attempt, d)
+			}
+		}
+	}
+}
+
+func TestMetricsRetries(t *testing.T) {
+	m := newMetrics([]*result{{code: 200, attempts: 1}, {code: 200, attempts: 3}, {code: 200}}, NearestRank)
+	if m.Retries != 2 {
+		t.Fatalf("Wrong number of retries: want 2, got %d", m.Retries)
+	}
+}
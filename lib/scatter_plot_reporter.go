@@ -0,0 +1,110 @@
+package vegeta
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"sync"
+	"time"
+)
+
+// ScatterPlotReporter plots the latency of each request over the elapsed
+// time of the test as a PNG scatter plot, with successful requests in green
+// and failed ones in red, e.g. to share the results as an image
+type ScatterPlotReporter struct {
+	// Width and Height are the dimensions of the image in pixels
+	Width, Height int
+	responses     []*result
+	mu            sync.Mutex
+}
+
+// Colors of the scatter plot
+var (
+	scatterGrid    = color.RGBA{220, 220, 220, 255}
+	scatterAxes    = color.RGBA{100, 100, 100, 255}
+	scatterSuccess = color.RGBA{44, 160, 44, 255}
+	scatterFailure = color.RGBA{214, 39, 40, 255}
+)
+
+// scatterMargin is the margin around the plot area, in pixels
+const scatterMargin = 20
+
+// NewScatterPlotReporter initializes a ScatterPlotReporter of 800x400 pixels
+func NewScatterPlotReporter() *ScatterPlotReporter {
+	return &ScatterPlotReporter{Width: 800, Height: 400, responses: make([]*result, 0)}
+}
+
+// add adds a response to be plotted
+// Order of arrival is not relevant for this reporter
+func (r *ScatterPlotReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, res)
+	return nil
+}
+
+func (r *ScatterPlotReporter) detailed() {}
+
+// Reset clears the responses
+func (r *ScatterPlotReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = r.responses[:0]
+}
+
+// Report plots the responses on a grid whose x axis spans from the first to
+// the last timestamp and whose y axis from zero to the maximum latency, and
+// writes it to out in PNG format. Failures are drawn over successes.
+// It returns an error in case of failure.
+func (r *ScatterPlotReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	img := image.NewRGBA(image.Rect(0, 0, r.Width, r.Height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	area := image.Rect(scatterMargin, scatterMargin, r.Width-scatterMargin, r.Height-scatterMargin)
+	for i := 1; i < 5; i++ {
+		x := area.Min.X + area.Dx()*i/5
+		y := area.Min.Y + area.Dy()*i/5
+		draw.Draw(img, image.Rect(x, area.Min.Y, x+1, area.Max.Y), image.NewUniform(scatterGrid), image.Point{}, draw.Src)
+		draw.Draw(img, image.Rect(area.Min.X, y, area.Max.X, y+1), image.NewUniform(scatterGrid), image.Point{}, draw.Src)
+	}
+	draw.Draw(img, image.Rect(area.Min.X, area.Min.Y, area.Min.X+1, area.Max.Y), image.NewUniform(scatterAxes), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(area.Min.X, area.Max.Y-1, area.Max.X, area.Max.Y), image.NewUniform(scatterAxes), image.Point{}, draw.Src)
+
+	var first, last time.Time
+	var max time.Duration
+	for i, res := range r.responses {
+		if i == 0 || res.timestamp.Before(first) {
+			first = res.timestamp
+		}
+		if i == 0 || res.timestamp.After(last) {
+			last = res.timestamp
+		}
+		if res.timing > max {
+			max = res.timing
+		}
+	}
+	span := last.Sub(first)
+	for _, failures := range []bool{false, true} {
+		fill := image.NewUniform(scatterSuccess)
+		if failures {
+			fill = image.NewUniform(scatterFailure)
+		}
+		for _, res := range r.responses {
+			if res.successful() == failures {
+				continue
+			}
+			x, y := area.Min.X, area.Max.Y-1
+			if span > 0 {
+				x += int(float64(area.Dx()-1) * float64(res.timestamp.Sub(first)) / float64(span))
+			}
+			if max > 0 {
+				y -= int(float64(area.Dy()-1) * float64(res.timing) / float64(max))
+			}
+			draw.Draw(img, image.Rect(x-1, y-1, x+2, y+2).Intersect(area), fill, image.Point{}, draw.Src)
+		}
+	}
+	return png.Encode(out, img)
+}
@@ -0,0 +1,60 @@
+package vegeta
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestScatterPlotReporterPNG(t *testing.T) {
+	began := time.Now()
+	for _, failures := range []bool{false, true} {
+		rep := NewScatterPlotReporter()
+		for i := 0; i < 10; i++ {
+			rep.add(&result{code: 200, timestamp: began.Add(time.Duration(i) * time.Second), timing: time.Duration(i) * time.Millisecond})
+		}
+		if failures {
+			rep.add(&result{code: 500, timestamp: began.Add(5 * time.Second), timing: 20 * time.Millisecond, err: errors.New("Internal Server Error")})
+		}
+		out := &bytes.Buffer{}
+		if err := rep.Report(out); err != nil {
+			t.Fatalf("Report failed: %s", err)
+		}
+
+		config, err := png.DecodeConfig(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("Report isn't a PNG: %s", err)
+		}
+		if config.Width != 800 || config.Height != 400 {
+			t.Fatalf("Wrong dimensions: want 800x400, got %dx%d", config.Width, config.Height)
+		}
+		img, err := png.Decode(out)
+		if err != nil {
+			t.Fatalf("Report isn't a valid image: %s", err)
+		}
+		if !hasColor(img, scatterSuccess) {
+			t.Errorf("No success point plotted")
+		}
+		if got := hasColor(img, scatterFailure); got != failures {
+			t.Errorf("Wrong failure points: want %t, got %t", failures, got)
+		}
+	}
+}
+
+// hasColor returns whether any pixel of img has the color c
+func hasColor(img image.Image, c color.Color) bool {
+	wr, wg, wb, wa := c.RGBA()
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, g, b, a := img.At(x, y).RGBA(); r == wr && g == wg && b == wb && a == wa {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package vegeta
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// slowest tracks the n results with the highest timings out of the ones it
+// is added, in a min-heap bounded at n so its memory doesn't grow with
+// the number of results
+type slowest struct {
+	n       int
+	results resultHeap
+}
+
+// newSlowest initializes a slowest tracking the n slowest results
+func newSlowest(n int) *slowest {
+	return &slowest{n: n, results: make(resultHeap, 0, n+1)}
+}
+
+// add tracks res if it's one of the n slowest results so far
+func (s *slowest) add(res *result) {
+	if s.n <= 0 {
+		return
+	}
+	if len(s.results) == s.n && res.timing <= s.results[0].timing {
+		return // Faster than the fastest of the slowest
+	}
+	heap.Push(&s.results, res)
+	if len(s.results) > s.n {
+		heap.Pop(&s.results)
+	}
+}
+
+// sorted returns the slowest results, from the slowest
+func (s *slowest) sorted() []*result {
+	sorted := append([]*result{}, s.results...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].timing > sorted[j].timing })
+	return sorted
+}
+
+// resultHeap is a min-heap of results by timing
+type resultHeap []*result
+
+func (h resultHeap) Len() int            { return len(h) }
+func (h resultHeap) Less(i, j int) bool  { return h[i].timing < h[j].timing }
+func (h resultHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x interface{}) { *h = append(*h, x.(*result)) }
+
+func (h *resultHeap) Pop() interface{} {
+	old := *h
+	res := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return res
+}
@@ -0,0 +1,26 @@
+package vegeta
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSlowest(t *testing.T) {
+	s := newSlowest(10)
+	for _, i := range rand.Perm(1000) {
+		s.add(&result{timing: time.Duration(i) * time.Millisecond})
+		if len(s.results) > 10 {
+			t.Fatalf("Slowest grew to %d results", len(s.results))
+		}
+	}
+	sorted := s.sorted()
+	if len(sorted) != 10 {
+		t.Fatalf("Wrong number of slowest results: want 10, got %d", len(sorted))
+	}
+	for i, res := range sorted {
+		if want := time.Duration(999-i) * time.Millisecond; res.timing != want {
+			t.Errorf("Wrong %dth slowest result: want %s, got %s", i, want, res.timing)
+		}
+	}
+}
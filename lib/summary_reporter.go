@@ -0,0 +1,65 @@
+package vegeta
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SummaryReporter writes the test results as a single line of key=value
+// pairs, e.g. to be grepped or parsed in shell pipelines:
+//
+//	reqs=1000 rate=50.00 success=99.50% p50=12ms p95=180ms p99=210ms p999=290ms max=350ms errors=5
+//
+// The keys are stable and always present, in that order. The percentiles
+// are computed from histograms, in bounded memory, to Digits significant
+// digits.
+type SummaryReporter struct {
+	// Percentiles is the method of the percentiles of the line,
+	// NearestRank by default
+	Percentiles PercentileMethod
+	// Digits is the significant digits of the histograms of the latencies,
+	// between 1 and 5. It is 3 by default, and set before adding results.
+	Digits int
+	agg    *aggregator
+	mu     sync.Mutex
+}
+
+// NewSummaryReporter initializes a SummaryReporter with no responses
+func NewSummaryReporter() *SummaryReporter {
+	return &SummaryReporter{agg: newStreamingAggregator(hdrDigits)}
+}
+
+// Report computes and writes the summary line to out.
+// It returns an error in case of failure.
+func (r *SummaryReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.agg.metrics(r.Percentiles)
+	errors := uint64(0)
+	for _, count := range m.ErrorCategories {
+		errors += count
+	}
+	_, err := fmt.Fprintf(out, "reqs=%d rate=%.2f success=%.2f%% p50=%s p95=%s p99=%s p999=%s max=%s errors=%d\n",
+		m.Requests, m.Rate, m.Success*100, m.Latencies.P50, m.Latencies.P95,
+		m.Latencies.P99, m.Latencies.P999, m.Latencies.Max, errors)
+	return err
+}
+
+// add aggregates a response into the summary, without retaining it
+func (r *SummaryReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.agg.m.Requests == 0 {
+		r.agg = newStreamingAggregator(r.Digits)
+	}
+	r.agg.add(res)
+	return nil
+}
+
+// Reset clears the summary of the responses
+func (r *SummaryReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg = newStreamingAggregator(r.Digits)
+}
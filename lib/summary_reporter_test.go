@@ -0,0 +1,38 @@
+package vegeta
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSummaryReporter(t *testing.T) {
+	rep := NewSummaryReporter()
+	began := time.Unix(1375351200, 0)
+	for i := 1; i <= 100; i++ {
+		res := &result{code: 200, timestamp: began.Add(time.Duration(i) * 10 * time.Millisecond), timing: time.Duration(i) * time.Millisecond}
+		if i%20 == 0 {
+			res.code, res.err = 500, errors.New("Internal Server Error")
+		}
+		rep.add(res)
+	}
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	want := "reqs=100 rate=101.01 success=95.00% p50=50ms p95=95ms p99=99ms p999=100ms max=100ms errors=5\n"
+	if got := out.String(); got != want {
+		t.Fatalf("Wrong summary:\nwant %q\ngot  %q", want, got)
+	}
+
+	rep.Reset()
+	out.Reset()
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if want := "reqs=0 rate=0.00 success=0.00% p50=0s p95=0s p99=0s p999=0s max=0s errors=0\n"; out.String() != want {
+		t.Fatalf("Wrong summary of no results: %q", out)
+	}
+}
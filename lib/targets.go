@@ -2,67 +2,645 @@ package vegeta
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
+	"math/bits"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 )
 
 // Targets represents the http.Requests which will be issued during the test
 type Targets []*http.Request
 
+// Targeter returns the next target of an attack. It fails with io.EOF
+// once there are no more targets.
+type Targeter func(ctx context.Context) (*http.Request, error)
+
+// ErrNoTargets is the error of empty Targets, e.g. of a targets file with
+// only comments
+var ErrNoTargets = errors.New("No targets to attack")
+
+// Targeter returns a Targeter of the Targets in round-robin, which are
+// never exhausted. Each round returns every target as many times as its
+// weight, see WithWeight, interleaved with the others instead of in a row.
+// Unweighted Targets are returned in order. It fails with ErrNoTargets if
+// there are none.
+func (t Targets) Targeter() Targeter {
+	if len(t) == 0 {
+		return func(context.Context) (*http.Request, error) { return nil, ErrNoTargets }
+	}
+	sums, total := make([]uint64, len(t)), uint64(0) // The cumulative weights
+	for i, req := range t {
+		total += weight(req)
+		sums[i] = total
+	}
+	stride := uint64(1)
+	if total > uint64(len(t)) {
+		stride = interleaving(total)
+	}
+	i := uint64(0)
+	return func(context.Context) (*http.Request, error) {
+		// Coprime strides visit every slot of a round once, out of order
+		hi, lo := bits.Mul64(i%total, stride)
+		slot := bits.Rem64(hi, lo, total)
+		i++
+		return t[sort.Search(len(sums), func(j int) bool { return sums[j] > slot })], nil
+	}
+}
+
+// interleaving returns the first stride coprime with n from n divided by
+// the golden ratio, whose multiples spread the consecutive slots of a round
+// of n evenly
+func interleaving(n uint64) uint64 {
+	stride := uint64(float64(n) / math.Phi)
+	if stride == 0 {
+		stride = 1
+	}
+	for gcd(stride, n) != 1 {
+		stride++
+	}
+	return stride
+}
+
+// weightKey is the context key of the weight of a target
+type weightKey struct{}
+
+// WithWeight returns a shallow copy of the target req which is hit w times
+// relatively to the other Targets, e.g. 80 and 20 times for 80% reads and
+// 20% writes. Targets have a weight of 1 by default. The total weight of
+// Targets must not overflow a uint64.
+func WithWeight(req *http.Request, w uint64) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), weightKey{}, w))
+}
+
+// weight returns the weight of the target req
+func weight(req *http.Request) uint64 {
+	if w, ok := req.Context().Value(weightKey{}).(uint64); ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// maxURLTemplates is the number of parsed URL templates a TemplatedTargeter
+// caches, which bounds its memory with the endless targets of lazy sources
+const maxURLTemplates = 1024
+
+// urlTemplates caches the parsed URL templates of up to maxURLTemplates
+// targets, starting over once full
+type urlTemplates map[*http.Request]*template.Template
+
+// get returns the URL template of req, or nil if it has none, parsing it
+// unless it's cached
+func (c *urlTemplates) get(req *http.Request) (*template.Template, error) {
+	if tmpl, ok := (*c)[req]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := urlTemplate(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(*c) >= maxURLTemplates {
+		*c = urlTemplates{}
+	}
+	(*c)[req] = tmpl
+	return tmpl, nil
+}
+
+// TemplatedTargeter returns a Targeter of the targets of tr whose URLs are
+// text/templates, e.g. http://localhost/item/{{.Seq}}?page={{.Seq}}, executed
+// with the index of each request, starting at 0, e.g. to page through
+// sequential resources. The templates of up to maxURLTemplates targets are
+// cached instead of parsed on every request, and targets whose URLs have no
+// template are returned as they are.
+func TemplatedTargeter(tr Targeter) Targeter {
+	templates := urlTemplates{}
+	seq := uint64(0)
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := tr(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { seq++ }()
+		tmpl, err := templates.get(req)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl == nil {
+			return req, nil
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, struct{ Seq uint64 }{seq}); err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(b.String())
+		if err != nil {
+			return nil, fmt.Errorf("Invalid templated URL `%s`: %s", b.String(), err)
+		}
+		req = req.Clone(req.Context()) // Targets are shared between hits
+		req.URL, req.Host = u, u.Host
+		return req, nil
+	}
+}
+
+// urlTemplate parses the template of u, or returns nil if it has none
+func urlTemplate(u *url.URL) (*template.Template, error) {
+	path := u.RawPath // Which keeps the braces of templates unescaped
+	if path == "" {
+		path = u.Path
+	}
+	host := u.Host
+	if u.User != nil {
+		host = u.User.String() + "@" + host
+	}
+	text := u.Scheme + "://" + host + path
+	if u.RawQuery != "" {
+		text += "?" + u.RawQuery
+	}
+	if !strings.Contains(text, "{{") {
+		return nil, nil
+	}
+	tmpl, err := template.New("url").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid URL template `%s`: %s", text, err)
+	}
+	return tmpl, nil
+}
+
+// NewLazyTargeter returns a Targeter of the targets of source, in the
+// format of NewTargets, which are read and parsed as they're needed
+// instead of all at once, e.g. to attack targets streamed by another
+// process. A target is returned once the line following its headers is
+// read, and weighted targets are repeated as many times as their weight.
+// Parsing errors include the number of the offending line. The Targeter
+// fails with io.EOF at the end of source.
+func NewLazyTargeter(source io.Reader, opts ...TargetsOption) Targeter {
+	return newLazyTargeter(source, newTargetsParser(nil, opts))
+}
+
+// NewLazyTargeterKeepGoing is like NewLazyTargeter but skips the malformed
+// targets, along with their headers, passing each of their errors to skip
+// instead of failing with them.
+func NewLazyTargeterKeepGoing(source io.Reader, skip func(error), opts ...TargetsOption) Targeter {
+	return newLazyTargeter(source, newTargetsParser(skip, opts))
+}
+
+// newLazyTargeter returns a Targeter of the targets of source parsed by p
+func newLazyTargeter(source io.Reader, p *targetsParser) Targeter {
+	lines := make(chan string)
+	var scanErr error // Set before lines is closed
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(source)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		scanErr = scanner.Err()
+	}()
+
+	n, done := 0, false
+	var cur *http.Request
+	repeats := uint64(0)
+	return func(ctx context.Context) (*http.Request, error) {
+		for {
+			if repeats > 0 {
+				repeats--
+				return cur, nil
+			}
+			// A target is complete once the next one is parsed or the source ended
+			if len(p.targets) > 1 || done && len(p.targets) == 1 {
+				cur, repeats = p.targets[0], p.weights[0]
+				p.targets, p.weights, p.lines = p.targets[1:], p.weights[1:], p.lines[1:]
+				p.total -= repeats
+				continue
+			}
+			if done {
+				if err := scanErr; err != nil {
+					scanErr = nil
+					return nil, err
+				}
+				return nil, io.EOF
+			}
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					done = true
+					continue
+				}
+				n++
+				if err := p.parse(n, line); err != nil {
+					return nil, err
+				}
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
 // NewTargetsFromFile reads and parses targets from a text file
-func NewTargetsFromFile(filename string) (Targets, error) {
+func NewTargetsFromFile(filename string, opts ...TargetsOption) (Targets, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return Targets{}, err
 	}
 	defer file.Close()
-	return readTargets(file)
+	return readTargets(file, opts...)
 }
 
-// readTargets reads targets out of a line separated source skipping empty lines
-func readTargets(source io.Reader) (Targets, error) {
+// NewTargetsFromFileKeepGoing is like NewTargetsFromFile but skips the
+// malformed targets like NewTargetsKeepGoing. It only fails to read the file.
+func NewTargetsFromFileKeepGoing(filename string, skip func(error), opts ...TargetsOption) (Targets, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return Targets{}, err
+	}
+	defer file.Close()
+	return newTargetsParser(skip, opts).read(file)
+}
+
+// readTargets reads targets out of a line separated source
+func readTargets(source io.Reader, opts ...TargetsOption) (Targets, error) {
+	return newTargetsParser(nil, opts).read(source)
+}
+
+// readLines reads all the lines of source
+func readLines(source io.Reader) ([]string, error) {
 	scanner := bufio.NewScanner(source)
 	lines := make([]string, 0)
 	for scanner.Scan() {
-		line := scanner.Text()
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
 
-		if line = strings.TrimSpace(line); line != "" && line[0:2] != "//" { // A comment or blank line
-			lines = append(lines, line)
-		}
+// NewTargets instantiates Targets from a slice of strings.
+// Each target is a "[WEIGHT] [TIMEOUT] METHOD URL [BODY]" line optionally
+// followed by "Key: Value" header lines which are added to its request.
+// BODY is either the inline request body or @path of a file to read it from.
+// WEIGHT is the positive number of times the target is hit relatively to
+// the others, which defaults to 1, see WithWeight.
+// TIMEOUT is a duration, e.g. 500ms, overriding the Timeout of the Attacker
+// for the requests of the target, see WithTimeout.
+// Empty lines and comments starting with // or # are skipped.
+// ${NAME} references to environment variables are replaced with their
+// values, and undefined variables are errors unless AllowEmptyEnv is given.
+// Errors include the number of the offending line, and no targets at all
+// fail with ErrNoTargets.
+func NewTargets(lines []string, opts ...TargetsOption) (Targets, error) {
+	return newTargetsParser(nil, opts).parseAll(lines)
+}
+
+// NewTargetsKeepGoing is like NewTargets but skips the malformed targets,
+// along with their headers, passing each of their errors to skip instead
+// of failing with the first one.
+func NewTargetsKeepGoing(lines []string, skip func(error), opts ...TargetsOption) Targets {
+	targets, _ := newTargetsParser(skip, opts).parseAll(lines)
+	return targets
+}
+
+// targetsParser parses targets line by line
+type targetsParser struct {
+	targets       []*http.Request
+	weights       []uint64
+	total         uint64 // The sum of the weights
+	lines         []int  // The line number of each target
+	skip          func(error)
+	skipped       bool // Whether the last target line was malformed
+	allowEmptyEnv bool
+}
+
+// newTargetsParser returns a targetsParser configured by opts which passes
+// the errors of malformed targets to skip, unless it's nil
+func newTargetsParser(skip func(error), opts []TargetsOption) *targetsParser {
+	p := &targetsParser{skip: skip}
+	for _, opt := range opts {
+		opt(p)
 	}
-	if err := scanner.Err(); err != nil {
+	return p
+}
+
+// read reads and parses all the lines of a line separated source
+func (p *targetsParser) read(source io.Reader) (Targets, error) {
+	lines, err := readLines(source)
+	if err != nil {
 		return Targets{}, err
 	}
+	return p.parseAll(lines)
+}
+
+// parseAll parses all the lines into weighted Targets, failing with the
+// first error which isn't skipped, or with ErrNoTargets if there are none
+func (p *targetsParser) parseAll(lines []string) (Targets, error) {
+	for i, line := range lines {
+		if err := p.parse(i+1, line); err != nil {
+			return p.targets, err
+		}
+	}
+	if len(p.targets) == 0 {
+		return Targets{}, ErrNoTargets
+	}
+	return weighted(p.targets, p.weights), nil
+}
 
-	return NewTargets(lines)
+// parse parses the nth line, adding its target or header. The errors
+// passed to skip aren't returned.
+func (p *targetsParser) parse(n int, line string) error {
+	err := p.parseLine(n, line)
+	if err != nil && p.skip != nil {
+		p.skip(err)
+		return nil
+	}
+	return err
 }
 
-// NewTargets instantiates Targets from a slice of strings
-func NewTargets(lines []string) (Targets, error) {
-	targets := make([]*http.Request, 0)
-	for _, line := range lines {
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) != 2 {
-			return targets, fmt.Errorf("Invalid request format: `%s`", line)
+// parseLine parses the nth line, adding its target or header. The headers
+// of a malformed target are left out.
+func (p *targetsParser) parseLine(n int, line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "//") || strings.HasPrefix(line, "#") {
+		return nil // A comment or blank line
+	}
+	line, err := expandEnv(line, p.allowEmptyEnv)
+	if err != nil {
+		return fmt.Errorf("Line %d: %s", n, err)
+	} else if line == "" {
+		return nil
+	}
+	if isHeader(line) {
+		if p.skipped {
+			return nil
+		}
+		if len(p.targets) == 0 {
+			return fmt.Errorf("Line %d: Header without a target: `%s`", n, line)
+		}
+		parts := strings.SplitN(line, ":", 2)
+		p.targets[len(p.targets)-1].Header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return nil
+	}
+	p.skipped = true // Until the target is added
+	weight := uint64(1)
+	if fields := strings.Fields(line); isWeight(fields[0]) {
+		w, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil || w == 0 {
+			return fmt.Errorf("Line %d: Invalid weight: `%s`", n, line)
 		}
-		// Build request
-		req, err := http.NewRequest(parts[0], parts[1], nil)
+		weight, line = w, strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+	}
+	if p.total+weight < p.total {
+		return fmt.Errorf("Line %d: Total weight of the targets overflows: `%s`", n, line)
+	}
+	timeout := time.Duration(-1)
+	if fields := strings.Fields(line); len(fields) > 0 && isTimeout(fields[0]) {
+		d, err := time.ParseDuration(fields[0])
+		if err != nil || d < 0 {
+			return fmt.Errorf("Line %d: Invalid timeout: `%s`", n, line)
+		}
+		timeout, line = d, strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return fmt.Errorf("Line %d: Invalid request format: `%s`", n, line)
+	}
+	var body io.Reader
+	if len(parts) == 3 {
+		data, err := readBody(parts[2])
 		if err != nil {
-			return targets, fmt.Errorf("Failed to build request: %s", err)
+			return fmt.Errorf("Line %d: Failed to read body: %s", n, err)
+		}
+		body = bytes.NewReader(data)
+	}
+	if !validMethod(parts[0]) {
+		return fmt.Errorf("Line %d: Invalid method `%s`", n, parts[0])
+	}
+	// Build request
+	req, err := http.NewRequest(parts[0], parts[1], body)
+	if err != nil {
+		return fmt.Errorf("Line %d: Failed to build request: %s", n, err)
+	}
+	if timeout >= 0 {
+		req = WithTimeout(req, timeout)
+	}
+	p.targets = append(p.targets, req)
+	p.weights = append(p.weights, weight)
+	p.total += weight
+	p.lines = append(p.lines, n)
+	p.skipped = false
+	return nil
+}
+
+// jsonTarget is the JSON representation of a target
+type jsonTarget struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Header  http.Header `json:"header"`
+	Body    []byte      `json:"body"` // Base64 encoded
+	Weight  uint64      `json:"weight"`
+	Timeout string      `json:"timeout"`
+}
+
+// NewJSONTargets reads Targets out of a JSON array of objects, each with
+// the method, url, header and base64 encoded body of a target, e.g.
+//
+//	[{"method": "POST", "url": "http://localhost/", "header": {"Content-Type": ["text/plain"]}, "body": "aGVsbG8="}]
+//
+// The method and url are required. The optional weight is the positive
+// number of times the target is hit relatively to the others, and the
+// optional timeout a duration overriding the Timeout of the Attacker, like
+// in NewTargets. Errors include the index of the offending target, and no
+// targets at all fail with ErrNoTargets.
+func NewJSONTargets(source io.Reader) (Targets, error) {
+	entries := []json.RawMessage{}
+	if err := json.NewDecoder(source).Decode(&entries); err != nil {
+		return Targets{}, fmt.Errorf("Invalid JSON targets: %s", err)
+	}
+	targets := make([]*http.Request, 0, len(entries))
+	weights, total := make([]uint64, 0, len(entries)), uint64(0)
+	for i, entry := range entries {
+		t := jsonTarget{Weight: 1}
+		if err := json.Unmarshal(entry, &t); err != nil {
+			return Targets{}, fmt.Errorf("Target %d: Invalid target: %s", i, err)
+		}
+		if t.Method == "" || t.URL == "" {
+			return Targets{}, fmt.Errorf("Target %d: Missing method or url", i)
+		}
+		if t.Weight == 0 {
+			return Targets{}, fmt.Errorf("Target %d: Invalid weight 0", i)
+		}
+		if total += t.Weight; total < t.Weight {
+			return Targets{}, fmt.Errorf("Target %d: Total weight of the targets overflows", i)
+		}
+		if !validMethod(t.Method) {
+			return Targets{}, fmt.Errorf("Target %d: Invalid method `%s`", i, t.Method)
+		}
+		req, err := http.NewRequest(t.Method, t.URL, bytes.NewReader(t.Body))
+		if err != nil {
+			return Targets{}, fmt.Errorf("Target %d: Failed to build request: %s", i, err)
+		}
+		if t.Timeout != "" {
+			d, err := time.ParseDuration(t.Timeout)
+			if err != nil || d < 0 {
+				return Targets{}, fmt.Errorf("Target %d: Invalid timeout `%s`", i, t.Timeout)
+			}
+			req = WithTimeout(req, d)
+		}
+		for key, values := range t.Header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
 		}
 		targets = append(targets, req)
+		weights = append(weights, t.Weight)
+	}
+	if len(targets) == 0 {
+		return Targets{}, ErrNoTargets
+	}
+	return weighted(targets, weights), nil
+}
+
+// ValidateTargetsFile parses the targets of a file like NewTargetsFromFile,
+// without sending any request, and resolves the host of each of them.
+// It returns all the problems found, which include their line number.
+func ValidateTargetsFile(filename string, opts ...TargetsOption) []error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return []error{err}
+	}
+	defer file.Close()
+	lines, err := readLines(file)
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := []error{}
+	p := newTargetsParser(nil, opts)
+	for i, line := range lines {
+		if err := p.parse(i+1, line); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(p.targets) == 0 && len(errs) == 0 {
+		errs = append(errs, ErrNoTargets)
+	}
+	resolved := map[string]error{}
+	for i, req := range p.targets {
+		host := req.URL.Hostname()
+		err, ok := resolved[host]
+		if !ok {
+			_, err = net.LookupHost(host)
+			resolved[host] = err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Line %d: Couldn't resolve `%s`: %s", p.lines[i], host, err))
+		}
 	}
-	return targets, nil
+	return errs
+}
+
+// TargetsOption configures the parsing of text targets
+type TargetsOption func(*targetsParser)
+
+// AllowEmptyEnv returns a TargetsOption which expands the ${NAME}
+// references to undefined environment variables to empty strings instead
+// of failing with them.
+func AllowEmptyEnv(allow bool) TargetsOption {
+	return func(p *targetsParser) { p.allowEmptyEnv = allow }
+}
+
+// envVar matches a ${NAME} reference to an environment variable
+var envVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} references of line with the values of the
+// environment variables, failing with the first undefined one unless
+// allowEmpty
+func expandEnv(line string, allowEmpty bool) (string, error) {
+	undefined := ""
+	expanded := envVar.ReplaceAllStringFunc(line, func(ref string) string {
+		name := envVar.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && !allowEmpty && undefined == "" {
+			undefined = name
+		}
+		return value
+	})
+	if undefined != "" {
+		return "", fmt.Errorf("Undefined environment variable `%s`", undefined)
+	}
+	return strings.TrimSpace(expanded), nil
+}
+
+// isWeight returns true if the token is a number, which unlike a METHOD
+// makes it the weight of the target
+func isWeight(token string) bool {
+	return strings.Trim(token, "0123456789") == ""
+}
+
+// isTimeout returns true if the token starts like a duration, e.g. 500ms,
+// which unlike a METHOD or weight makes it the timeout of the target
+func isTimeout(token string) bool {
+	return token[0] >= '0' && token[0] <= '9' && !isWeight(token)
+}
+
+// validMethod returns true if the token is a plausible METHOD, made of
+// upper case letters, dashes and underscores like the standard GET, HEAD or
+// PATCH and custom ones like PURGE or MKCOL. Any other token is more likely
+// a typo than a method.
+func validMethod(token string) bool {
+	return token != "" && strings.Trim(token, "ABCDEFGHIJKLMNOPQRSTUVWXYZ-_") == ""
+}
+
+// weighted sets the weights of the targets which have one, see WithWeight
+func weighted(targets []*http.Request, weights []uint64) Targets {
+	for i, req := range targets {
+		if weights[i] != 1 {
+			targets[i] = WithWeight(req, weights[i])
+		}
+	}
+	return targets
+}
+
+// gcd returns the greatest common divisor of a and b
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// readBody returns the request body of spec, which is either the body
+// itself or @path of the file holding it
+func readBody(spec string) ([]byte, error) {
+	if strings.HasPrefix(spec, "@") {
+		return ioutil.ReadFile(spec[1:])
+	}
+	return []byte(spec), nil
+}
+
+// isHeader returns true if the line is a "Key: Value" header line,
+// whose first token ends with a colon unlike "METHOD URL" lines
+func isHeader(line string) bool {
+	name := strings.Fields(line)[0]
+	return len(name) > 1 && strings.HasSuffix(name, ":")
 }
 
-// Shuffle randomly alters the order of Targets with the provided seed
+// Shuffle randomly alters the order of Targets with the provided seed.
+// The same seed always results in the same order.
 func (t Targets) Shuffle(seed int64) {
-	rand.Seed(seed)
-	for i, rnd := range rand.Perm(len(t)) {
+	for i, rnd := range rand.New(rand.NewSource(seed)).Perm(len(t)) {
 		tmp := t[i]
 		t[i] = t[rnd]
 		t[rnd] = tmp
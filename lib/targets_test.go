@@ -2,8 +2,17 @@ package vegeta
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestReadTargets(t *testing.T) {
@@ -52,3 +61,400 @@ func TestShuffle(t *testing.T) {
 	}
 	t.Fatal("Targets were not shuffled correctly")
 }
+
+func TestShuffleSeed(t *testing.T) {
+	orders := [2][]string{}
+	for i := range orders {
+		targets := make(Targets, 50)
+		for j := range targets {
+			targets[j], _ = http.NewRequest("GET", fmt.Sprintf("http://lolcathost:9999/%d", j), nil)
+		}
+		targets.Shuffle(42)
+		for _, target := range targets {
+			orders[i] = append(orders[i], target.URL.Path)
+		}
+	}
+	if !reflect.DeepEqual(orders[0], orders[1]) {
+		t.Fatalf("Orders differ with the same seed:\n%v\n%v", orders[0], orders[1])
+	}
+}
+
+func TestReadTargetsHeaders(t *testing.T) {
+	lines := bytes.NewBufferString("# Users\nGET http://lolcathost:9999/users\nAuthorization: Bearer 1234\nAccept: text/html\nAccept: application/json\n\nHEAD http://lolcathost:9999/\n")
+	targets, err := readTargets(lines)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Wrong number of targets: want 2, got %d", len(targets))
+	}
+	want := http.Header{"Authorization": {"Bearer 1234"}, "Accept": {"text/html", "application/json"}}
+	if !reflect.DeepEqual(targets[0].Header, want) {
+		t.Fatalf("Wrong headers: want %v, got %v", want, targets[0].Header)
+	}
+	if len(targets[1].Header) != 0 {
+		t.Fatalf("Headers leaked into the next target: %v", targets[1].Header)
+	}
+
+	if _, err = NewTargets([]string{"Accept: text/html"}); err == nil {
+		t.Fatal("Header without a target didn't fail")
+	}
+}
+
+func TestNewTargetsBody(t *testing.T) {
+	file, err := ioutil.TempFile("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"from":"file"}`)
+	file.Close()
+
+	targets, err := NewTargets([]string{
+		`POST http://lolcathost:9999/ {"from": "inline"}`,
+		"PUT http://lolcathost:9999/ @" + file.Name(),
+	})
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+	for i, want := range []string{`{"from": "inline"}`, `{"from":"file"}`} {
+		body, _ := ioutil.ReadAll(targets[i].Body)
+		if string(body) != want || targets[i].ContentLength != int64(len(want)) {
+			t.Errorf("Wrong body: want %s, got %s (%d bytes)", want, body, targets[i].ContentLength)
+		}
+	}
+
+	if _, err = NewTargets([]string{"POST http://lolcathost:9999/ @/does/not/exist"}); err == nil {
+		t.Fatal("Missing body file didn't fail")
+	}
+}
+
+func TestNewTargetsWeights(t *testing.T) {
+	targets, err := NewTargets([]string{
+		"75 GET http://lolcathost:9999/reads",
+		"25 POST http://lolcathost:9999/writes {\"weight\": 25}",
+		"X-Weighted: true",
+		"GET http://lolcathost:9999/unweighted",
+	})
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("Wrong number of weighted targets: want 3, got %d", len(targets))
+	}
+	if targets[1].Header.Get("X-Weighted") != "true" {
+		t.Fatal("Header wasn't added to the weighted target")
+	}
+	tr, counts := targets.Targeter(), map[string]int{}
+	for i := 0; i < 2*101; i++ {
+		target, _ := tr(context.Background())
+		counts[target.URL.Path]++
+	}
+	if want := map[string]int{"/reads": 150, "/writes": 50, "/unweighted": 2}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("Wrong weighted targets: want %v, got %v", want, counts)
+	}
+
+	// Huge weights aren't expanded, and are interleaved instead of in a row
+	targets, err = NewTargets([]string{"4000000000 GET http://lolcathost:9999/a", "3999999999 GET http://lolcathost:9999/b"})
+	if err != nil {
+		t.Fatalf("Couldn't parse huge weights: %s", err)
+	}
+	tr, counts = targets.Targeter(), map[string]int{}
+	for i := 0; i < 1000; i++ {
+		target, _ := tr(context.Background())
+		counts[target.URL.Path]++
+	}
+	if counts["/a"] < 450 || counts["/b"] < 450 {
+		t.Fatalf("Huge weights weren't interleaved: got %v", counts)
+	}
+
+	if _, err := NewTargets([]string{
+		"18446744073709551615 GET http://lolcathost:9999/a",
+		"GET http://lolcathost:9999/b",
+	}); err == nil || !strings.Contains(err.Error(), "Line 2: Total weight") {
+		t.Errorf("Overflowing total weight didn't fail: %v", err)
+	}
+
+	for _, line := range []string{"0 GET http://lolcathost:9999/", "99999999999999999999 GET http://lolcathost:9999/"} {
+		if _, err := NewTargets([]string{line}); err == nil {
+			t.Errorf("Invalid weight didn't fail: %s", line)
+		}
+	}
+}
+
+func TestNewTargetsTimeouts(t *testing.T) {
+	targets, err := NewTargets([]string{
+		"2 500ms GET http://lolcathost:9999/slow",
+		"0s GET http://lolcathost:9999/unbounded",
+		"GET http://lolcathost:9999/default",
+	})
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+	for i, want := range []interface{}{500 * time.Millisecond, time.Duration(0), nil} {
+		if got := targets[i].Context().Value(timeoutKey{}); got != want {
+			t.Errorf("Wrong timeout of %s: want %v, got %v", targets[i].URL, want, got)
+		}
+	}
+	if w := weight(targets[0]); w != 2 {
+		t.Errorf("Timeout lost the weight of its target: want 2, got %d", w)
+	}
+	for _, line := range []string{"5lightyears GET http://lolcathost:9999/", "-1s GET http://lolcathost:9999/"} {
+		if _, err := NewTargets([]string{line}); err == nil {
+			t.Errorf("Invalid timeout didn't fail: %s", line)
+		}
+	}
+}
+
+func TestNewTargetsMethods(t *testing.T) {
+	methods := []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "PURGE", "MKCOL", "VERSION-CONTROL"}
+	lines := make([]string, 0, len(methods))
+	for _, method := range methods {
+		lines = append(lines, method+" http://lolcathost:9999/")
+	}
+	targets, err := NewTargets(lines)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid methods: %s", err)
+	}
+	for i, method := range methods {
+		if targets[i].Method != method {
+			t.Errorf("Wrong method: want %s, got %s", method, targets[i].Method)
+		}
+	}
+	for _, line := range []string{"get http://lolcathost:9999/", "GET/1 http://lolcathost:9999/", "G@T http://lolcathost:9999/"} {
+		if _, err := NewTargets([]string{"GET http://lolcathost:9999/", line}); err == nil || !strings.HasPrefix(err.Error(), "Line 2: Invalid method") {
+			t.Errorf("Wrong error of %q: %v", line, err)
+		}
+	}
+}
+
+func TestNewTargetsLineNumbers(t *testing.T) {
+	_, err := NewTargets([]string{"# Users", "GET http://lolcathost:9999/", "", "http://lolcathost:9999/"})
+	if err == nil || !strings.HasPrefix(err.Error(), "Line 4: Invalid request format") {
+		t.Fatalf("Error doesn't include the line number: %v", err)
+	}
+}
+
+func TestNewTargetsEnv(t *testing.T) {
+	os.Setenv("VEGETA_TEST_BASE_URL", "http://lolcathost:9999")
+	defer os.Unsetenv("VEGETA_TEST_BASE_URL")
+	file, err := ioutil.TempFile("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("GET ${VEGETA_TEST_BASE_URL}/$metadata\n")
+	file.Close()
+
+	targets, err := NewTargetsFromFile(file.Name())
+	if err != nil {
+		t.Fatalf("Couldn't parse targets: %s", err)
+	}
+	if got, want := targets[0].URL.String(), "http://lolcathost:9999/$metadata"; got != want {
+		t.Fatalf("Wrong URL: want %s, got %s", want, got)
+	}
+
+	_, err = NewTargets([]string{"GET http://lolcathost:9999/", "X-Token: ${VEGETA_TEST_UNDEFINED}"})
+	if want := "Line 2: Undefined environment variable `VEGETA_TEST_UNDEFINED`"; err == nil || err.Error() != want {
+		t.Fatalf("Undefined variable wasn't an error: want %q, got %v", want, err)
+	}
+	if targets, err = NewTargets([]string{"GET http://lolcathost:9999/", "X-Token: ${VEGETA_TEST_UNDEFINED}"}, AllowEmptyEnv(true)); err != nil || targets[0].Header.Get("X-Token") != "" {
+		t.Fatalf("Undefined variable wasn't empty: %v", err)
+	}
+}
+
+func TestValidateTargetsFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("GET http://127.0.0.1:9999/\n# A comment\nGET\nPOST http://localhost:9999/ @/nonexistent/body.json\nGET http://lolcathost.invalid/\n")
+	file.Close()
+
+	errs := ValidateTargetsFile(file.Name())
+	want := []string{"Line 3: Invalid request format", "Line 4: Failed to read body", "Line 5: Couldn't resolve `lolcathost.invalid`"}
+	if len(errs) != len(want) {
+		t.Fatalf("Wrong problems: want %d, got %v", len(want), errs)
+	}
+	for i, err := range errs {
+		if !strings.HasPrefix(err.Error(), want[i]) {
+			t.Errorf("Wrong problem: want %s, got %s", want[i], err)
+		}
+	}
+
+	if errs := ValidateTargetsFile(file.Name() + ".missing"); len(errs) != 1 {
+		t.Errorf("Missing targets file wasn't reported: %v", errs)
+	}
+}
+
+func TestNewJSONTargets(t *testing.T) {
+	targets, err := NewJSONTargets(strings.NewReader(`[
+		{"method": "GET", "url": "http://lolcathost:9999/", "header": {"Accept": ["text/html"]}},
+		{"method": "POST", "url": "http://lolcathost:9999/users", "header": {"Content-Type": ["application/json"], "X-Tag": ["a", "b"]}, "body": "eyJuYW1lIjoidmVnZXRhIn0="}
+	]`))
+	if err != nil {
+		t.Fatalf("Couldn't decode valid targets: %s", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Wrong number of targets: want 2, got %d", len(targets))
+	}
+
+	get, post := targets[0], targets[1]
+	if get.Method != "GET" || get.URL.String() != "http://lolcathost:9999/" || get.Header.Get("Accept") != "text/html" {
+		t.Errorf("Wrong first target: %s %s %v", get.Method, get.URL, get.Header)
+	}
+	if post.Method != "POST" || post.URL.Path != "/users" || post.Header.Get("Content-Type") != "application/json" ||
+		!reflect.DeepEqual(post.Header["X-Tag"], []string{"a", "b"}) {
+		t.Errorf("Wrong second target: %s %s %v", post.Method, post.URL, post.Header)
+	}
+	if body, _ := ioutil.ReadAll(post.Body); string(body) != `{"name":"vegeta"}` {
+		t.Errorf("Wrong body: %q", body)
+	}
+}
+
+func TestNewJSONTargetsWeights(t *testing.T) {
+	targets, err := NewJSONTargets(strings.NewReader(`[
+		{"method": "GET", "url": "http://lolcathost:9999/a", "weight": 4},
+		{"method": "GET", "url": "http://lolcathost:9999/b", "weight": 2}
+	]`))
+	if err != nil {
+		t.Fatalf("Couldn't decode valid targets: %s", err)
+	}
+	tr, counts := targets.Targeter(), map[string]int{}
+	for i := 0; i < 6; i++ {
+		target, _ := tr(context.Background())
+		counts[target.URL.Path]++
+	}
+	if want := map[string]int{"/a": 4, "/b": 2}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("Wrong weighted targets: want %v, got %v", want, counts)
+	}
+}
+
+func TestNewJSONTargetsErrors(t *testing.T) {
+	for source, want := range map[string]string{
+		`{"method": "GET"}`: "Invalid JSON targets",
+		`[{"method": "GET", "url": "http://lolcathost:9999/"}, {"url": "http://lolcathost:9999/"}]`: "Target 1: Missing method or url",
+		`[{"method": "GET", "url": "http://lolcathost:9999/", "body": "not base64!"}]`:              "Target 0: Invalid target",
+		`[{"method": "GET", "url": "http://lolcathost:9999/"}, {"method": "GET", "url": "%zz"}]`:    "Target 1: Failed to build request",
+		`[{"method": "GET", "url": "http://lolcathost:9999/", "weight": 0}]`:                        "Target 0: Invalid weight",
+		`[{"method": "get", "url": "http://lolcathost:9999/"}]`:                                     "Target 0: Invalid method",
+		`[{"method": "GET", "url": "http://lolcathost:9999/", "timeout": "soon"}]`:                  "Target 0: Invalid timeout",
+	} {
+		if _, err := NewJSONTargets(strings.NewReader(source)); err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("Wrong error of %s: want %s, got %v", source, want, err)
+		}
+	}
+}
+
+func TestTemplatedTargeter(t *testing.T) {
+	targets, err := NewTargets([]string{"GET http://lolcathost:9999/item/{{.Seq}}?page={{.Seq}}", "X-Paged: true"})
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+	tr := TemplatedTargeter(targets.Targeter())
+	for i, want := range []string{"/item/0?page=0", "/item/1?page=1", "/item/2?page=2"} {
+		req, err := tr(context.Background())
+		if err != nil {
+			t.Fatalf("Request %d failed: %s", i, err)
+		}
+		if got := req.URL.RequestURI(); got != want || req.Header.Get("X-Paged") != "true" {
+			t.Errorf("Wrong request %d: want %s, got %s %v", i, want, got, req.Header)
+		}
+	}
+	if targets[0].URL.RawPath != "/item/{{.Seq}}" {
+		t.Errorf("Target was modified: %s", targets[0].URL)
+	}
+
+	plain, _ := http.NewRequest("GET", "http://lolcathost:9999/", nil)
+	if req, err := TemplatedTargeter(Targets{plain}.Targeter())(context.Background()); err != nil || req != plain {
+		t.Errorf("Target without a template wasn't returned as is: %v (%v)", req, err)
+	}
+	bad, _ := http.NewRequest("GET", "http://lolcathost:9999/{{.Seq", nil)
+	if _, err := TemplatedTargeter(Targets{bad}.Targeter())(context.Background()); err == nil {
+		t.Error("Invalid URL template didn't fail")
+	}
+}
+
+func TestNewTargetsEmpty(t *testing.T) {
+	if _, err := NewTargets([]string{"# Only comments", "", "// and blank lines"}); err != ErrNoTargets {
+		t.Errorf("Targets without any target didn't fail: %v", err)
+	}
+	if _, err := NewJSONTargets(strings.NewReader(`[]`)); err != ErrNoTargets {
+		t.Errorf("JSON targets without any target didn't fail: %v", err)
+	}
+	if _, err := (Targets{}).Targeter()(context.Background()); err != ErrNoTargets {
+		t.Errorf("Targeter of empty Targets didn't fail: %v", err)
+	}
+}
+
+func TestURLTemplatesBound(t *testing.T) {
+	templates := urlTemplates{}
+	first, _ := http.NewRequest("GET", "http://lolcathost:9999/{{.Seq}}", nil)
+	tmpl, err := templates.get(first)
+	if err != nil || tmpl == nil {
+		t.Fatalf("Couldn't parse URL template: %v", err)
+	}
+	if cached, _ := templates.get(first); cached != tmpl {
+		t.Error("URL template wasn't cached")
+	}
+	for i := 0; i < 2*maxURLTemplates; i++ { // Like the fresh targets of a lazy source
+		req, _ := http.NewRequest("GET", "http://lolcathost:9999/"+strconv.Itoa(i)+"/{{.Seq}}", nil)
+		if _, err := templates.get(req); err != nil {
+			t.Fatalf("Couldn't parse URL template %d: %s", i, err)
+		}
+		if len(templates) > maxURLTemplates {
+			t.Fatalf("Cache outgrew its bound: %d templates", len(templates))
+		}
+	}
+}
+
+func TestNewLazyTargeter(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		defer w.Close()
+		for _, line := range []string{
+			"GET http://lolcathost:9999/a",
+			"X-Account: 1",
+			"",
+			"2 POST http://lolcathost:9999/b",
+			"GET",
+			"GET http://lolcathost:9999/c",
+		} {
+			time.Sleep(5 * time.Millisecond) // Streamed as they're generated
+			io.WriteString(w, line+"\n")
+		}
+	}()
+
+	tr := NewLazyTargeter(r)
+	got := []string{}
+	for {
+		req, err := tr(context.Background())
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			got = append(got, err.Error())
+			continue
+		}
+		got = append(got, req.Method+" "+req.URL.Path+" "+req.Header.Get("X-Account"))
+	}
+	want := []string{
+		"GET /a 1",
+		"Line 5: Invalid request format: `GET`",
+		"POST /b ",
+		"POST /b ",
+		"GET /c ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Wrong lazy targets:\nwant %q\ngot  %q", want, got)
+	}
+}
+
+func TestNewLazyTargeterContext(t *testing.T) {
+	r, _ := io.Pipe() // Never written
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := NewLazyTargeter(r)(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Waiting for a target wasn't cancelled: %v", err)
+	}
+}
@@ -3,74 +3,217 @@ package vegeta
 import (
 	"fmt"
 	"io"
+	"sort"
+	"sync"
 	"text/tabwriter"
 	"time"
 )
 
 // TextReporter prints the test results as text
 // Metrics incude avg time per request, success ratio,
-// total number of request, avg bytes in and avg bytes out
+// total number of request, total and avg bytes in and out
 type TextReporter struct {
-	responses []*result
+	// Metadata is printed at the top of the report, e.g. the name of the
+	// run and the commit it attacked
+	Metadata map[string]string
+	// Thresholds are the latencies to report the percentage of responses
+	// below, e.g. to validate SLOs
+	Thresholds []time.Duration
+	// Slowest is the number of the slowest responses to report the details
+	// of, e.g. to chase tail latencies. Only as many responses are retained.
+	Slowest int
+	// Percentiles is the method of the latency percentiles, NearestRank by
+	// default
+	Percentiles PercentileMethod
+	agg         *aggregator
+	slowest     *slowest // Of the Slowest responses, once added any
+	mu          sync.Mutex
 }
 
-// NewTextReporter initializes a TextReporter with n responses
+// NewTextReporter initializes a TextReporter with no responses
 func NewTextReporter() *TextReporter {
-	return &TextReporter{responses: make([]*result, 0)}
+	return &TextReporter{agg: newAggregator()}
 }
 
 // Report computes and writes the report to out.
 // It returns an error in case of failure.
 func (r *TextReporter) Report(out io.Writer) error {
-	totalRequests := len(r.responses)
-	totalTime := time.Duration(0)
-	totalBytesOut := uint64(0)
-	totalBytesIn := uint64(0)
-	totalSuccess := uint64(0)
-	histogram := map[uint64]uint64{}
-	errors := map[string]struct{}{}
-
-	for _, res := range r.responses {
-		histogram[res.code]++
-		totalTime += res.timing
-		totalBytesOut += res.bytesOut
-		totalBytesIn += res.bytesIn
-		if res.code >= 200 && res.code < 300 {
-			totalSuccess++
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.agg.m.Requests == 0 {
+		_, err := fmt.Fprintln(out, "No results recorded")
+		return err
+	}
+	agg := r.agg
+	m := agg.metrics(r.Percentiles)
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
+	if len(r.Metadata) > 0 {
+		keys := make([]string, 0, len(r.Metadata))
+		for key := range r.Metadata {
+			keys = append(keys, key)
 		}
-		if res.err != nil {
-			errors[res.err.Error()] = struct{}{}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s:\t%s\n", key, r.Metadata[key])
 		}
+		fmt.Fprintln(w)
 	}
+	fmt.Fprintf(w, "Time(avg)\tRequests\tRate\tSuccess\tBytes In(total/avg)\tBytes Out(total/avg)\tRedirected\tReused\tDelayed\tTruncated\tRetries\tConn Failures\n")
+	fmt.Fprintf(w, "%s\t%d\t%.2f/s\t%.2f%%\t%s / %s\t%s / %s\t%d\t%d\t%d\t%d\t%d\t%d\n", m.Latencies.Mean, m.Requests, m.Rate, m.Success*100,
+		humanBytes(float64(m.BytesIn.Total)), humanBytes(m.BytesIn.Mean),
+		humanBytes(float64(m.BytesOut.Total)), humanBytes(m.BytesOut.Mean),
+		m.Redirected, m.Reused, m.Delayed, m.Truncated, m.Retries, m.Failures)
 
-	avgTime := time.Duration(float64(totalTime) / float64(totalRequests))
-	avgBytesOut := float64(totalBytesOut) / float64(totalRequests)
-	avgBytesIn := float64(totalBytesIn) / float64(totalRequests)
-	avgSuccess := float64(totalSuccess) / float64(totalRequests)
+	fmt.Fprintf(w, "\nTime(min)\tTime(50th)\tTime(95th)\tTime(99th)\tTime(99.9th)\tTime(max)\tTime(stddev)\tJitter\n")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", m.Latencies.Min, m.Latencies.P50,
+		m.Latencies.P95, m.Latencies.P99, m.Latencies.P999, m.Latencies.Max, m.Latencies.StdDev, m.Jitter)
 
-	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
-	fmt.Fprintf(w, "Time(avg)\tRequests\tSuccess\tBytes(rx/tx)\n")
-	fmt.Fprintf(w, "%s\t%d\t%.2f%%\t%.2f/%.2f\n", avgTime, totalRequests, avgSuccess*100, avgBytesOut, avgBytesIn)
+	fmt.Fprintf(w, "\nTTFB(min)\tTTFB(50th)\tTTFB(95th)\tTTFB(99th)\tTTFB(99.9th)\tTTFB(max)\n")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", m.TTFB.Min, m.TTFB.P50,
+		m.TTFB.P95, m.TTFB.P99, m.TTFB.P999, m.TTFB.Max)
+
+	fmt.Fprintf(w, "\nDNS(avg)\tConnect(avg)\tTLS(avg)\tWait(avg)\tTransfer(avg)\n")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Phases.DNS, m.Phases.Connect,
+		m.Phases.TLS, m.Phases.Wait, m.Phases.Transfer)
+
+	fmt.Fprintf(w, "\nStart\tEnd\tDuration\n")
+	fmt.Fprintf(w, "%s\t%s\t%s\n", m.RunStart.UTC().Format(time.RFC3339Nano),
+		m.RunEnd.UTC().Format(time.RFC3339Nano), m.WallDuration)
 
+	if len(r.Thresholds) > 0 {
+		fmt.Fprintf(w, "\nSLOs:\n")
+		for _, threshold := range r.Thresholds {
+			fmt.Fprintf(w, "%.2f%%\tunder %s\n", agg.under(threshold)*100, threshold)
+		}
+	}
+
+	codes := m.statusCodes()
 	fmt.Fprintf(w, "\nCount:\t")
-	for _, count := range histogram {
-		fmt.Fprintf(w, "%d\t", count)
+	for _, code := range codes {
+		fmt.Fprintf(w, "%d\t", m.StatusCodes[code])
 	}
 	fmt.Fprintf(w, "\nStatus:\t")
-	for code, _ := range histogram {
-		fmt.Fprintf(w, "%d\t", code)
+	for _, code := range codes {
+		fmt.Fprintf(w, "%s\t", statusLabel(code))
+	}
+	fmt.Fprintf(w, "\nTime(avg):\t")
+	for _, code := range codes {
+		fmt.Fprintf(w, "%s\t", m.StatusLatencies[code].Mean)
+	}
+	fmt.Fprintf(w, "\nTime(99th):\t")
+	for _, code := range codes {
+		fmt.Fprintf(w, "%s\t", m.StatusLatencies[code].P99)
+	}
+
+	if len(m.Hosts) > 1 {
+		hosts := make([]string, 0, len(m.Hosts))
+		for host := range m.Hosts {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+
+		fmt.Fprint(w, "\n\nHost\tRequests\tSuccess\tTime(99th)")
+		for _, host := range hosts {
+			h := m.Hosts[host]
+			fmt.Fprintf(w, "\n%s\t%d\t%.2f%%\t%s", host, h.Requests, h.Success*100, h.Latencies.P99)
+		}
+	}
+
+	protocols := make([]string, 0, len(m.Protocols))
+	for proto := range m.Protocols {
+		protocols = append(protocols, proto)
+	}
+	sort.Strings(protocols)
+
+	fmt.Fprintln(w, "\n\nProtocols:")
+	for _, proto := range protocols {
+		fmt.Fprintf(w, "%s:\t%d\n", proto, m.Protocols[proto])
+	}
+
+	if len(m.Headers) > 0 {
+		names := make([]string, 0, len(m.Headers))
+		for name := range m.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintln(w, "\nHeaders:")
+		for _, name := range names {
+			values := make([]string, 0, len(m.Headers[name]))
+			for value := range m.Headers[name] {
+				values = append(values, value)
+			}
+			sort.Strings(values)
+			for _, value := range values {
+				fmt.Fprintf(w, "%s: %s\t%d\n", name, value, m.Headers[name][value])
+			}
+		}
+	}
+
+	categories := make([]string, 0, len(m.ErrorCategories))
+	for category := range m.ErrorCategories {
+		categories = append(categories, category)
 	}
+	sort.Strings(categories)
 
-	fmt.Fprintln(w, "\n\nError Set:")
-	for err, _ := range errors {
-		fmt.Fprintln(w, err)
+	fmt.Fprintln(w, "\nError Categories:")
+	for _, category := range categories {
+		fmt.Fprintf(w, "%s:\t%d\n", category, m.ErrorCategories[category])
+	}
+
+	fmt.Fprintln(w, "\nError Set:")
+	for _, err := range m.errorsByCount() {
+		fmt.Fprintf(w, "%d\t%s\n", m.ErrorCounts[err], err)
+	}
+
+	if r.slowest != nil {
+		fmt.Fprintln(w, "\nSlowest:\nTimestamp\tStatus\tTime\tURL")
+		for _, res := range r.slowest.sorted() {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", res.timestamp.Format(time.RFC3339Nano), res.code, res.timing, res.url)
+		}
 	}
 
 	return w.Flush()
 }
 
-// add adds a response to be used in the report
+// byteUnits are the binary units of humanBytes
+var byteUnits = []string{"KiB", "MiB", "GiB"}
+
+// humanBytes formats a quantity of bytes in the largest binary unit
+// it amounts to at least one of, e.g. 1.5 KiB
+func humanBytes(n float64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	unit := ""
+	for _, unit = range byteUnits {
+		if n /= 1024; n < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f %s", n, unit)
+}
+
+// add aggregates a response to be used in the report, retaining it only
+// if it's one of the Slowest so far
 // Order of arrival is not relevant for this reporter
-func (r *TextReporter) add(res *result) {
-	r.responses = append(r.responses, res)
+func (r *TextReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg.add(res)
+	if r.Slowest > 0 {
+		if r.slowest == nil {
+			r.slowest = newSlowest(r.Slowest)
+		}
+		r.slowest.add(res)
+	}
+	return nil
+}
+
+// Reset clears the responses
+func (r *TextReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agg, r.slowest = newAggregator(), nil
 }
@@ -0,0 +1,330 @@
+package vegeta
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextReporterRequests(t *testing.T) {
+	rep := NewTextReporter()
+	for i := 0; i < 3; i++ {
+		rep.add(&result{code: 200, timestamp: time.Now(), timing: time.Millisecond})
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if fields := strings.Fields(lines[1]); len(fields) < 2 || fields[1] != "3" {
+		t.Fatalf("Wrong number of requests reported. Got: %s", lines[1])
+	}
+}
+
+func TestTextReporterPercentiles(t *testing.T) {
+	rep := NewTextReporter()
+	for i := 100; i > 0; i-- { // Out of order on purpose
+		rep.add(&result{code: 200, timing: time.Duration(i) * time.Millisecond})
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	want := []string{"1ms", "50ms", "95ms", "99ms", "100ms", "100ms"}
+	if got := strings.Fields(lines[4])[:len(want)]; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("Wrong percentiles reported: want %v, got %v", want, got)
+	}
+
+	rep.Percentiles = Linear
+	out.Reset()
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines = strings.Split(out.String(), "\n")
+	want = []string{"1ms", "50.5ms", "95.05ms", "99.01ms", "99.901ms", "100ms"}
+	if got := strings.Fields(lines[4])[:len(want)]; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("Wrong linear percentiles reported: want %v, got %v", want, got)
+	}
+}
+
+func TestTextReporterNoResults(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := NewTextReporter().Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if report := out.String(); !strings.Contains(report, "No results recorded") ||
+		strings.Contains(report, "NaN") {
+		t.Fatalf("Wrong report of no results. Got: %s", report)
+	}
+}
+
+func TestTextReporterDeterministic(t *testing.T) {
+	rep := NewTextReporter()
+	for i, code := range []uint64{503, 200, 404, 500, 201, 409, 302} {
+		rep.add(&result{
+			code:   code,
+			timing: time.Duration(i) * time.Millisecond,
+			err:    errors.New(strconv.FormatUint(code, 10)),
+		})
+	}
+	first, second := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := rep.Report(first); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if err := rep.Report(second); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if first.String() != second.String() {
+		t.Fatalf("Reports differ:\n%s\n%s", first, second)
+	}
+	if !strings.Contains(first.String(), "200\t201\t302\t404\t409\t500\t503") {
+		t.Fatalf("Status codes not sorted. Got: %s", first)
+	}
+}
+
+func TestTextReporterStatusCodeTimings(t *testing.T) {
+	rep := NewTextReporter()
+	for i := 1; i <= 10; i++ {
+		rep.add(&result{code: 200, timing: time.Duration(i) * time.Millisecond})
+	}
+	rep.add(&result{code: 500, timing: time.Second})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	rows := map[string][]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			rows[fields[0]] = fields[1:]
+		}
+	}
+	for row, want := range map[string][]string{
+		"Status:":     {"200", "500"},
+		"Time(avg):":  {"5.5ms", "1s"},
+		"Time(99th):": {"10ms", "1s"},
+	} {
+		if got := rows[row]; strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("Wrong %s row: want %v, got %v", row, want, got)
+		}
+	}
+}
+
+func TestTextReporterErrorCategories(t *testing.T) {
+	rep := NewTextReporter()
+	rep.add(&result{err: timeoutError{}})
+	rep.add(&result{err: timeoutError{}})
+	rep.add(&result{code: 500, err: errors.New("Internal Server Error")})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	rows := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			rows[fields[0]] = fields[1]
+		}
+	}
+	for category, want := range map[string]string{"other:": "1", "timeout:": "2"} {
+		if rows[category] != want {
+			t.Errorf("Wrong count of %s errors: want %s, got %s", category, want, rows[category])
+		}
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	for n, want := range map[float64]string{
+		0:                         "0 B",
+		251:                       "251 B",
+		1536:                      "1.5 KiB",
+		3 * 1024 * 1024:           "3.0 MiB",
+		1.25 * 1024 * 1024 * 1024: "1.2 GiB",
+		4096 * 1024 * 1024 * 1024: "4096.0 GiB",
+	} {
+		if got := humanBytes(n); got != want {
+			t.Errorf("Wrong formatting of %v bytes: want %s, got %s", n, want, got)
+		}
+	}
+}
+
+func TestTextReporterBytes(t *testing.T) {
+	rep := NewTextReporter()
+	rep.add(&result{code: 200, bytesIn: 1024, bytesOut: 10})
+	rep.add(&result{code: 200, bytesIn: 2048, bytesOut: 10})
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	line := strings.Split(out.String(), "\n")[1]
+	if !strings.Contains(line, "3.0 KiB / 1.5 KiB") || !strings.Contains(line, "20 B / 10 B") {
+		t.Fatalf("Wrong bytes totals and averages reported. Got: %s", line)
+	}
+}
+
+func TestTextReporterThresholds(t *testing.T) {
+	rep := NewTextReporter()
+	rep.Thresholds = []time.Duration{200 * time.Millisecond, 50 * time.Millisecond}
+	for i := 1000; i > 1; i-- { // Out of order on purpose
+		rep.add(&result{code: 200, timing: time.Duration(i) * time.Millisecond})
+	}
+	rep.add(&result{code: 200, timing: time.Second})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	rows := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[1] == "under" {
+			rows[fields[2]] = fields[0]
+		}
+	}
+	for threshold, want := range map[string]string{"200ms": "19.80%", "50ms": "4.80%"} {
+		if rows[threshold] != want {
+			t.Errorf("Wrong percentage under %s: want %s, got %s", threshold, want, rows[threshold])
+		}
+	}
+}
+
+func TestTextReporterSlowest(t *testing.T) {
+	rep := NewTextReporter()
+	rep.Slowest = 3
+	began := time.Unix(1375351200, 0).UTC()
+	for i := 0; i < 1000; i++ {
+		rep.add(&result{
+			code:      200,
+			timestamp: began.Add(time.Duration(i) * time.Millisecond),
+			timing:    time.Duration((i*7)%1000) * time.Microsecond,
+			url:       "http://lolcathost:9999/" + strconv.Itoa(i),
+		})
+	}
+	if n := len(rep.slowest.results); n != rep.Slowest {
+		t.Fatalf("Wrong number of retained responses: want %d, got %d", rep.Slowest, n)
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	section := out.String()[strings.Index(out.String(), "Slowest:"):]
+	lines := strings.Split(strings.TrimSpace(section), "\n")[2:]
+	want := []string{
+		"2013-08-01T10:00:00.857Z 200 999µs http://lolcathost:9999/857",
+		"2013-08-01T10:00:00.714Z 200 998µs http://lolcathost:9999/714",
+		"2013-08-01T10:00:00.571Z 200 997µs http://lolcathost:9999/571",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Wrong number of slowest responses: want %d, got %q", len(want), lines)
+	}
+	for i, line := range lines {
+		if got := strings.Join(strings.Fields(line), " "); got != want[i] {
+			t.Errorf("Wrong slowest response: want %s, got %s", want[i], got)
+		}
+	}
+}
+
+func TestTextReporterHosts(t *testing.T) {
+	rep := NewTextReporter()
+	rep.add(&result{code: 200, timing: time.Millisecond, host: "a:80"})
+	rep.add(&result{code: 500, timing: 2 * time.Millisecond, host: "b:80"})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	rows := map[string][]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			rows[fields[0]] = fields[1:]
+		}
+	}
+	for host, want := range map[string][]string{"a:80": {"1", "100.00%", "1ms"}, "b:80": {"1", "0.00%", "2ms"}} {
+		if got := rows[host]; strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("Wrong %s row: want %v, got %v", host, want, got)
+		}
+	}
+}
+
+func TestTextReporterMetadata(t *testing.T) {
+	rep := NewTextReporter()
+	rep.Metadata = map[string]string{"run": "nightly", "commit": "8f3a2c1"}
+	rep.add(&result{code: 200})
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) < 3 || strings.Join(strings.Fields(lines[0]), " ") != "commit: 8f3a2c1" ||
+		strings.Join(strings.Fields(lines[1]), " ") != "run: nightly" || lines[2] != "" {
+		t.Fatalf("Wrong metadata header: %q", lines[:3])
+	}
+}
+
+func TestTextReporterConnectionFailures(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close() // Nothing listens on the address anymore, so connections are refused
+
+	rep := NewTextReporter()
+	request, _ := http.NewRequest("GET", "http://"+ln.Addr().String(), nil)
+	for i := 0; i < 2; i++ {
+		rep.add(NewAttacker().hit(request))
+	}
+	rep.add(&result{code: 200})
+	rep.add(&result{err: os.ErrDeadlineExceeded}) // No response, but connected
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if fields := strings.Fields(lines[1]); fields[len(fields)-1] != "2" {
+		t.Errorf("Wrong failures total: want 2, got %s", lines[1])
+	}
+	rows := map[string]string{}
+	for _, line := range lines {
+		if fields := strings.SplitN(line, ":", 2); len(fields) == 2 {
+			rows[fields[0]] = strings.Join(strings.Fields(fields[1]), " ")
+		}
+	}
+	if got, want := rows["Status"], "connection failures 200"; got != want {
+		t.Errorf("Wrong status row: want %s, got %s", want, got)
+	}
+	if got := rows["connection refused"]; got != "2" {
+		t.Errorf("Wrong count of connection refused errors: want 2, got %s", got)
+	}
+}
+
+func TestTextReporterErrorCounts(t *testing.T) {
+	rep := NewTextReporter()
+	for err, n := range map[string]int{"connection refused": 3, "Not Found": 1, "Internal Server Error": 3, "timeout": 5} {
+		for i := 0; i < n; i++ {
+			rep.add(&result{err: errors.New(err)})
+		}
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	section := out.String()[strings.Index(out.String(), "Error Set:"):]
+	lines := strings.Split(strings.TrimSpace(section), "\n")[1:]
+	want := []string{"5 timeout", "3 Internal Server Error", "3 connection refused", "1 Not Found"}
+	if len(lines) != len(want) {
+		t.Fatalf("Wrong number of errors: want %d, got %q", len(want), lines)
+	}
+	for i, line := range lines {
+		if got := strings.Join(strings.Fields(line), " "); got != want[i] {
+			t.Errorf("Wrong error line %d: want %s, got %s", i, want[i], got)
+		}
+	}
+}
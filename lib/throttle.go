@@ -0,0 +1,82 @@
+package vegeta
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// throttle holds back the hits of an attack while its responses signal rate
+// limiting, with a Retry-After header or an X-RateLimit-Remaining of 0 until
+// its X-RateLimit-Reset, and totals the time they were held back for
+type throttle struct {
+	mu    sync.Mutex
+	until time.Time     // Until when the hits are held back
+	total time.Duration // The time the hits were held back for
+}
+
+// watch forwards the results of in to the returned channel, holding back
+// the hits until the latest time their responses asked to be left alone
+func (t *throttle) watch(in <-chan *result) <-chan *result {
+	out := make(chan *result)
+	go func() {
+		defer close(out)
+		for res := range in {
+			t.mu.Lock()
+			if res.limited.After(t.until) {
+				t.until = res.limited
+			}
+			t.mu.Unlock()
+			out <- res
+		}
+	}()
+	return out
+}
+
+// backoff returns how long the hit due at now is held back, counting it in
+// the total
+func (t *throttle) backoff(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.until.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+	t.total += d
+	return d
+}
+
+// backedOff returns the total time the hits were held back for
+func (t *throttle) backedOff() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// rateLimited returns until when the rate limiting headers of a response
+// received at now ask to be left alone, or the zero time if they don't.
+// Retry-After is either seconds or an HTTP date, and X-RateLimit-Reset
+// either seconds or, when larger than any sensible wait, a Unix time.
+func rateLimited(h http.Header, now time.Time) time.Time {
+	var until time.Time
+	if after := h.Get("Retry-After"); after != "" {
+		if s, err := strconv.ParseUint(after, 10, 32); err == nil {
+			until = now.Add(time.Duration(s) * time.Second)
+		} else if t, err := http.ParseTime(after); err == nil {
+			until = t
+		}
+	}
+	if h.Get("X-RateLimit-Remaining") == "0" {
+		if s, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil && s >= 0 {
+			reset := now.Add(time.Duration(s) * time.Second)
+			if s > 1e9 {
+				reset = time.Unix(s, 0)
+			}
+			if reset.After(until) {
+				until = reset
+			}
+		}
+	}
+	return until
+}
@@ -0,0 +1,57 @@
+package vegeta
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimited(t *testing.T) {
+	now := time.Unix(1375351200, 0).UTC()
+	for _, tc := range []struct {
+		header http.Header
+		want   time.Time
+	}{
+		{http.Header{}, time.Time{}},
+		{http.Header{"Retry-After": {"3"}}, now.Add(3 * time.Second)},
+		{http.Header{"Retry-After": {now.Add(time.Minute).Format(http.TimeFormat)}}, now.Add(time.Minute)},
+		{http.Header{"Retry-After": {"soon"}}, time.Time{}},
+		{http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"10"}}, now.Add(10 * time.Second)},
+		{http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1375351230"}}, now.Add(30 * time.Second)},
+		{http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Reset": {"10"}}, time.Time{}},
+	} {
+		if got := rateLimited(tc.header, now); !got.Equal(tc.want) {
+			t.Errorf("Wrong rate limit of %v: want %s, got %s", tc.header, tc.want, got)
+		}
+	}
+}
+
+func TestAttackFollowRateLimits(t *testing.T) {
+	var hits uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint64(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	rep := NewResultsReporter()
+	m, err := NewAttacker(FollowRateLimits(true)).Attack(Targets{request}, 20, 500*time.Millisecond, rep)
+	if err != nil {
+		t.Fatalf("Attack failed: %s", err)
+	}
+	if m.Requests != 10 || len(rep.responses) != 10 {
+		t.Fatalf("Wrong number of requests: want 10, got %d", m.Requests)
+	}
+	first, second := rep.responses[0], rep.responses[1]
+	if gap := second.timestamp.Sub(first.timestamp); gap < 900*time.Millisecond {
+		t.Errorf("Dispatch didn't slow after Retry-After: the next hit followed after %s", gap)
+	}
+	if m.BackedOff < 900*time.Millisecond || m.BackedOff > time.Second {
+		t.Errorf("Wrong time backed off: want about 1s, got %s", m.BackedOff)
+	}
+}
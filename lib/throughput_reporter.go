@@ -0,0 +1,93 @@
+package vegeta
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ThroughputReporter prints the number of requests and successful requests
+// in fixed time windows, so that ramp-up and saturation can be observed
+type ThroughputReporter struct {
+	window time.Duration
+	counts map[int64]*windowCount
+	mu     sync.Mutex
+}
+
+// windowCount holds the counts of a single time window
+type windowCount struct {
+	requests uint64
+	success  uint64
+}
+
+// NewThroughputReporter initializes a ThroughputReporter with the passed
+// window duration
+func NewThroughputReporter(window time.Duration) *ThroughputReporter {
+	return &ThroughputReporter{window: window, counts: map[int64]*windowCount{}}
+}
+
+// Report writes each window's start time, number of requests and number of
+// successful requests to out. Windows without responses between the first
+// and the last one are reported with zero counts.
+// It returns an error in case of failure.
+func (r *ThroughputReporter) Report(out io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
+	fmt.Fprintf(w, "Window\tRequests\tSuccess\n")
+
+	first, last := r.bounds()
+	for i := first; i <= last && len(r.counts) > 0; i++ {
+		count, ok := r.counts[i]
+		if !ok {
+			count = &windowCount{}
+		}
+		start := time.Unix(0, i*int64(r.window)).UTC()
+		fmt.Fprintf(w, "%s\t%d\t%d\n", start.Format(time.RFC3339Nano), count.requests, count.success)
+	}
+	return w.Flush()
+}
+
+// bounds returns the indexes of the first and last windows with responses
+func (r *ThroughputReporter) bounds() (first, last int64) {
+	started := false
+	for i := range r.counts {
+		if !started || i < first {
+			first = i
+		}
+		if !started || i > last {
+			last = i
+		}
+		started = true
+	}
+	return first, last
+}
+
+// add counts a response in the window its timestamp falls into
+// Order of arrival is not relevant for this reporter
+func (r *ThroughputReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := res.timestamp.UnixNano() / int64(r.window)
+	count, ok := r.counts[i]
+	if !ok {
+		count = &windowCount{}
+		r.counts[i] = count
+	}
+	count.requests++
+	if res.successful() {
+		count.success++
+	}
+	return nil
+}
+
+// Reset clears the window counts
+func (r *ThroughputReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for window := range r.counts {
+		delete(r.counts, window)
+	}
+}
@@ -0,0 +1,42 @@
+package vegeta
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThroughputReporter(t *testing.T) {
+	began := time.Date(2013, 8, 1, 10, 0, 0, 0, time.UTC)
+	rep := NewThroughputReporter(time.Second)
+	for _, res := range []*result{
+		{code: 200, timestamp: began},
+		{code: 500, timestamp: began.Add(500 * time.Millisecond)},
+		{code: 200, timestamp: began.Add(999 * time.Millisecond)},
+		// Nothing within the second window
+		{code: 200, timestamp: began.Add(2 * time.Second)},
+		{code: 200, timestamp: began.Add(2500 * time.Millisecond)},
+	} {
+		rep.add(res)
+	}
+
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")[1:]
+	want := [][]string{
+		{"2013-08-01T10:00:00Z", "3", "2"},
+		{"2013-08-01T10:00:01Z", "0", "0"},
+		{"2013-08-01T10:00:02Z", "2", "2"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Wrong number of windows: want %d, got %d", len(want), len(lines))
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("Wrong window %d: want %v, got %v", i, want[i], got)
+		}
+	}
+}
@@ -6,57 +6,57 @@ import (
 	"code.google.com/p/plotinum/plotutil"
 	"code.google.com/p/plotinum/vg"
 	"code.google.com/p/plotinum/vg/vgsvg"
-	"container/list"
+	"image/color"
 	"io"
+	"sort"
+	"sync"
 	"time"
 )
 
+// TimingsPlotReporter plots the latency of each request over the elapsed
+// time of the test as an SVG line chart
 type TimingsPlotReporter struct {
-	responses *list.List
+	responses []*result
+	mu        sync.Mutex
 }
 
 // NewTimingsPlotReporter initializes a TimingsPlotReporter
 func NewTimingsPlotReporter() *TimingsPlotReporter {
-	return &TimingsPlotReporter{responses: list.New()}
+	return &TimingsPlotReporter{responses: make([]*result, 0)}
 }
 
-// add inserts response to be used in the report, sorted by timestamp.
-func (r *TimingsPlotReporter) add(res *result) {
-	// Empty list
-	if r.responses.Len() == 0 {
-		r.responses.PushFront(res)
-		return
-	}
-	// Happened after all others
-	if last := r.responses.Back().Value.(*result); last.timestamp.Before(res.timestamp) {
-		r.responses.PushBack(res)
-		return
-	}
-	// Happened before all others
-	if first := r.responses.Front().Value.(*result); first.timestamp.After(res.timestamp) {
-		r.responses.PushFront(res)
-		return
-	}
-	// O(n) worst case insertion time
-	for e := r.responses.Front(); e != nil; e = e.Next() {
-		needle := e.Value.(*result)
-		if res.timestamp.Before(needle.timestamp) {
-			r.responses.InsertBefore(res, e)
-			return
-		}
-	}
+// add adds a response to be used in the report
+// The responses are sorted by timestamp only once in Report.
+func (r *TimingsPlotReporter) add(res *result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, res)
+	return nil
 }
 
-// Report builds up a plot of the response times of the requests
-// in SVG format and writes it to out
+func (r *TimingsPlotReporter) detailed() {}
+
+// Reset clears the responses
+func (r *TimingsPlotReporter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = r.responses[:0]
+}
+
+// Report builds up a plot of the response times of the requests,
+// sorted by timestamp, in SVG format and writes it to out
 func (r *TimingsPlotReporter) Report(out io.Writer) error {
-	timestamps := make([]time.Time, 0)
-	timings := make([]time.Duration, 0)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.SliceStable(r.responses, func(i, j int) bool {
+		return r.responses[i].timestamp.Before(r.responses[j].timestamp)
+	})
 
-	for e := r.responses.Front(); e != nil; e = e.Next() {
-		r := e.Value.(*result)
-		timestamps = append(timestamps, r.timestamp)
-		timings = append(timings, r.timing)
+	timestamps := make([]time.Time, 0, len(r.responses))
+	timings := make([]time.Duration, 0, len(r.responses))
+	for _, res := range r.responses {
+		timestamps = append(timestamps, res.timestamp)
+		timings = append(timings, res.timing)
 	}
 
 	p, err := plot.New()
@@ -75,9 +75,13 @@ func (r *TimingsPlotReporter) Report(out io.Writer) error {
 	}
 	line.Color = plotutil.Color(1)
 
-	p.Add(line)
+	grid := plotter.NewGrid()
+	grid.Vertical.Color = color.Gray{Y: 220}
+	grid.Horizontal.Color = color.Gray{Y: 220}
+
+	p.Add(grid, line)
 	p.X.Padding = vg.Length(3.0)
-	p.X.Label.Text = "Time elapsed"
+	p.X.Label.Text = "Time elapsed (s)"
 	p.Y.Padding = vg.Length(3.0)
 	p.Y.Label.Text = "Latency (ms)"
 
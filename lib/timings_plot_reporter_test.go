@@ -0,0 +1,126 @@
+package vegeta
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimingsPlotReporterSVG(t *testing.T) {
+	rep := NewTimingsPlotReporter()
+	began, n := time.Now(), 10
+	for i := 0; i < n; i++ {
+		rep.add(&result{timestamp: began.Add(time.Duration(i) * time.Second), timing: time.Duration(i+1) * time.Millisecond})
+	}
+	out := &bytes.Buffer{}
+	if err := rep.Report(out); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	// plotinum draws lines as paths of one moveto and a lineto per point
+	// after the first, nested in groups, and the line of the latencies is
+	// the longest of them
+	dec := xml.NewDecoder(bytes.NewReader(out.Bytes()))
+	root, points := "", 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Report isn't well formed XML: %s", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root == "" {
+			root = start.Name.Local
+		}
+		if start.Name.Local != "path" {
+			continue
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Local != "d" {
+				continue
+			}
+			if n := strings.Count(attr.Value, "M") + strings.Count(attr.Value, "L"); n > points {
+				points = n
+			}
+		}
+	}
+	if root != "svg" {
+		t.Fatalf("Wrong root element: want svg, got %s", root)
+	}
+	if points != n {
+		t.Fatalf("Wrong number of plotted points: want %d, got %d", n, points)
+	}
+}
+
+func TestTimingsPlotReporterOrdering(t *testing.T) {
+	rep := NewTimingsPlotReporter()
+	began := time.Now()
+	for _, i := range rand.Perm(1000) {
+		rep.add(&result{timestamp: began.Add(time.Duration(i) * time.Millisecond)})
+	}
+	if err := rep.Report(ioutil.Discard); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	for i := 1; i < len(rep.responses); i++ {
+		if rep.responses[i].timestamp.Before(rep.responses[i-1].timestamp) {
+			t.Fatalf("Responses not ordered by timestamp at %d", i)
+		}
+	}
+}
+
+// shuffledResults returns n results with shuffled timestamps
+func shuffledResults(n int) []*result {
+	began := time.Now()
+	results := make([]*result, n)
+	for i, j := range rand.Perm(n) {
+		results[i] = &result{timestamp: began.Add(time.Duration(j) * time.Microsecond)}
+	}
+	return results
+}
+
+// listInsert is the former sorted linked list insertion of the reporter,
+// kept to benchmark against
+func listInsert(l *list.List, res *result) {
+	for e := l.Front(); e != nil; e = e.Next() {
+		if res.timestamp.Before(e.Value.(*result).timestamp) {
+			l.InsertBefore(res, e)
+			return
+		}
+	}
+	l.PushBack(res)
+}
+
+func BenchmarkTimingsPlotReporterListInsert(b *testing.B) {
+	results := shuffledResults(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := list.New()
+		for _, res := range results {
+			listInsert(l, res)
+		}
+	}
+}
+
+func BenchmarkTimingsPlotReporterAdd(b *testing.B) {
+	results := shuffledResults(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rep := NewTimingsPlotReporter()
+		for _, res := range results {
+			rep.add(res)
+		}
+		sort.SliceStable(rep.responses, func(i, j int) bool {
+			return rep.responses[i].timestamp.Before(rep.responses[j].timestamp)
+		})
+	}
+}
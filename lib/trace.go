@@ -0,0 +1,104 @@
+package vegeta
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// phases are the timings of the phases of a request
+type phases struct {
+	dns      time.Duration // Resolving the host
+	connect  time.Duration // Establishing the connection
+	tls      time.Duration // The TLS handshake
+	wait     time.Duration // From sending the request to its first response byte
+	transfer time.Duration // From the first response byte to the end of the body
+}
+
+// tracer records the phases of a request, and of its redirects, out of
+// its httptrace events, which can be concurrent, timing them by clock
+type tracer struct {
+	clock                            Clock
+	mu                               sync.Mutex
+	dnsStart, connectStart, tlsStart time.Time
+	gotConn, firstByte               time.Time
+	phases                           phases
+	reused                           bool
+}
+
+// newTracer initializes a tracer timing the events by clock, which must be
+// the one the request is timed by for its phases to add up to its latency
+func newTracer(clock Clock) *tracer {
+	return &tracer{clock: clock}
+}
+
+// clientTrace returns the httptrace.ClientTrace recording into t
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.start(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.end(&t.dnsStart, &t.phases.dns) },
+		ConnectStart: func(string, string) {
+			t.start(&t.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.end(&t.connectStart, &t.phases.connect)
+		},
+		TLSHandshakeStart: func() { t.start(&t.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.end(&t.tlsStart, &t.phases.tls)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.gotConn, t.reused = t.clock.Now(), info.Reused
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = t.clock.Now()
+			t.phases.wait += t.firstByte.Sub(t.gotConn)
+		},
+	}
+}
+
+// start records the start of a phase at *at
+func (t *tracer) start(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*at = t.clock.Now()
+}
+
+// end adds the time since the start of a phase to its duration d
+func (t *tracer) end(start *time.Time, d *time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*d += t.clock.Now().Sub(*start)
+}
+
+// done returns the recorded phases of a request which ended at end and
+// whether its connection was reused
+func (t *tracer) done(end time.Time) (phases, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.firstByte.IsZero() {
+		t.phases.transfer = end.Sub(t.firstByte)
+	}
+	return t.phases, t.reused
+}
+
+// ttfb returns the time from began to the first byte of the last response,
+// which is never after end, or zero without a response
+func (t *tracer) ttfb(began, end time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.firstByte.IsZero():
+		return 0
+	case t.firstByte.After(end):
+		return end.Sub(began)
+	case t.firstByte.Before(began):
+		return 0
+	}
+	return t.firstByte.Sub(began)
+}
@@ -0,0 +1,115 @@
+package vegeta
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHitPhases(t *testing.T) {
+	server := httptest.NewTLSServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte("first"))
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte("last"))
+		}),
+	)
+	defer server.Close()
+
+	// Resolve localhost instead of dialing the IP of the server right away
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	request, _ := http.NewRequest("GET", url, nil)
+	r := NewAttacker(TLSConfig(&tls.Config{InsecureSkipVerify: true})).hit(request)
+	if r.err != nil {
+		t.Fatalf("Hit failed: %s", r.err)
+	}
+
+	p := r.phases
+	if p.dns <= 0 || p.connect <= 0 || p.tls <= 0 {
+		t.Errorf("Connection phases weren't recorded: %+v", p)
+	}
+	if p.wait < 15*time.Millisecond || p.transfer < 15*time.Millisecond { // Network delays vary
+		t.Errorf("Response phases weren't recorded: %+v", p)
+	}
+	if sum := p.dns + p.connect + p.tls + p.wait + p.transfer; sum > r.timing || sum < r.timing*9/10 {
+		t.Errorf("Phases don't add up to the latency: %s of %s (%+v)", sum, r.timing, p)
+	}
+}
+
+func TestHitTTFB(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond) // Streaming the body
+			w.Write([]byte("body"))
+		}),
+	)
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	r := NewAttacker().hit(request)
+	if r.err != nil {
+		t.Fatalf("Hit failed: %s", r.err)
+	}
+	if r.ttfb <= 0 || r.ttfb > r.timing || r.ttfb > 50*time.Millisecond {
+		t.Fatalf("Wrong TTFB: want well below the latency of %s, got %s", r.timing, r.ttfb)
+	}
+
+	m := newMetrics([]*result{r, {code: 0, timing: time.Second}}, NearestRank)
+	if m.TTFB.Max != r.ttfb || m.Latencies.Max != time.Second {
+		t.Fatalf("Wrong TTFB metrics: want max %s, got %+v", r.ttfb, m.TTFB)
+	}
+}
+
+func TestTracerClock(t *testing.T) {
+	began := time.Unix(1375351200, 0)
+	clock := newFakeClock(began)
+	tr := newTracer(clock)
+	trace := tr.clientTrace()
+	trace.DNSStart(httptrace.DNSStartInfo{})
+	clock.After(time.Millisecond)
+	trace.DNSDone(httptrace.DNSDoneInfo{})
+	trace.ConnectStart("tcp", "localhost:80")
+	clock.After(2 * time.Millisecond)
+	trace.ConnectDone("tcp", "localhost:80", nil)
+	trace.GotConn(httptrace.GotConnInfo{})
+	clock.After(3 * time.Millisecond)
+	trace.GotFirstResponseByte()
+	clock.After(4 * time.Millisecond)
+
+	end := clock.Now()
+	want := phases{dns: time.Millisecond, connect: 2 * time.Millisecond, wait: 3 * time.Millisecond, transfer: 4 * time.Millisecond}
+	if got, _ := tr.done(end); got != want {
+		t.Errorf("Wrong phases: want %+v, got %+v", want, got)
+	}
+	if got := tr.ttfb(began, end); got != 6*time.Millisecond {
+		t.Errorf("Wrong TTFB: want 6ms, got %s", got)
+	}
+}
+
+func TestHitPhasesClock(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+			w.Write([]byte("body"))
+		}),
+	)
+	defer server.Close()
+
+	// The fake clock stands still, so must every phase of the hit
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	r := NewAttacker(WithClock(newFakeClock(time.Unix(0, 0)))).hit(request)
+	if r.err != nil {
+		t.Fatalf("Hit failed: %s", r.err)
+	}
+	if r.timing != 0 || r.ttfb != 0 || r.phases != (phases{}) {
+		t.Errorf("Hit wasn't timed by its clock: timing %s, ttfb %s, phases %+v", r.timing, r.ttfb, r.phases)
+	}
+}
@@ -0,0 +1,44 @@
+package vegeta
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Validator describes the expectations of the responses of an attack.
+// Responses which fail them are recorded with a validation error and
+// aren't counted as successful, whatever their status code.
+type Validator struct {
+	// Codes is the set of expected status codes. Empty means any.
+	Codes []uint64
+	// Body is the expression which the body of each response must
+	// match. Nil means any.
+	Body *regexp.Regexp
+}
+
+// validationError is the error of a response which failed its Validator
+type validationError string
+
+func (e validationError) Error() string { return string(e) }
+
+// validate returns the validationError of the response with the passed
+// status code and body, if any
+func (v *Validator) validate(code uint64, body []byte) error {
+	if len(v.Codes) > 0 && !v.expects(code) {
+		return validationError(fmt.Sprintf("unexpected status code %d", code))
+	}
+	if v.Body != nil && !v.Body.Match(body) {
+		return validationError(fmt.Sprintf("body doesn't match %s", v.Body))
+	}
+	return nil
+}
+
+// expects returns whether code is one of the expected status codes
+func (v *Validator) expects(code uint64) bool {
+	for _, c := range v.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
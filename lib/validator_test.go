@@ -0,0 +1,52 @@
+package vegeta
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestAttackValidate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte(`{"status": "ok"}`))
+		case "/maintenance":
+			w.Write([]byte("Down for maintenance"))
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	a := NewAttacker(Validate(Validator{
+		Codes: []uint64{200},
+		Body:  regexp.MustCompile(`"status": "ok"`),
+	}))
+	results := []*result{}
+	for _, path := range []string{"/ok", "/maintenance", "/empty"} {
+		request, _ := http.NewRequest("GET", server.URL+path, nil)
+		results = append(results, a.hit(request))
+	}
+
+	if r := results[0]; r.err != nil {
+		t.Errorf("Valid response failed validation: %s", r.err)
+	}
+	for i, want := range map[int]string{
+		1: "body doesn't match \"status\": \"ok\"",
+		2: "unexpected status code 204",
+	} {
+		if r := results[i]; r.code < 200 || r.code >= 300 || r.err == nil || r.err.Error() != want {
+			t.Errorf("Wrong validation of %d response: want %q, got %v", r.code, want, r.err)
+		}
+	}
+
+	m := newMetrics(results, NearestRank)
+	if want := 1 / 3.0; m.Success != want {
+		t.Errorf("Invalid responses were successful: want %f, got %f", want, m.Success)
+	}
+	if m.ErrorCategories[errValidation] != 2 {
+		t.Errorf("Wrong validation errors count: %v", m.ErrorCategories)
+	}
+}
@@ -0,0 +1,56 @@
+package vegeta
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// websocketGUID is the GUID a server appends to the Sec-WebSocket-Key of a
+// handshake to compute its Sec-WebSocket-Accept, see RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// handshakeError is the error of a WebSocket upgrade which failed
+type handshakeError string
+
+func (e handshakeError) Error() string { return string(e) }
+
+// upgradeRequest turns req into the handshake of a WebSocket upgrade, with
+// a random Sec-WebSocket-Key unless it has one. The ws and wss schemes are
+// sent as http and https.
+func upgradeRequest(req *http.Request) {
+	switch req.URL.Scheme {
+	case "ws":
+		req.URL.Scheme = "http"
+	case "wss":
+		req.URL.Scheme = "https"
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if req.Header.Get("Sec-WebSocket-Key") == "" {
+		key := make([]byte, 16)
+		rand.Read(key)
+		req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+	}
+}
+
+// checkUpgrade returns the handshakeError of the response r to the WebSocket
+// upgrade req, unless it switched protocols to websocket with the
+// Sec-WebSocket-Accept of its key
+func checkUpgrade(req *http.Request, r *http.Response) error {
+	if r.StatusCode != http.StatusSwitchingProtocols {
+		return handshakeError(fmt.Sprintf("websocket upgrade refused with status code %d", r.StatusCode))
+	}
+	if upgrade := r.Header.Get("Upgrade"); !strings.EqualFold(upgrade, "websocket") {
+		return handshakeError(fmt.Sprintf("websocket upgrade switched to `%s`", upgrade))
+	}
+	sum := sha1.Sum([]byte(req.Header.Get("Sec-WebSocket-Key") + websocketGUID))
+	if r.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return handshakeError("websocket upgrade with a wrong Sec-WebSocket-Accept")
+	}
+	return nil
+}
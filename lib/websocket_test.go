@@ -0,0 +1,62 @@
+package vegeta
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAttackWebSocket(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			http.Error(w, "Not a WebSocket handshake", http.StatusBadRequest)
+			return
+		}
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n")
+		buf.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+		buf.Flush()
+		conn.Read(make([]byte, 1)) // Held open until the client closes it
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Not upgrading"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for path, want := range map[string]float64{"/ws": 1, "/plain": 0} {
+		targets, _ := NewTargets([]string{"GET " + server.URL + path})
+		a := NewAttacker(WebSocket(true), MaxRequests(5), Timeout(time.Second))
+		m, err := a.AttackTargeter(context.Background(), targets.Targeter(), 100, time.Second, NewTextReporter())
+		if err != nil {
+			t.Fatalf("Attack failed: %s", err)
+		}
+		if m.Requests != 5 || m.Success != want {
+			t.Errorf("Wrong upgrades of %s: want success %v, got %v of %d", path, want, m.Success, m.Requests)
+		}
+		if failures := m.ErrorCategories[errHandshake]; want == 0 && failures != 5 || want == 1 && failures != 0 {
+			t.Errorf("Wrong handshake failures of %s: got %v (%v)", path, m.ErrorCategories, m.Errors)
+		}
+	}
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	req, _ := http.NewRequest("GET", "ws://lolcathost:9999/", nil)
+	upgradeRequest(req)
+	if req.URL.Scheme != "http" || len(req.Header.Get("Sec-WebSocket-Key")) != 24 {
+		t.Fatalf("Wrong handshake: %s %v", req.URL, req.Header)
+	}
+	r := &http.Response{StatusCode: http.StatusSwitchingProtocols, Header: http.Header{}}
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Accept", "wrong")
+	if err := checkUpgrade(req, r); errorCategory(err) != errHandshake {
+		t.Errorf("Wrong Sec-WebSocket-Accept wasn't a handshake error: %v", err)
+	}
+}
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
+	"fmt"
 	vegeta "github.com/tsenart/vegeta/lib"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,70 +32,758 @@ func main() {
 	var (
 		rate     = flag.Uint64("rate", 50, "Requests per second")
 		targetsf = flag.String("targets", "targets.txt", "Targets file")
+		lazy     = flag.Bool("lazy-targets", false, "Read the targets from stdin as they're streamed, in order")
+		urltmpl  = flag.Bool("templated-urls", false, "Substitute {{.Seq}} in the URLs of the targets with the index of each request")
+		emptyenv = flag.Bool("allow-empty-env", false, "Expand undefined environment variables of text targets to empty strings instead of failing")
+		keepgo   = flag.Bool("keep-going", false, "Skip the malformed lines of text targets instead of failing")
+		tformat  = flag.String("targets-format", "text", "Targets file format [text, json]")
 		ordering = flag.String("ordering", "random", "Attack ordering [sequential, random]")
+		pacing   = flag.String("pacing", "constant", "Pacing of the requests [constant, poisson]")
 		duration = flag.Duration("duration", 10*time.Second, "Duration of the test")
-		reporter = flag.String("reporter", "text", "Reporter to use [text, plot:timings]")
+		requests = flag.Uint64("requests", 0, "Max requests of the test, ending it before its duration (0 means unlimited)")
+		slowest  = flag.Int("slowest", 0, "Number of the slowest responses detailed by the text reporter")
+		reporter = flag.String("reporter", "text", "Reporter to use [text[:thresholds], json, csv, influx, prometheus, histogram[:buckets], histogram:auto[:n], histogram:log[:n], throughput, bodies, results, plot:timings, plot:png, html, summary, apdex[:T]]")
 		output   = flag.String("output", "stdout", "Reporter output file")
+		pctiles  = flag.String("percentiles", "nearest-rank", "Method of the latency percentiles [nearest-rank, linear]")
+		digits   = flag.Int("histogram-digits", 3, "Significant digits of the latency histograms of the streamed reports [1-5]")
+		success  = flag.Float64("success-threshold", 0, "Minimum success ratio to exit with a zero status")
+		timeout  = flag.Duration("timeout", 0, "Requests timeout (0 means no timeout)")
+		redirs   = flag.Int("redirects", vegeta.DefaultRedirects, "Number of redirects to follow (-1 to not follow)")
+		host     = flag.String("host", "", "Host header of the requests, independent of the hosts of their URLs")
+		auth     = flag.String("basic-auth", "", "Basic authentication credentials of the requests (user:password)")
+		insecure = flag.Bool("insecure", false, "Skip TLS certificate verification")
+		certs    = flag.String("root-certs", "", "TLS root certificate authorities file (PEM)")
+		cert     = flag.String("cert", "", "TLS client certificate file (PEM)")
+		key      = flag.String("key", "", "TLS client private key file (PEM)")
+		keepaliv = flag.Bool("keepalive", true, "Reuse connections between requests")
+		attempts = flag.Int("max-attempts", 1, "Max attempts of each idempotent request, retrying connection errors")
+		backoff  = flag.Duration("retry-backoff", 100*time.Millisecond, "Wait before the first retry, doubled on every retry")
+		rjitter  = flag.Float64("retry-jitter", 0.5, "Randomized fraction of each wait between retries")
+		retry5xx = flag.Bool("retry-5xx", false, "Retry 5xx responses as well")
+		expcodes = flag.String("expect-codes", "", "Comma separated status codes of the valid responses")
+		okcodes  = flag.String("ok-codes", "", "Comma separated status codes of the successful responses (defaults to 2xx)")
+		expbody  = flag.String("expect-body", "", "Regular expression the body of the valid responses match")
+		seed     = flag.Int64("seed", 0, "Seed of the randomness of the attack (0 means time based)")
+		byterate = flag.Uint64("byte-rate", 0, "Max outbound bytes per second of the request bodies (0 means unlimited)")
+		interval = flag.Duration("progress", 0, "Interval of the progress lines written to stderr (0 means none)")
+		socket   = flag.String("unix-socket", "", "Unix domain socket to connect the requests to instead of their hosts")
+		laddr    = flag.String("local-addr", "", "Local IP address to bind the connections of the requests to")
+		resolver = flag.String("resolver", "", "DNS server address to resolve the hosts of the targets with (defaults to the system resolver)")
+		pindns   = flag.Bool("pin-dns", false, "Resolve the host of each target only once instead of by every new connection")
+		cookies  = flag.Bool("cookies", false, "Send back the cookies set by earlier responses")
+		proxyurl = flag.String("proxy", "", "Proxy URL of the requests (defaults to the HTTP_PROXY and HTTPS_PROXY env vars)")
+		http2    = flag.Bool("http2", false, "Use HTTP/2 with TLS targets which support it")
+		wsocket  = flag.Bool("websocket", false, "Send every request as a WebSocket upgrade handshake and close the upgraded connections")
+		pipeline = flag.Int("pipeline", 0, "Idempotent requests to pipeline on each HTTP/1.1 connection before reading their responses (0 means no pipelining)")
+		conns    = flag.Int("connections", vegeta.DefaultConnections, "Max idle connections per host")
+		workers  = flag.Uint64("workers", 0, "Max concurrent requests (0 means unbounded)")
+		ramp     = flag.Uint64("ramp", 0, "Requests per second to linearly ramp up to from -rate (0 means constant)")
+		bodies   = flag.Int("capture-bodies", 0, "Bytes of each response body to capture for the bodies reporter")
+		capture  = flag.String("capture-headers", "", "Comma separated response headers to tally the values of in the text report")
+		capevery = flag.Uint64("capture-every", 0, "Capture the -capture-headers of only every Nth response (0 means all)")
+		sample   = flag.Uint64("sample", 0, "Report only every Nth response to the reporters detailing each, e.g. csv, at high rates (0 means all)")
+		limits   = flag.Bool("follow-rate-from-header", false, "Back off while responses signal rate limiting with Retry-After or X-RateLimit headers")
+		abortAt  = flag.Float64("abort-on-error-rate", 0, "Ratio of errors over -abort-window which aborts the test (0 means never)")
+		abortWin = flag.Duration("abort-window", 5*time.Second, "Sliding window of time the ratio of errors is computed over")
+		warmup   = flag.Duration("warmup", 0, "Duration of the start of the attack excluded from the report")
+		cooldown = flag.Duration("cooldown", 0, "Duration of the end of the attack excluded from the report")
+		decomp   = flag.Bool("decompress", true, "Decode gzip and deflate compressed responses")
+		maxbody  = flag.Int64("max-body", 0, "Max bytes of each response body to read (0 means unlimited)")
+		errlen   = flag.Int("truncate-errors", 0, "Characters to truncate each error message to (0 means whole)")
+		bodytmpl = flag.String("body-template", "", "Request body template file, with {{.Seq}} and {{.UUID}} substituted per request")
+		inputs   = flag.String("inputs", "", "Comma separated files of saved results to report instead of attacking")
+		compare  = flag.String("compare", "", "Comma separated results files of two runs to compare instead of attacking")
+		validate = flag.Bool("validate", false, "Validate the targets file without attacking")
 	)
+	hdrs := headers{http.Header{}}
+	flag.Var(&hdrs, "header", "Request header to add, repeatable (e.g. \"Accept: text/html\")")
+	meta := metadata{}
+	flag.Var(meta, "metadata", "Metadata of the run carried into the reports, repeatable (e.g. commit=8f3a2c1)")
 	flag.Parse()
 
 	if flag.NFlag() == 0 {
 		flag.Usage()
 		return
 	}
+	topts := []vegeta.TargetsOption{vegeta.AllowEmptyEnv(*emptyenv)}
 
-	if *rate == 0 {
-		log.Fatal("rate can't be zero")
+	if *validate {
+		errs := validateTargets(*targetsf, *tformat, topts...)
+		for _, err := range errs {
+			log.Println(err)
+		}
+		if len(errs) > 0 {
+			log.Fatalf("Found %d problems in `%s`", len(errs), *targetsf)
+		}
+		log.Printf("Targets in `%s` are valid", *targetsf)
+		return
+	}
+
+	var method vegeta.PercentileMethod
+	switch *pctiles {
+	case "linear":
+		method = vegeta.Linear
+	case "nearest-rank":
+		method = vegeta.NearestRank
+	default:
+		log.Fatalf("Unknown percentiles method %s", *pctiles)
+	}
+	if *digits < 1 || *digits > 5 {
+		log.Fatalf("-histogram-digits must be between 1 and 5, got %d", *digits)
+	}
+
+	if *compare != "" {
+		paths := strings.Split(*compare, ",")
+		if len(paths) != 2 {
+			log.Fatal("-compare requires the results files of two runs, e.g. before.json,after.json")
+		}
+		c, err := compareFiles(paths[0], paths[1], method)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := openOutput(*output)
+		if err != nil {
+			log.Fatalf("Couldn't open `%s` for writing report: %s", *output, err)
+		}
+		err = c.Report(out)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			log.Fatalf("Failed to report: %s", err)
+		}
+		return
 	}
 
-	targets, err := vegeta.NewTargetsFromFile(*targetsf)
+	rep, err := newReporter(*reporter)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if len(meta) > 0 {
+		setMetadata(rep, meta)
+	}
+	setPercentiles(rep, method, *digits)
+	if *slowest > 0 {
+		text, ok := rep.(*vegeta.TextReporter)
+		if !ok {
+			log.Fatal("-slowest requires the text reporter")
+		}
+		text.Slowest = *slowest
+	}
 
-	switch *ordering {
-	case "random":
-		targets.Shuffle(time.Now().UnixNano())
-	case "sequential":
-		break
-	default:
-		log.Fatalf("Unknown ordering %s", *ordering)
+	var (
+		out     io.WriteCloser
+		metrics *vegeta.Metrics
+	)
+	if *inputs != "" {
+		log.Printf("Vegeta is merging the results of %s...\n", *inputs)
+		if metrics, err = mergeFiles(rep, strings.Split(*inputs, ","), method); err != nil {
+			log.Fatal(err)
+		}
+		if out, err = openOutput(*output); err != nil {
+			log.Fatalf("Couldn't open `%s` for writing report: %s", *output, err)
+		}
+	} else {
+		if *rate == 0 {
+			log.Fatal("rate can't be zero")
+		}
+
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		log.Printf("Randomizing with seed %d", *seed)
+		rnd := vegeta.NewRand(*seed)
+
+		skipped := 0
+		skip := func(err error) {
+			skipped++
+			log.Printf("Skipping %s", err)
+		}
+		if *keepgo && *tformat != "text" {
+			log.Fatal("-keep-going requires the text targets format")
+		}
+		var targeter vegeta.Targeter
+		if *lazy && *keepgo {
+			targeter = vegeta.NewLazyTargeterKeepGoing(os.Stdin, skip, topts...)
+			log.Printf("Vegeta is attacking the targets of stdin for %s...\n", *duration)
+		} else if *lazy {
+			targeter = vegeta.NewLazyTargeter(os.Stdin, topts...)
+			log.Printf("Vegeta is attacking the targets of stdin for %s...\n", *duration)
+		} else {
+			var targets vegeta.Targets
+			if *keepgo {
+				targets, err = vegeta.NewTargetsFromFileKeepGoing(*targetsf, skip, topts...)
+			} else {
+				targets, err = readTargets(*targetsf, *tformat, topts...)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			switch *ordering {
+			case "random":
+				targets.Shuffle(*seed)
+			case "sequential":
+				break
+			default:
+				log.Fatalf("Unknown ordering %s", *ordering)
+			}
+			targeter = targets.Targeter()
+			log.Printf("Vegeta is attacking %d targets in %s order for %s...\n", len(targets), *ordering, *duration)
+		}
+		if *urltmpl {
+			targeter = vegeta.TemplatedTargeter(targeter)
+		}
+
+		if *duration == 0 {
+			log.Fatal("Duration provided is invalid")
+		}
+
+		var poisson bool
+		switch *pacing {
+		case "poisson":
+			poisson = true
+		case "constant":
+			break
+		default:
+			log.Fatalf("Unknown pacing %s", *pacing)
+		}
+
+		tlsc, err := tlsConfig(*insecure, *certs, *cert, *key)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		validator, err := newValidator(*expcodes, *expbody)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ok, err := parseCodes(*okcodes, "OK")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		user, password, err := basicAuth(*auth)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		local, err := localAddr(*laddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var proxy *url.URL
+		if *proxyurl != "" {
+			if proxy, err = url.Parse(*proxyurl); err != nil {
+				log.Fatalf("Invalid proxy URL: %s", err)
+			}
+		}
+
+		modifiers := []vegeta.RequestModifier{}
+		if *bodytmpl != "" {
+			tmpl, err := newTemplateBody(*bodytmpl, rnd)
+			if err != nil {
+				log.Fatal(err)
+			}
+			modifiers = append(modifiers, tmpl)
+		}
+
+		attacker := vegeta.NewAttacker(
+			vegeta.Timeout(*timeout),
+			vegeta.Headers(hdrs.Header),
+			vegeta.Host(*host),
+			vegeta.BasicAuth(user, password),
+			vegeta.Redirects(*redirs),
+			vegeta.TLSConfig(tlsc),
+			vegeta.KeepAlive(*keepaliv),
+			vegeta.HTTP2(*http2),
+			vegeta.Pipeline(*pipeline),
+			vegeta.WebSocket(*wsocket),
+			vegeta.Connections(*conns),
+			vegeta.Workers(*workers),
+			vegeta.MaxRequests(*requests),
+			vegeta.Ramp(*ramp),
+			vegeta.Poisson(poisson),
+			vegeta.CaptureBodies(*bodies),
+			vegeta.CaptureHeaders(*capevery, headerNames(*capture)...),
+			vegeta.MaxBody(*maxbody),
+			vegeta.TruncateErrors(*errlen),
+			vegeta.Decompress(*decomp),
+			vegeta.Modifiers(modifiers...),
+			vegeta.Warmup(*warmup, *cooldown),
+			vegeta.Sample(*sample),
+			vegeta.Percentiles(method),
+			vegeta.HistogramDigits(*digits),
+			vegeta.Abort(*abortAt, *abortWin),
+			vegeta.FollowRateLimits(*limits),
+			vegeta.Proxy(proxy),
+			vegeta.Cookies(*cookies),
+			vegeta.Validate(validator),
+			vegeta.OKCodes(ok...),
+			vegeta.Rand(rnd),
+			vegeta.ByteRate(*byterate),
+			vegeta.Progress(os.Stderr, *interval),
+			vegeta.UnixSocket(*socket),
+			vegeta.LocalAddr(local),
+			vegeta.Resolver(*resolver),
+			vegeta.PinDNS(*pindns),
+			vegeta.Retry(vegeta.RetryPolicy{
+				Attempts:     *attempts,
+				Backoff:      *backoff,
+				Jitter:       *rjitter,
+				ServerErrors: *retry5xx,
+			}),
+		)
+
+		// Opened once every flag is valid, so that a typo doesn't wipe the
+		// report of an earlier run
+		out, err = openOutput(*output)
+		if err != nil {
+			log.Fatalf("Couldn't open `%s` for writing report: %s", *output, err)
+		}
+
+		// Interrupting the attack stops it early and still reports
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		metrics, err = attacker.AttackTargeter(ctx, targeter, *rate, *duration, rep)
+		if ctx.Err() != nil {
+			log.Println("Interrupted!")
+		}
+		stop()
+		if err != nil {
+			log.Fatalf("Failed to report: %s", err)
+		}
+		if metrics.Aborted != "" {
+			log.Printf("Aborted: %s", metrics.Aborted)
+		}
+		if metrics.BackedOff > 0 {
+			log.Printf("Backed off for %s by rate limiting headers", metrics.BackedOff)
+		}
+		log.Println("Done!")
+		log.Println(achievedRate(metrics, *rate))
+		if *byterate > 0 {
+			log.Printf("Achieved %.2f bytes per second out of the cap of %d", metrics.ByteRate, *byterate)
+		}
+		if metrics.Warmup > 0 {
+			log.Printf("Excluded %d warmup requests", metrics.Warmup)
+		}
+		if metrics.Sampled > 0 {
+			log.Printf("Reported %d sampled responses out of %d", metrics.Sampled, metrics.Requests)
+		}
+		if skipped > 0 {
+			log.Printf("Skipped %d malformed target lines", skipped)
+		}
 	}
 
-	if *duration == 0 {
-		log.Fatal("Duration provided is invalid")
+	log.Printf("Writing report to '%s'...", *output)
+	err = report(rep, out, metrics, *success)
+	if cerr := out.Close(); cerr != nil {
+		log.Fatalf("Couldn't close `%s`: %s", *output, cerr)
+	}
+	if err != nil {
+		log.Fatal(err)
 	}
+}
 
-	var rep vegeta.Reporter
-	switch *reporter {
+// readTargets reads the targets of the file at path in format, with opts
+// applying to the text format
+func readTargets(path, format string, opts ...vegeta.TargetsOption) (vegeta.Targets, error) {
+	switch format {
 	case "text":
-		rep = vegeta.NewTextReporter()
-	case "plot:timings":
-		rep = vegeta.NewTimingsPlotReporter()
-	default:
-		log.Println("Reporter provided is not supported. using text")
-		rep = vegeta.NewTextReporter()
+		return vegeta.NewTargetsFromFile(path, opts...)
+	case "json":
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return vegeta.NewJSONTargets(file)
 	}
+	return nil, fmt.Errorf("Unknown targets format %s", format)
+}
 
-	var out io.Writer
-	switch *output {
-	case "stdout":
-		out = os.Stdout
-	default:
-		file, err := os.Create(*output)
+// validateTargets returns the problems of the targets of the file at path
+// in format. Only the text format has its hosts resolved.
+func validateTargets(path, format string, opts ...vegeta.TargetsOption) []error {
+	if format == "text" {
+		return vegeta.ValidateTargetsFile(path, opts...)
+	}
+	if _, err := readTargets(path, format, opts...); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// newTemplateBody parses the request body template in the file at path,
+// whose UUIDs are read from rnd
+func newTemplateBody(path string, rnd io.Reader) (*vegeta.TemplateBody, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read body template: %s", err)
+	}
+	tmpl, err := vegeta.NewTemplateBody(string(text), rnd)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid body template: %s", err)
+	}
+	return tmpl, nil
+}
+
+// achievedRate describes the rate achieved by an attack relative to the
+// requested one
+func achievedRate(m *vegeta.Metrics, requested uint64) string {
+	return fmt.Sprintf("Achieved %.2f requests per second, %.2f%% of the requested %d",
+		m.Rate, m.Rate/float64(requested)*100, requested)
+}
+
+// tlsConfig builds the TLS configuration of the attack out of the
+// verification switch, root certificate authorities file and client
+// certificate and key files, which are all optional
+func tlsConfig(insecure bool, certs, cert, key string) (*tls.Config, error) {
+	c := &tls.Config{InsecureSkipVerify: insecure}
+	if certs != "" {
+		pem, err := ioutil.ReadFile(certs)
 		if err != nil {
-			log.Fatalf("Couldn't open `%s` for writing report: %s", *output, err)
+			return nil, fmt.Errorf("Couldn't read root certificates: %s", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No valid root certificates in `%s`", certs)
 		}
-		defer file.Close()
-		out = file
 	}
+	if cert != "" || key != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't load client certificate: %s", err)
+		}
+		c.Certificates = []tls.Certificate{pair}
+	}
+	return c, nil
+}
 
-	log.Printf("Vegeta is attacking %d targets in %s order for %s...\n", len(targets), *ordering, *duration)
-	vegeta.Attack(targets, *rate, *duration, rep)
-	log.Println("Done!")
+// metadata is a flag.Value accumulating the repeated -metadata flags
+type metadata map[string]string
 
-	log.Printf("Writing report to '%s'...", *output)
-	if rep.Report(out) != nil {
-		log.Println("Failed to report!")
+// String returns the metadata as comma separated key=value pairs
+func (m metadata) String() string {
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses and adds a pair in the "key=value" format
+func (m metadata) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("Invalid metadata format: `%s`", value)
+	}
+	m[parts[0]] = parts[1]
+	return nil
+}
+
+// setMetadata sets the metadata of the reporters which carry it, which are
+// the text, json, influx and prometheus ones
+func setMetadata(rep vegeta.Reporter, m metadata) {
+	switch rep := rep.(type) {
+	case *vegeta.TextReporter:
+		rep.Metadata = m
+	case *vegeta.JSONReporter:
+		rep.Metadata = m
+	case *vegeta.InfluxReporter:
+		rep.Metadata = m
+	case *vegeta.PrometheusReporter:
+		rep.Metadata = m
+	}
+}
+
+// setPercentiles sets the method of the latency percentiles of the
+// reporters which compute them, which are the text, json, html, summary and
+// jsonlines ones, and the significant digits of the histograms of the latter
+// two
+func setPercentiles(rep vegeta.Reporter, method vegeta.PercentileMethod, digits int) {
+	switch rep := rep.(type) {
+	case *vegeta.TextReporter:
+		rep.Percentiles = method
+	case *vegeta.JSONReporter:
+		rep.Percentiles = method
+	case *vegeta.HTMLReporter:
+		rep.Percentiles = method
+	case *vegeta.SummaryReporter:
+		rep.Percentiles, rep.Digits = method, digits
+	case *vegeta.JSONLinesReporter:
+		rep.Percentiles, rep.Digits = method, digits
+	}
+}
+
+// headers is a flag.Value accumulating the repeated -header flags
+type headers struct{ http.Header }
+
+// String returns the headers in wire format
+func (h headers) String() string {
+	buf := &bytes.Buffer{}
+	h.Write(buf)
+	return buf.String()
+}
+
+// Set parses and adds a header in the "Key: Value" format
+func (h headers) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid header format: `%s`", value)
+	}
+	key, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if key == "" {
+		return fmt.Errorf("Invalid header format: `%s`", value)
+	}
+	h.Add(key, val)
+	return nil
+}
+
+// stdout wraps os.Stdout so that it isn't closed after the report
+type stdout struct{ io.Writer }
+
+// Close is a no-op
+func (stdout) Close() error { return nil }
+
+// openOutput opens the report output, truncating the file at path unless
+// it is "stdout"
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "stdout" {
+		return stdout{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// mergeFiles merges the results saved in the files at paths into rep,
+// computing their Metrics with the percentiles of method
+func mergeFiles(rep vegeta.Reporter, paths []string, method vegeta.PercentileMethod) (*vegeta.Metrics, error) {
+	ins := make([]io.Reader, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't open results: %s", err)
+		}
+		defer f.Close()
+		ins = append(ins, f)
+	}
+	m, err := vegeta.MergePercentiles(method, rep, ins...)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't merge results: %s", err)
+	}
+	return m, nil
+}
+
+// compareFiles compares the Metrics of the results files of two runs, with
+// the percentiles of method
+func compareFiles(before, after string, method vegeta.PercentileMethod) (*vegeta.Comparison, error) {
+	ms := make([]*vegeta.Metrics, 0, 2)
+	for _, path := range []string{before, after} {
+		m, err := mergeFiles(vegeta.NewSummaryReporter(), []string{path}, method)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return vegeta.Compare(ms[0], ms[1]), nil
+}
+
+// reporters are the names of the supported reporters
+var reporters = []string{
+	"text[:thresholds]", "json", "csv", "influx", "prometheus",
+	"histogram[:buckets]", "histogram:auto[:n]", "histogram:log[:n]", "throughput", "bodies", "results",
+	"plot:timings", "plot:png", "html", "summary", "apdex[:T]",
+}
+
+// defaultApdexTarget is the target latency T of the apdex reporter
+const defaultApdexTarget = 500 * time.Millisecond
+
+// defaultBuckets are the latency buckets of the histogram reporter
+var defaultBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+// defaultAutoBuckets is the number of buckets of the histogram reporter
+// when computed out of the observed latencies
+const defaultAutoBuckets = 10
+
+// newReporter returns the Reporter with the passed name.
+// The text reporter optionally takes comma separated latency thresholds to
+// report the percentage of responses below, e.g. text:200ms,1s.
+// The histogram reporter optionally takes comma separated bucket
+// boundaries, e.g. histogram:10ms,100ms,1s, or computes a number of
+// linearly or logarithmically spaced buckets, e.g. histogram:log:20
+func newReporter(name string) (vegeta.Reporter, error) {
+	switch {
+	case name == "text":
+		return vegeta.NewTextReporter(), nil
+	case strings.HasPrefix(name, "text:"):
+		thresholds, err := parseDurations(strings.TrimPrefix(name, "text:"), "latency threshold")
+		if err != nil {
+			return nil, err
+		}
+		rep := vegeta.NewTextReporter()
+		rep.Thresholds = thresholds
+		return rep, nil
+	case name == "json":
+		return vegeta.NewJSONReporter(), nil
+	case name == "csv":
+		return vegeta.NewCSVReporter(), nil
+	case name == "influx":
+		return vegeta.NewInfluxReporter(), nil
+	case name == "prometheus":
+		return vegeta.NewPrometheusReporter(""), nil
+	case name == "histogram":
+		return vegeta.NewHistogramReporter(defaultBuckets), nil
+	case name == "histogram:auto", name == "histogram:log":
+		return vegeta.NewAutoHistogramReporter(defaultAutoBuckets, name == "histogram:log"), nil
+	case strings.HasPrefix(name, "histogram:auto:"), strings.HasPrefix(name, "histogram:log:"):
+		parts := strings.SplitN(name, ":", 3)
+		n, err := strconv.Atoi(parts[2])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid number of histogram buckets `%s`", parts[2])
+		}
+		return vegeta.NewAutoHistogramReporter(n, parts[1] == "log"), nil
+	case strings.HasPrefix(name, "histogram:"):
+		buckets, err := parseDurations(strings.TrimPrefix(name, "histogram:"), "histogram bucket")
+		if err != nil {
+			return nil, err
+		}
+		return vegeta.NewHistogramReporter(buckets), nil
+	case name == "throughput":
+		return vegeta.NewThroughputReporter(time.Second), nil
+	case name == "bodies":
+		return vegeta.NewBodiesReporter(), nil
+	case name == "results":
+		return vegeta.NewResultsReporter(), nil
+	case name == "plot:timings":
+		return vegeta.NewTimingsPlotReporter(), nil
+	case name == "plot:png":
+		return vegeta.NewScatterPlotReporter(), nil
+	case name == "html":
+		return vegeta.NewHTMLReporter(), nil
+	case name == "summary":
+		return vegeta.NewSummaryReporter(), nil
+	case name == "apdex":
+		return vegeta.NewApdexReporter(defaultApdexTarget), nil
+	case strings.HasPrefix(name, "apdex:"):
+		target, err := time.ParseDuration(strings.TrimPrefix(name, "apdex:"))
+		if err != nil || target <= 0 {
+			return nil, fmt.Errorf("Invalid Apdex target latency `%s`", strings.TrimPrefix(name, "apdex:"))
+		}
+		return vegeta.NewApdexReporter(target), nil
+	}
+	return nil, fmt.Errorf("Unknown reporter `%s`. Valid reporters are: %s",
+		name, strings.Join(reporters, ", "))
+}
+
+// headerNames splits a comma separated list of header names
+func headerNames(list string) []string {
+	names := []string{}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseDurations parses a comma separated list of durations, naming them
+// by what in errors
+func parseDurations(list, what string) ([]time.Duration, error) {
+	ds := []time.Duration{}
+	for _, s := range strings.Split(list, ",") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s `%s`: %s", what, s, err)
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// newValidator builds the Validator of the responses out of a comma
+// separated list of status codes and a regular expression of the body,
+// which are both optional
+func newValidator(codes, body string) (vegeta.Validator, error) {
+	v := vegeta.Validator{}
+	var err error
+	if v.Codes, err = parseCodes(codes, "expected"); err != nil {
+		return v, err
+	}
+	if body != "" {
+		re, err := regexp.Compile(body)
+		if err != nil {
+			return v, fmt.Errorf("Invalid expected body: %s", err)
+		}
+		v.Body = re
+	}
+	return v, nil
+}
+
+// parseCodes parses a comma separated list of status codes, naming them
+// by what in errors. An empty list has no codes.
+func parseCodes(list, what string) ([]uint64, error) {
+	if list == "" {
+		return nil, nil
+	}
+	codes := []uint64{}
+	for _, s := range strings.Split(list, ",") {
+		code, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s status code `%s`", what, s)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// basicAuth parses the username and password of user:password credentials.
+// Empty credentials have no username.
+func basicAuth(credentials string) (user, password string, err error) {
+	if credentials == "" {
+		return "", "", nil
+	}
+	parts := strings.SplitN(credentials, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("Invalid basic auth `%s`, want user:password", credentials)
+	}
+	return parts[0], parts[1], nil
+}
+
+// localAddr parses the local IP address of addr, checking that it can be
+// bound to. An empty addr is no address.
+func localAddr(addr string) (net.IP, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("Invalid local address `%s`", addr)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return nil, fmt.Errorf("Unassignable local address `%s`: %s", addr, err)
+	}
+	return ip, ln.Close()
+}
+
+// report writes the report of rep to out and then checks that the success
+// ratio of the attack metrics isn't below the passed threshold.
+// It returns an error in case of failure or breach of the threshold.
+func report(rep vegeta.Reporter, out io.Writer, metrics *vegeta.Metrics, threshold float64) error {
+	if err := rep.Report(out); err != nil {
+		return fmt.Errorf("Failed to report: %s", err)
+	}
+	if metrics.Success < threshold {
+		return fmt.Errorf("Success ratio %.2f%% is below the threshold of %.2f%%",
+			metrics.Success*100, threshold*100)
 	}
+	return nil
 }
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	vegeta "github.com/tsenart/vegeta/lib"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportSuccessThreshold(t *testing.T) {
+	rep := vegeta.NewTextReporter()
+	if err := report(rep, &bytes.Buffer{}, &vegeta.Metrics{Success: 0.98}, 0.99); err == nil {
+		t.Fatal("Success ratio below the threshold didn't fail")
+	}
+	if err := report(rep, &bytes.Buffer{}, &vegeta.Metrics{Success: 0.99}, 0.99); err != nil {
+		t.Fatalf("Success ratio at the threshold failed: %s", err)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestReportWriteFailure(t *testing.T) {
+	err := report(vegeta.NewTextReporter(), failingWriter{}, &vegeta.Metrics{Success: 1}, 0)
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Failed write of the report didn't fail: %v", err)
+	}
+}
+
+func TestNewReporter(t *testing.T) {
+	slos := vegeta.NewTextReporter()
+	slos.Thresholds = []time.Duration{200 * time.Millisecond, time.Second}
+	for name, want := range map[string]vegeta.Reporter{
+		"text":                 vegeta.NewTextReporter(),
+		"text:200ms,1s":        slos,
+		"json":                 vegeta.NewJSONReporter(),
+		"csv":                  vegeta.NewCSVReporter(),
+		"influx":               vegeta.NewInfluxReporter(),
+		"prometheus":           vegeta.NewPrometheusReporter(""),
+		"histogram":            vegeta.NewHistogramReporter(defaultBuckets),
+		"histogram:10ms,500ms": vegeta.NewHistogramReporter([]time.Duration{10 * time.Millisecond, 500 * time.Millisecond}),
+		"histogram:auto":       vegeta.NewAutoHistogramReporter(defaultAutoBuckets, false),
+		"histogram:log:20":     vegeta.NewAutoHistogramReporter(20, true),
+		"throughput":           vegeta.NewThroughputReporter(time.Second),
+		"bodies":               vegeta.NewBodiesReporter(),
+		"results":              vegeta.NewResultsReporter(),
+		"plot:timings":         vegeta.NewTimingsPlotReporter(),
+		"plot:png":             vegeta.NewScatterPlotReporter(),
+		"html":                 vegeta.NewHTMLReporter(),
+		"summary":              vegeta.NewSummaryReporter(),
+		"apdex":                vegeta.NewApdexReporter(defaultApdexTarget),
+		"apdex:1s":             vegeta.NewApdexReporter(time.Second),
+	} {
+		got, err := newReporter(name)
+		if err != nil {
+			t.Fatalf("Reporter %s failed: %s", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Wrong reporter %s: want %#v, got %#v", name, want, got)
+		}
+	}
+}
+
+func TestNewReporterErrors(t *testing.T) {
+	if _, err := newReporter("xml"); err == nil || !strings.Contains(err.Error(), strings.Join(reporters, ", ")) {
+		t.Errorf("Unknown reporter didn't list the valid ones: %v", err)
+	}
+	if _, err := newReporter("histogram:10ms,fast"); err == nil {
+		t.Error("Invalid histogram bucket didn't fail")
+	}
+	if _, err := newReporter("text:fast"); err == nil {
+		t.Error("Invalid latency threshold didn't fail")
+	}
+	if _, err := newReporter("histogram:auto:0"); err == nil {
+		t.Error("Invalid number of histogram buckets didn't fail")
+	}
+	if _, err := newReporter("apdex:0s"); err == nil {
+		t.Error("Invalid Apdex target latency didn't fail")
+	}
+}
+
+func TestReportToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.txt")
+	if err = ioutil.WriteFile(path, []byte("stale contents which are longer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := openOutput(path)
+	if err != nil {
+		t.Fatalf("Couldn't open output: %s", err)
+	}
+	if err = report(vegeta.NewTextReporter(), out, &vegeta.Metrics{}, 0); err != nil {
+		t.Fatalf("Report failed: %s", err)
+	}
+	if err = out.Close(); err != nil {
+		t.Fatalf("Couldn't close output: %s", err)
+	}
+	if _, err = out.Write([]byte("more")); err == nil {
+		t.Error("Output wasn't closed")
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(contents), "No results recorded\n"; got != want {
+		t.Fatalf("Wrong report file contents: want %q, got %q", want, got)
+	}
+}
+
+func TestInvalidFlagsKeepReportFile(t *testing.T) {
+	if args := os.Getenv("VEGETA_TEST_ARGS"); args != "" { // In the subprocess
+		os.Args = append([]string{"vegeta"}, strings.Split(args, " ")...)
+		main()
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, targets := filepath.Join(dir, "report.txt"), filepath.Join(dir, "targets.txt")
+	if err = ioutil.WriteFile(path, []byte("earlier report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(targets, []byte("GET http://localhost/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range []string{
+		"-body-template=" + filepath.Join(dir, "missing.tmpl"),
+		"-expect-body=(",
+		"-ok-codes=abc",
+		"-proxy=:/",
+		"-pacing=bursty",
+		"-inputs=" + filepath.Join(dir, "missing.json"),
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestInvalidFlagsKeepReportFile$")
+		cmd.Env = append(os.Environ(), "VEGETA_TEST_ARGS=-targets="+targets+" -output="+path+" "+args)
+		if out, err := cmd.CombinedOutput(); err == nil {
+			t.Fatalf("%s: vegeta didn't fail: %s", args, out)
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != "earlier report" {
+			t.Errorf("%s: report file was overwritten with %q", args, contents)
+		}
+	}
+}
+
+func TestHeadersFlag(t *testing.T) {
+	h := headers{http.Header{}}
+	for _, value := range []string{"Accept: text/html", "X-Id:1", "X-Id: 2"} {
+		if err := h.Set(value); err != nil {
+			t.Fatalf("Valid header %s failed: %s", value, err)
+		}
+	}
+	want := http.Header{"Accept": {"text/html"}, "X-Id": {"1", "2"}}
+	if !reflect.DeepEqual(h.Header, want) {
+		t.Fatalf("Wrong headers: want %v, got %v", want, h.Header)
+	}
+	for _, value := range []string{"Accept", ": text/html"} {
+		if err := h.Set(value); err == nil {
+			t.Errorf("Invalid header %s didn't fail", value)
+		}
+	}
+}
+
+func TestMetadataFlag(t *testing.T) {
+	m := metadata{}
+	for _, value := range []string{"name=nightly", "commit=8f3a2c1", "query=a=b"} {
+		if err := m.Set(value); err != nil {
+			t.Fatalf("Valid metadata %s failed: %s", value, err)
+		}
+	}
+	if want := "commit=8f3a2c1,name=nightly,query=a=b"; m.String() != want {
+		t.Fatalf("Wrong metadata: want %s, got %s", want, m)
+	}
+	for _, value := range []string{"name", "=nightly", "name="} {
+		if err := m.Set(value); err == nil {
+			t.Errorf("Invalid metadata %s didn't fail", value)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // Silence handshake errors
+	server.StartTLS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pair := server.TLS.Certificates[0]
+	der, err := x509.MarshalPKCS8PrivateKey(pair.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.Certificate[0]}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	for _, tc := range []struct {
+		certs, cert, key string
+		ok               bool
+	}{
+		{"", "", "", false},
+		{certFile, "", "", false},
+		{certFile, certFile, keyFile, true},
+	} {
+		c, err := tlsConfig(false, tc.certs, tc.cert, tc.key)
+		if err != nil {
+			t.Fatalf("Couldn't build TLS config: %s", err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: c}}
+		res, err := client.Get(server.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("Wrong outcome with %+v: want ok %t, got %v", tc, tc.ok, err)
+		}
+	}
+
+	if _, err := tlsConfig(false, keyFile, "", ""); err == nil {
+		t.Error("Invalid root certificates didn't fail")
+	}
+	if _, err := tlsConfig(false, "", certFile, ""); err == nil {
+		t.Error("Client certificate without a key didn't fail")
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := []string{filepath.Join(dir, "node1.json"), filepath.Join(dir, "node2.json")}
+	for i, path := range paths {
+		line := fmt.Sprintf(`{"timestamp":"2013-08-01T10:00:0%dZ","code":200,"latency":1000000}`, i)
+		if err := ioutil.WriteFile(path, []byte(line+"\n"+line+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := mergeFiles(vegeta.NewTextReporter(), paths, vegeta.NearestRank)
+	if err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	}
+	if m.Requests != 4 {
+		t.Fatalf("Wrong number of merged requests: want 4, got %d", m.Requests)
+	}
+	if _, err := mergeFiles(vegeta.NewTextReporter(), []string{filepath.Join(dir, "missing.json")}, vegeta.NearestRank); err == nil {
+		t.Fatal("Missing results file didn't fail")
+	}
+}
+
+func TestCompareFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	before, after := filepath.Join(dir, "before.json"), filepath.Join(dir, "after.json")
+	ioutil.WriteFile(before, []byte(`{"timestamp":"2013-08-01T10:00:00Z","code":200,"latency":1000000}`+"\n"), 0644)
+	ioutil.WriteFile(after, []byte(`{"timestamp":"2013-08-01T10:00:00Z","code":200,"latency":2000000}`+"\n"), 0644)
+
+	c, err := compareFiles(before, after, vegeta.NearestRank)
+	if err != nil {
+		t.Fatalf("Compare failed: %s", err)
+	}
+	if d := c.Deltas[0]; d.Change != 1 || !d.Regression {
+		t.Fatalf("Wrong delta of the median latency: %+v", d)
+	}
+	if _, err := compareFiles(before, filepath.Join(dir, "missing.json"), vegeta.NearestRank); err == nil {
+		t.Fatal("Missing results file didn't fail")
+	}
+}
+
+func TestAchievedRate(t *testing.T) {
+	want := "Achieved 45.00 requests per second, 90.00% of the requested 50"
+	if got := achievedRate(&vegeta.Metrics{Rate: 45}, 50); got != want {
+		t.Fatalf("Wrong achieved rate: want %q, got %q", want, got)
+	}
+}
+
+func TestNewTemplateBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	valid, invalid := filepath.Join(dir, "valid.tmpl"), filepath.Join(dir, "invalid.tmpl")
+	ioutil.WriteFile(valid, []byte(`{"seq": {{.Seq}}}`), 0644)
+	ioutil.WriteFile(invalid, []byte(`{"seq": {{.Seq}`), 0644)
+
+	if _, err := newTemplateBody(valid, nil); err != nil {
+		t.Errorf("Valid template failed: %s", err)
+	}
+	for _, path := range []string{invalid, filepath.Join(dir, "missing.tmpl")} {
+		if _, err := newTemplateBody(path, nil); err == nil {
+			t.Errorf("Template %s didn't fail", path)
+		}
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	v, err := newValidator("200,204", "^ok$")
+	if err != nil {
+		t.Fatalf("Valid expectations failed: %s", err)
+	}
+	if !reflect.DeepEqual(v.Codes, []uint64{200, 204}) || v.Body.String() != "^ok$" {
+		t.Fatalf("Wrong validator: %+v", v)
+	}
+	if v, err := newValidator("", ""); err != nil || v.Codes != nil || v.Body != nil {
+		t.Fatalf("Empty expectations validate: %+v (%v)", v, err)
+	}
+	for _, bad := range [][2]string{{"200,2xx", ""}, {"", "("}} {
+		if _, err := newValidator(bad[0], bad[1]); err == nil {
+			t.Errorf("Invalid expectations %q didn't fail", bad)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	if user, password, err := basicAuth("goku:kame:hame"); err != nil || user != "goku" || password != "kame:hame" {
+		t.Fatalf("Wrong credentials: %q %q (%v)", user, password, err)
+	}
+	for _, bad := range []string{"goku", ":secret"} {
+		if _, _, err := basicAuth(bad); err == nil {
+			t.Errorf("Invalid credentials %q didn't fail", bad)
+		}
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	if ip, err := localAddr("127.0.0.1"); err != nil || !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Fatalf("Loopback address failed: %v (%v)", ip, err)
+	}
+	if ip, err := localAddr(""); err != nil || ip != nil {
+		t.Fatalf("Empty address binds: %v (%v)", ip, err)
+	}
+	for _, bad := range []string{"localhost:80", "192.0.2.1"} {
+		if _, err := localAddr(bad); err == nil {
+			t.Errorf("Invalid local address %q didn't fail", bad)
+		}
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vegeta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	text, json := filepath.Join(dir, "targets.txt"), filepath.Join(dir, "targets.json")
+	ioutil.WriteFile(text, []byte("GET http://lolcathost:9999/\n"), 0644)
+	ioutil.WriteFile(json, []byte(`[{"method": "GET", "url": "http://lolcathost:9999/"}]`), 0644)
+
+	for path, format := range map[string]string{text: "text", json: "json"} {
+		if targets, err := readTargets(path, format); err != nil || len(targets) != 1 {
+			t.Errorf("Wrong %s targets: %v (%v)", format, targets, err)
+		}
+	}
+	if _, err := readTargets(text, "json"); err == nil {
+		t.Error("Text targets were read as JSON")
+	}
+	if _, err := readTargets(json, "yaml"); err == nil {
+		t.Error("Unknown format didn't fail")
+	}
+	if errs := validateTargets(text, "json"); len(errs) != 1 {
+		t.Errorf("Invalid JSON targets weren't reported: %v", errs)
+	}
+}